@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/alertmanager"
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/grafana"
+)
+
+// checkTimeout bounds each connectivity check run by -check
+const checkTimeout = 10 * time.Second
+
+// runCheck verifies connectivity and credentials for both backends and writes a pass/fail report to w
+// It returns false when any check fails; a Grafana client that isn't configured is reported as skipped
+func runCheck(w io.Writer, amClient *alertmanager.Client, grafanaClient *grafana.Client) bool {
+	ok := true
+	report := func(name string, err error) {
+		if err != nil {
+			ok = false
+			fmt.Fprintf(w, "FAIL  %s: %v\n", name, err)
+			return
+		}
+		fmt.Fprintf(w, "PASS  %s\n", name)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+	defer cancel()
+	report("Alertmanager status", amClient.Ping(ctx))
+
+	if grafanaClient == nil {
+		fmt.Fprintln(w, "SKIP  Grafana IRM: not configured")
+		return ok
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), checkTimeout)
+	defer cancel()
+	report("Grafana IRM authentication", grafanaClient.Ping(ctx))
+
+	ctx, cancel = context.WithTimeout(context.Background(), checkTimeout)
+	defer cancel()
+	groups, err := grafanaClient.GetAllAlertGroups(ctx)
+	if err == nil {
+		fmt.Fprintf(w, "      Fetched %d alert groups\n", len(groups))
+	}
+	report("Grafana IRM alert groups", err)
+
+	return ok
+}
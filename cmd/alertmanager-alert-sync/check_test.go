@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/alertmanager"
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/config"
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/grafana"
+)
+
+// checkBackends starts stub Alertmanager and Grafana IRM servers that either answer normally or fail
+func checkBackends(t *testing.T, healthy bool) (*alertmanager.Client, *grafana.Client) {
+	t.Helper()
+
+	amServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if !healthy {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `"unavailable"`)
+			return
+		}
+		fmt.Fprint(w, `{"cluster":{"status":"ready"},"config":{"original":""},"uptime":"2024-01-01T00:00:00Z","versionInfo":{}}`)
+	}))
+	t.Cleanup(amServer.Close)
+
+	grafanaServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if !healthy {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"detail":"Invalid token"}`)
+			return
+		}
+		json.NewEncoder(w).Encode(grafana.AlertGroupResponse{
+			Results: []grafana.AlertGroup{{ID: "I1"}, {ID: "I2"}},
+		})
+	}))
+	t.Cleanup(grafanaServer.Close)
+
+	amClient := alertmanager.NewClient(config.AlertmanagerConfig{Host: strings.TrimPrefix(amServer.URL, "http://")})
+	grafanaClient, err := grafana.NewClient(config.GrafanaConfig{URL: grafanaServer.URL, Token: "glsa_test"})
+	if err != nil {
+		t.Fatalf("creating grafana client: %v", err)
+	}
+	return amClient, grafanaClient
+}
+
+func TestRunCheck(t *testing.T) {
+	t.Run("healthy backends", func(t *testing.T) {
+		amClient, grafanaClient := checkBackends(t, true)
+
+		var out strings.Builder
+		if !runCheck(&out, amClient, grafanaClient) {
+			t.Errorf("runCheck() = false, want true; output:\n%s", out.String())
+		}
+		for _, want := range []string{
+			"PASS  Alertmanager status",
+			"PASS  Grafana IRM authentication",
+			"Fetched 2 alert groups",
+			"PASS  Grafana IRM alert groups",
+		} {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("output missing %q:\n%s", want, out.String())
+			}
+		}
+		if strings.Contains(out.String(), "FAIL") {
+			t.Errorf("output reports a failure:\n%s", out.String())
+		}
+	})
+
+	t.Run("failing backends", func(t *testing.T) {
+		amClient, grafanaClient := checkBackends(t, false)
+
+		var out strings.Builder
+		if runCheck(&out, amClient, grafanaClient) {
+			t.Errorf("runCheck() = true, want false; output:\n%s", out.String())
+		}
+		for _, want := range []string{
+			"FAIL  Alertmanager status",
+			"FAIL  Grafana IRM authentication",
+			"FAIL  Grafana IRM alert groups",
+		} {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("output missing %q:\n%s", want, out.String())
+			}
+		}
+		if strings.Contains(out.String(), "PASS") {
+			t.Errorf("output reports a pass:\n%s", out.String())
+		}
+	})
+
+	t.Run("grafana not configured", func(t *testing.T) {
+		amClient, _ := checkBackends(t, true)
+
+		var out strings.Builder
+		if !runCheck(&out, amClient, nil) {
+			t.Errorf("runCheck() = false, want true; output:\n%s", out.String())
+		}
+		if !strings.Contains(out.String(), "SKIP  Grafana IRM: not configured") {
+			t.Errorf("output missing the Grafana skip line:\n%s", out.String())
+		}
+	})
+}
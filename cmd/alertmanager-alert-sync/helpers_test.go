@@ -0,0 +1,38 @@
+package main
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/config"
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	exporterOnce sync.Once
+	exporter     *metrics.Exporter
+)
+
+// testExporter returns the exporter shared by the package tests, as its metrics can only be registered once
+func testExporter() *metrics.Exporter {
+	exporterOnce.Do(func() {
+		exporter = metrics.NewExporter(config.MetricsConfig{}, config.TenantConfig{})
+	})
+	return exporter
+}
+
+// counterValue returns the value of the named unlabelled counter from the default registry
+func counterValue(t *testing.T, name string) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("gathering metrics: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() == name && len(family.GetMetric()) == 1 {
+			return family.GetMetric()[0].GetCounter().GetValue()
+		}
+	}
+	return 0
+}
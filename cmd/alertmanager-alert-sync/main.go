@@ -2,41 +2,99 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"math/rand/v2"
+	"net"
 	"net/http"
 	"os"
-	"strconv"
+	"os/signal"
+	"runtime/debug"
+	"syscall"
 	"time"
 
 	"github.com/gabrielpetry/alertmanager-alert-sync/internal/alertmanager"
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/audit"
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/config"
 	"github.com/gabrielpetry/alertmanager-alert-sync/internal/grafana"
 	"github.com/gabrielpetry/alertmanager-alert-sync/internal/metrics"
 	"github.com/gabrielpetry/alertmanager-alert-sync/internal/server"
 	"github.com/gabrielpetry/alertmanager-alert-sync/internal/sync"
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/version"
 )
 
 func main() {
-	log.Println("Starting Alertmanager Alert Sync...")
+	check := flag.Bool("check", false, "check connectivity to Alertmanager and Grafana IRM, then exit")
+	flag.Parse()
+
+	buildInfo := version.Get()
+	log.Printf("Starting Alertmanager Alert Sync %s (commit: %s, built: %s, %s)...",
+		buildInfo.Version, buildInfo.Commit, buildInfo.BuildDate, buildInfo.GoVersion)
+
+	// Load configuration from CONFIG_FILE (optional) and environment variables
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	// -check only connects to the backends, so only their settings need to be valid
+	validate := cfg.Validate
+	if *check {
+		validate = cfg.ValidateBackends
+	}
+	if err := validate(); err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+
+	// Record automated resolve and silence actions in the audit log
+	if err := audit.Configure(cfg.Audit.File); err != nil {
+		log.Fatalf("Failed to configure audit log: %v", err)
+	}
+
+	// SIGINT and SIGTERM start a graceful shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	// Initialize Alertmanager client
-	amClient := alertmanager.NewClient()
+	amClient := alertmanager.NewClient(cfg.Alertmanager)
 
 	// Initialize Grafana IRM client
-	grafanaClient, err := grafana.NewClient()
+	grafanaClient, err := grafana.NewClient(cfg.Grafana)
 	if err != nil {
-		log.Printf("Warning: Grafana client initialization failed: %v", err)
-		log.Println("Reconciliation features will be disabled")
+		log.Printf("WARNING: Grafana IRM integration DISABLED: client initialization failed: %v", err)
+		log.Println("WARNING: reconciliation, silence sync and webhooks will not run (the grafana_enabled metric is 0)")
 		grafanaClient = nil
 	}
 
+	// -check only verifies the backends, without starting the server or the reconciliation loop
+	if *check {
+		if !runCheck(os.Stdout, amClient, grafanaClient) {
+			log.Println("Connectivity check failed")
+			os.Exit(1)
+		}
+		log.Println("Connectivity check passed")
+		return
+	}
+
 	// Initialize metrics exporter
-	exporter := metrics.NewExporter()
+	exporter := metrics.NewExporter(cfg.Metrics, cfg.Tenant)
+
+	// Expose whether the Grafana IRM integration is active so dashboards can tell disabled from broken
+	exporter.RecordGrafanaEnabled(grafanaClient != nil)
+
+	// Count API requests made to each backend, the alerts dropped by the cap and the silences created or expired
+	amClient.SetRequestObserver(exporter.APIRequestObserver("alertmanager"))
+	amClient.SetTruncationObserver(exporter.AlertTruncationObserver())
+	amClient.SetSilenceObserver(exporter.SilenceObserver())
+	if grafanaClient != nil {
+		grafanaClient.SetRequestObserver(exporter.APIRequestObserver("grafana"))
+	}
 
 	// Initialize reconciler (if Grafana client is available)
 	var reconciler *sync.Reconciler
 	if grafanaClient != nil {
-		reconciler = sync.NewReconciler(amClient, grafanaClient, exporter)
+		reconciler = sync.NewReconciler(amClient, grafanaClient, exporter, cfg.Reconcile, cfg.Tenant)
 	}
 
 	// Initialize server with all dependencies
@@ -45,20 +103,37 @@ func main() {
 	// Initialize webhook handler if Grafana client is available
 	var webhookHandler *server.WebhookHandler
 	if grafanaClient != nil {
-		webhookHandler = server.NewWebhookHandler(amClient, grafanaClient)
+		webhookHandler = server.NewWebhookHandler(amClient, grafanaClient, exporter, cfg.Webhook)
+		go webhookHandler.WatchAllowlistFile(context.Background())
+		webhookHandler.SetRefresher(reconciler.ReconcileAndResolve)
 	}
 
 	// Start background reconciliation if enabled
+	// loopDone is closed once the reconciliation loop has returned (immediately when it never runs)
+	loopDone := make(chan struct{})
+	loopStarted := false
 	if reconciler != nil {
-		reconcileIntervalStr := os.Getenv("RECONCILE_INTERVAL")
-		if reconcileIntervalStr != "" {
-			interval, err := strconv.Atoi(reconcileIntervalStr)
-			if err != nil || interval <= 0 {
-				log.Printf("Invalid RECONCILE_INTERVAL value '%s', must be a positive integer (seconds)", reconcileIntervalStr)
+		interval := cfg.Reconcile.Interval
+		if interval != 0 {
+			if interval < 0 {
+				log.Printf("Invalid RECONCILE_INTERVAL value '%d', must be a positive integer (seconds)", interval)
 			} else {
+				// Each cycle is bounded by RECONCILE_TIMEOUT, defaulting to the interval
+				timeout := interval
+				if cfg.Reconcile.Timeout < 0 {
+					log.Printf("Invalid RECONCILE_TIMEOUT value '%d', must be a positive integer (seconds), using interval", cfg.Reconcile.Timeout)
+				} else if cfg.Reconcile.Timeout > 0 {
+					timeout = cfg.Reconcile.Timeout
+				}
+
 				// Use optimized reconciliation that handles both sync and metrics export
-				go startOptimizedReconciliationLoop(reconciler, time.Duration(interval)*time.Second)
-				log.Printf("Optimized background reconciliation enabled with interval: %d seconds", interval)
+				loopStarted = true
+				go func() {
+					defer close(loopDone)
+					startOptimizedReconciliationLoop(ctx, reconciler, exporter, time.Duration(interval)*time.Second, time.Duration(timeout)*time.Second, cfg.Reconcile.Jitter)
+				}()
+				srv.SetReconcileLoopEnabled(true)
+				log.Printf("Optimized background reconciliation enabled with interval: %d seconds (timeout: %d seconds)", interval, timeout)
 				log.Println("This includes both alert metrics export and silence synchronization")
 			}
 		} else {
@@ -68,73 +143,226 @@ func main() {
 		log.Println("Grafana IRM integration disabled - no background processing available")
 	}
 
+	if !loopStarted {
+		close(loopDone)
+	}
+
 	// Register HTTP handlers
 	mux := http.NewServeMux()
-	mux.HandleFunc("/metrics", srv.MetricsHandler)
+	// Metrics endpoints require a bearer token when METRICS_AUTH_TOKEN is set
+	mux.HandleFunc("/metrics", server.BearerTokenMiddleware(cfg.Server.MetricsAuthToken, srv.MetricsHandler))
+	mux.HandleFunc("/export", server.BearerTokenMiddleware(cfg.Server.MetricsAuthToken, srv.ExportHandler))
+	// Inconsistencies expose alert names and labels, so they are protected like the metrics
+	mux.HandleFunc("/inconsistencies", server.BearerTokenMiddleware(cfg.Server.MetricsAuthToken, srv.InconsistenciesHandler))
 	mux.HandleFunc("/healthz", srv.HealthzHandler)
 	mux.HandleFunc("/readyz", srv.ReadyzHandler)
+	mux.HandleFunc("/version", srv.VersionHandler)
+
+	// Profiling endpoints are only exposed when explicitly enabled
+	server.RegisterPprof(mux, cfg.Server)
 
 	// Only register webhook endpoints if Grafana client is available
 	if grafanaClient != nil {
 		if webhookHandler != nil {
 			webhookHandler.RegisterRoutes(mux)
+			mux.HandleFunc("/silences/expire", webhookHandler.RequireAuth(srv.ExpireToolSilencesHandler))
+			mux.HandleFunc("/reconcile", webhookHandler.RequireAuth(srv.ReconcileHandler))
 			log.Println("Webhook endpoint enabled at /webhook (requires basic auth)")
+			log.Println("Alertmanager webhook endpoint enabled at /am-webhook (requires basic auth)")
+			log.Println("Silence expiry endpoint enabled at /silences/expire (requires basic auth)")
+			log.Println("On-demand reconciliation endpoint enabled at /reconcile (requires basic auth)")
 		}
 		log.Println("Grafana IRM integration enabled")
 	} else {
 		log.Println("Grafana IRM integration disabled")
 	}
 
-	// Get port from environment or use default
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
+	port := cfg.Server.Port
 
 	// Start the server
 	log.Printf("Server listening on port :%s", port)
 	log.Printf("Endpoints:")
 	log.Printf("  - /metrics: Prometheus metrics for reconciliation")
+	log.Printf("  - /export: On-demand alert export from Alertmanager")
 	log.Printf("  - /healthz: Liveness probe")
 	log.Printf("  - /readyz: Readiness probe")
+	log.Printf("  - /version: Build information")
+	log.Printf("  - /inconsistencies: Current inconsistencies (read-only)")
+	if cfg.Server.EnablePprof {
+		log.Printf("  - /debug/pprof/: Go profiling endpoints")
+	}
 	if grafanaClient != nil {
 		if webhookHandler != nil {
 			log.Printf("  - /webhook: Grafana IRM webhook endpoint (POST, basic auth required)")
+			log.Printf("  - /am-webhook: Alertmanager webhook endpoint triggering a reconciliation (POST, basic auth required)")
+			log.Printf("  - /silences/expire: Expire every silence created by the webhook (POST with confirm=true, basic auth required)")
+			log.Printf("  - /reconcile: Run a reconciliation cycle and return its summary (POST, basic auth required)")
+		}
+	}
+
+	httpServer := &http.Server{
+		Addr:    fmt.Sprintf(":%s", port),
+		Handler: server.LoggingMiddleware(mux),
+	}
+
+	// Serve HTTPS when a certificate is configured, failing fast if the pair doesn't load
+	if err := configureTLS(httpServer, cfg.Server); err != nil {
+		log.Fatalf("Failed to load TLS certificate: %v", err)
+	}
+	listener, err := net.Listen("tcp", httpServer.Addr)
+	if err != nil {
+		log.Fatalf("Failed to listen on %s: %v", httpServer.Addr, err)
+	}
+	go func() {
+		if err := serve(httpServer, listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
 		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	shutdown(httpServer, loopDone, webhookHandler, cfg.Server.ShutdownTimeout)
+}
+
+// shutdown stops the HTTP server, then waits for the reconciliation loop to finish its current cycle
+// and for the reconciliations triggered by Alertmanager webhooks (if any) to complete
+// Everything is bounded by timeout, after which the process exits regardless
+func shutdown(httpServer *http.Server, loopDone <-chan struct{}, webhookHandler *server.WebhookHandler, timeout time.Duration) {
+	log.Printf("Shutting down (waiting up to %v for in-flight work)...", timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// Once the server is shut down no handler can trigger another refresh
+	if err := httpServer.Shutdown(ctx); err != nil {
+		log.Printf("HTTP server shutdown failed: %v", err)
 	}
 
-	if err := http.ListenAndServe(fmt.Sprintf(":%s", port), mux); err != nil {
-		log.Fatal(err)
+	var refreshesDone <-chan struct{}
+	if webhookHandler != nil {
+		refreshesDone = webhookHandler.RefreshesDone()
+	} else {
+		done := make(chan struct{})
+		close(done)
+		refreshesDone = done
+	}
+
+	for _, work := range []struct {
+		name string
+		done <-chan struct{}
+	}{
+		{name: "the reconciliation cycle", done: loopDone},
+		{name: "webhook-triggered reconciliations", done: refreshesDone},
+	} {
+		select {
+		case <-work.done:
+		case <-ctx.Done():
+			log.Printf("Shutdown timed out before %s finished, Grafana IRM and Alertmanager may be partially synced", work.name)
+			return
+		}
 	}
+	log.Println("Shutdown complete")
 }
 
+// maxBackoffMultiplier caps how many intervals apart cycles are spaced after consecutive failures
+const maxBackoffMultiplier = 16
+
 // startOptimizedReconciliationLoop runs the optimized reconciliation process at regular intervals
 // This handles both metrics export and silence synchronization in parallel
-func startOptimizedReconciliationLoop(reconciler *sync.Reconciler, interval time.Duration) {
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
+// A panic in the loop is logged and the loop restarted, waiting an interval before its next cycle
+// It returns once ctx is done; a cycle already running is left to complete so resolutions aren't cut short
+func startOptimizedReconciliationLoop(ctx context.Context, reconciler *sync.Reconciler, exporter *metrics.Exporter, interval, timeout, jitter time.Duration) {
+	log.Printf("Starting optimized reconciliation loop with interval: %v (jitter: %v)", interval, jitter)
+	runReconciliationLoop(ctx, exporter, interval, jitter, func() bool {
+		return runOptimizedReconciliation(reconciler, timeout)
+	})
+}
+
+// runReconciliationLoop runs cycles from runCycle until ctx is done, restarting the loop after a panic
+// The first cycle runs on startup, the first after a restart waits an interval
+func runReconciliationLoop(ctx context.Context, exporter *metrics.Exporter, interval, jitter time.Duration, runCycle func() bool) {
+	firstDelay := time.Duration(0)
+	for reconciliationLoop(ctx, exporter, interval, jitter, firstDelay, runCycle) {
+		log.Println("Restarting reconciliation loop after a panic")
+		firstDelay = interval
+	}
+}
+
+// reconciliationLoop runs the cycles of runCycle, the first after firstDelay, until ctx is done
+// The first cycle and every interval are delayed by a random duration up to jitter, so replicas drift apart
+// After consecutive failures the interval doubles (up to maxBackoffMultiplier times), resetting on the first success
+// Every tick bumps the loop heartbeat; it reports whether the loop stopped because of a panic
+func reconciliationLoop(ctx context.Context, exporter *metrics.Exporter, interval, jitter, firstDelay time.Duration, runCycle func() bool) (panicked bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Reconciliation loop panicked: %v\n%s", r, debug.Stack())
+			panicked = true
+		}
+	}()
 
-	log.Printf("Starting optimized reconciliation loop with interval: %v", interval)
+	timer := time.NewTimer(withJitter(firstDelay, jitter))
+	defer timer.Stop()
 
-	// Run immediately on startup
-	runOptimizedReconciliation(reconciler)
+	failures := 0
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Reconciliation loop stopped")
+			return false
+		case <-timer.C:
+			// select picks randomly when both are ready, so don't start a cycle after shutdown was requested
+			if ctx.Err() != nil {
+				log.Println("Reconciliation loop stopped")
+				return false
+			}
+			exporter.RecordReconcileLoopHeartbeat()
+
+			// Like a ticker, intervals are measured between cycle starts
+			started := time.Now()
+			if runCycle() {
+				failures = 0
+			} else {
+				failures++
+			}
 
-	// Then run on interval
-	for range ticker.C {
-		runOptimizedReconciliation(reconciler)
+			next := backoffInterval(interval, failures)
+			if next > interval {
+				log.Printf("%d consecutive reconciliation failures, backing off to %v", failures, next)
+			}
+			exporter.RecordReconcileBackoff(next - interval)
+			timer.Reset(max(withJitter(next, jitter)-time.Since(started), 0))
+		}
 	}
 }
 
+// backoffInterval returns the interval doubled for each consecutive failure beyond the first,
+// capped at maxBackoffMultiplier intervals
+func backoffInterval(interval time.Duration, failures int) time.Duration {
+	multiplier := 1
+	for i := 1; i < failures && multiplier < maxBackoffMultiplier; i++ {
+		multiplier *= 2
+	}
+	return interval * time.Duration(multiplier)
+}
+
+// withJitter adds a random duration in [0, jitter) to base
+func withJitter(base, jitter time.Duration) time.Duration {
+	if jitter <= 0 {
+		return base
+	}
+	return base + rand.N(jitter)
+}
+
 // runOptimizedReconciliation performs a single optimized reconciliation cycle with error handling
-func runOptimizedReconciliation(reconciler *sync.Reconciler) {
-	ctx := context.Background()
+// The cycle is cancelled if it does not complete within the given timeout; it reports whether the cycle succeeded
+func runOptimizedReconciliation(reconciler *sync.Reconciler, timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 	log.Println("Running scheduled optimized reconciliation...")
 
-	if err := reconciler.ReconcileAndResolveOptimized(ctx); err != nil {
+	if err := reconciler.ReconcileAndResolve(ctx); err != nil {
 		log.Printf("Optimized reconciliation failed: %v", err)
-	} else {
-		log.Println("Optimized reconciliation completed successfully")
+		return false
 	}
+	log.Println("Optimized reconciliation completed successfully")
+	return true
 }
-
-
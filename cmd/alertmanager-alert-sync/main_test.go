@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/alertmanager"
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/config"
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/grafana"
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/sync"
+)
+
+func TestShutdownWaitsForReconciliationCycle(t *testing.T) {
+	tests := []struct {
+		name      string
+		cycleTime time.Duration
+		timeout   time.Duration
+		wantWait  bool
+	}{
+		{name: "cycle finishes within the timeout", cycleTime: 50 * time.Millisecond, timeout: time.Second, wantWait: true},
+		{name: "cycle outlives the timeout", cycleTime: time.Second, timeout: 50 * time.Millisecond, wantWait: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loopDone := make(chan struct{})
+			go func() {
+				time.Sleep(tt.cycleTime)
+				close(loopDone)
+			}()
+
+			shutdown(&http.Server{}, loopDone, nil, tt.timeout)
+
+			select {
+			case <-loopDone:
+				if !tt.wantWait {
+					t.Error("shutdown waited past its timeout for the cycle")
+				}
+			default:
+				if tt.wantWait {
+					t.Error("shutdown returned before the running cycle completed")
+				}
+			}
+		})
+	}
+}
+
+func TestReconciliationLoopFinishesCycleOnShutdown(t *testing.T) {
+	amServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/api/v2/alerts":
+			fmt.Fprint(w, `[{"labels":{"alertname":"DiskFull"},"annotations":{},"fingerprint":"fp1",
+				"receivers":[{"name":"grafana-irm"}],"startsAt":"2024-01-01T00:00:00Z","endsAt":"2099-01-01T00:00:00Z",
+				"updatedAt":"2024-01-01T00:00:00Z","status":{"state":"suppressed","silencedBy":["s1"],"inhibitedBy":[]}}]`)
+		case r.URL.Path == "/api/v2/silence/s1":
+			fmt.Fprint(w, `{"id":"s1","comment":"maintenance","createdBy":"oncall@example.com","startsAt":"2024-01-01T00:00:00Z",
+				"endsAt":"2099-01-01T00:00:00Z","updatedAt":"2024-01-01T00:00:00Z","status":{"state":"active"},
+				"matchers":[{"name":"alertname","value":"DiskFull","isRegex":false,"isEqual":true}]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer amServer.Close()
+
+	// The alert group listing blocks until released, holding the cycle in flight
+	fetching := make(chan struct{}, 1)
+	release := make(chan struct{})
+	resolved := make(chan string, 1)
+	grafanaServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/api/v1/alert_groups":
+			fetching <- struct{}{}
+			<-release
+			group := grafana.AlertGroup{ID: "IG1", State: "new", AlertsCount: 1}
+			group.LastAlert.Payload.Alerts = []grafana.Alert{{Fingerprint: "fp1"}}
+			json.NewEncoder(w).Encode(grafana.AlertGroupResponse{Results: []grafana.AlertGroup{group}})
+		case r.Method == http.MethodPost && r.URL.Path == "/api/v1/alert_groups/IG1/resolve":
+			resolved <- "IG1"
+			fmt.Fprint(w, `{}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer grafanaServer.Close()
+
+	amClient := alertmanager.NewClient(config.AlertmanagerConfig{Host: strings.TrimPrefix(amServer.URL, "http://")})
+	grafanaClient, err := grafana.NewClient(config.GrafanaConfig{URL: grafanaServer.URL, Token: "glsa_test"})
+	if err != nil {
+		t.Fatalf("creating grafana client: %v", err)
+	}
+	reconciler := sync.NewReconciler(amClient, grafanaClient, testExporter(), config.ReconcileConfig{}, config.TenantConfig{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	loopDone := make(chan struct{})
+	go func() {
+		defer close(loopDone)
+		startOptimizedReconciliationLoop(ctx, reconciler, testExporter(), time.Hour, 5*time.Second, 0)
+	}()
+
+	// Request shutdown while the first cycle is running
+	<-fetching
+	cancel()
+	select {
+	case <-loopDone:
+		t.Fatal("reconciliation loop returned before its running cycle completed")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case <-loopDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("reconciliation loop did not return after shutdown")
+	}
+	select {
+	case groupID := <-resolved:
+		if groupID != "IG1" {
+			t.Errorf("resolved alert group %s, want IG1", groupID)
+		}
+	default:
+		t.Error("the cycle running at shutdown did not resolve its inconsistency")
+	}
+}
+
+func TestReconciliationLoopRecoversFromPanic(t *testing.T) {
+	const heartbeat = "alertmanager_sync_reconcile_loop_heartbeat_total"
+	exporter := testExporter()
+	before := counterValue(t, heartbeat)
+
+	// The first cycle panics, the loop must restart and keep running cycles
+	var cycles atomic.Int32
+	ran := make(chan struct{}, 10)
+	runCycle := func() bool {
+		if cycles.Add(1) == 1 {
+			panic("boom")
+		}
+		ran <- struct{}{}
+		return true
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	loopDone := make(chan struct{})
+	go func() {
+		defer close(loopDone)
+		runReconciliationLoop(ctx, exporter, 10*time.Millisecond, 0, runCycle)
+	}()
+
+	for i := range 2 {
+		select {
+		case <-ran:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("ran %d cycles after the panic, want the loop restarted", i)
+		}
+	}
+	cancel()
+	select {
+	case <-loopDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("reconciliation loop did not stop after cancellation")
+	}
+
+	if got := counterValue(t, heartbeat) - before; got < 3 {
+		t.Errorf("%s increased by %v, want a tick for the panicking cycle and each later one", heartbeat, got)
+	}
+}
+
+func TestWithJitter(t *testing.T) {
+	tests := []struct {
+		name         string
+		base, jitter time.Duration
+	}{
+		{name: "first cycle", base: 0, jitter: 10 * time.Second},
+		{name: "interval", base: time.Minute, jitter: 10 * time.Second},
+		{name: "tiny jitter", base: time.Minute, jitter: time.Nanosecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for range 1000 {
+				if got := withJitter(tt.base, tt.jitter); got < tt.base || got >= tt.base+tt.jitter {
+					t.Fatalf("withJitter(%v, %v) = %v, want within [%v, %v)", tt.base, tt.jitter, got, tt.base, tt.base+tt.jitter)
+				}
+			}
+		})
+	}
+
+	for _, jitter := range []time.Duration{0, -time.Second} {
+		if got := withJitter(time.Minute, jitter); got != time.Minute {
+			t.Errorf("withJitter(1m, %v) = %v, want the base interval unchanged", jitter, got)
+		}
+	}
+}
+
+func TestBackoffInterval(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{failures: 0, want: time.Minute},
+		{failures: 1, want: time.Minute},
+		{failures: 2, want: 2 * time.Minute},
+		{failures: 3, want: 4 * time.Minute},
+		{failures: 10, want: maxBackoffMultiplier * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := backoffInterval(time.Minute, tt.failures); got != tt.want {
+			t.Errorf("backoffInterval(1m, %d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestReconciliationLoopBacksOff(t *testing.T) {
+	const interval = 50 * time.Millisecond
+
+	// Alertmanager fails the first three cycles, then recovers
+	var requests atomic.Int32
+	cycles := make(chan time.Time, 100)
+	amServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cycles <- time.Now()
+		w.Header().Set("Content-Type", "application/json")
+		if requests.Add(1) <= 3 {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `"unavailable"`)
+			return
+		}
+		fmt.Fprint(w, `[]`)
+	}))
+	defer amServer.Close()
+	grafanaServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(grafana.AlertGroupResponse{})
+	}))
+	defer grafanaServer.Close()
+
+	amClient := alertmanager.NewClient(config.AlertmanagerConfig{Host: strings.TrimPrefix(amServer.URL, "http://")})
+	grafanaClient, err := grafana.NewClient(config.GrafanaConfig{URL: grafanaServer.URL, Token: "glsa_test"})
+	if err != nil {
+		t.Fatalf("creating grafana client: %v", err)
+	}
+	reconciler := sync.NewReconciler(amClient, grafanaClient, testExporter(), config.ReconcileConfig{}, config.TenantConfig{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	loopDone := make(chan struct{})
+	go func() {
+		defer close(loopDone)
+		startOptimizedReconciliationLoop(ctx, reconciler, testExporter(), interval, 5*time.Second, 0)
+	}()
+
+	starts := make([]time.Time, 5)
+	for i := range starts {
+		select {
+		case starts[i] = <-cycles:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("ran %d cycles, want 5", i)
+		}
+	}
+	cancel()
+	<-loopDone
+
+	// Cycles follow 1, 2 and 4 intervals after the failures, then 1 interval again after the success
+	gaps := make([]time.Duration, 4)
+	for i := range gaps {
+		gaps[i] = starts[i+1].Sub(starts[i])
+	}
+	// Gaps are measured at the stub server, so allow a little scheduling slack below the backoff
+	const slack = interval / 10
+	if gaps[1] < 2*interval-slack || gaps[2] < 4*interval-slack {
+		t.Errorf("gaps after consecutive failures = %v, want about %v and %v", gaps[1:3], 2*interval, 4*interval)
+	}
+	if gaps[3] >= gaps[2]/2 {
+		t.Errorf("gap after a success = %v, want the backoff reset (previous gap %v)", gaps[3], gaps[2])
+	}
+}
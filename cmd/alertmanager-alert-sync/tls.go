@@ -0,0 +1,33 @@
+package main
+
+import (
+	"crypto/tls"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/config"
+)
+
+// configureTLS loads the certificate pair configured with TLS_CERT_FILE and TLS_KEY_FILE into the server,
+// leaving it serving plain HTTP when they are unset
+func configureTLS(httpServer *http.Server, cfg config.ServerConfig) error {
+	if cfg.TLSCertFile == "" || cfg.TLSKeyFile == "" {
+		return nil
+	}
+	certificate, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		return err
+	}
+	httpServer.TLSConfig = &tls.Config{Certificates: []tls.Certificate{certificate}}
+	log.Printf("Serving HTTPS with certificate %s", cfg.TLSCertFile)
+	return nil
+}
+
+// serve accepts connections on listener, over TLS when configureTLS set a certificate
+func serve(httpServer *http.Server, listener net.Listener) error {
+	if httpServer.TLSConfig != nil {
+		return httpServer.ServeTLS(listener, "", "")
+	}
+	return httpServer.Serve(listener)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/config"
+)
+
+// writeSelfSignedCert writes a self-signed certificate for 127.0.0.1 and its key to a temporary directory
+func writeSelfSignedCert(t *testing.T) (certFile, keyFile string, pool *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "alertmanager-alert-sync"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool = x509.NewCertPool()
+	pool.AddCert(cert)
+	return certFile, keyFile, pool
+}
+
+// startServer serves a handler answering "ok" on a local port with the given server settings
+func startServer(t *testing.T, cfg config.ServerConfig) string {
+	t.Helper()
+	httpServer := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	})}
+	if err := configureTLS(httpServer, cfg); err != nil {
+		t.Fatalf("configureTLS() error = %v", err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go serve(httpServer, listener)
+	t.Cleanup(func() { httpServer.Close() })
+	return listener.Addr().String()
+}
+
+func TestServeTLS(t *testing.T) {
+	certFile, keyFile, pool := writeSelfSignedCert(t)
+	addr := startServer(t, config.ServerConfig{TLSCertFile: certFile, TLSKeyFile: keyFile})
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	resp, err := client.Get("https://" + addr)
+	if err != nil {
+		t.Fatalf("HTTPS request error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.TLS == nil {
+		t.Errorf("HTTPS response = %d (TLS %v), want 200 over TLS", resp.StatusCode, resp.TLS != nil)
+	}
+
+	// Plain HTTP is refused on the TLS port
+	resp, err = http.Get("http://" + addr)
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			t.Error("plain HTTP request succeeded against the HTTPS server")
+		}
+	}
+}
+
+func TestServeWithoutTLS(t *testing.T) {
+	addr := startServer(t, config.ServerConfig{})
+
+	resp, err := http.Get("http://" + addr)
+	if err != nil {
+		t.Fatalf("HTTP request error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("HTTP response = %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestConfigureTLSInvalidPair(t *testing.T) {
+	certFile, _, _ := writeSelfSignedCert(t)
+	err := configureTLS(&http.Server{}, config.ServerConfig{TLSCertFile: certFile, TLSKeyFile: filepath.Join(t.TempDir(), "missing.key")})
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("configureTLS() error = %v, want the missing key reported", err)
+	}
+}
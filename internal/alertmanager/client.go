@@ -2,48 +2,336 @@ package alertmanager
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
-	"os"
+	"net/http"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/config"
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/logging"
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/version"
+	"github.com/go-openapi/runtime"
+	httptransport "github.com/go-openapi/runtime/client"
 	"github.com/go-openapi/strfmt"
 	amclient "github.com/prometheus/alertmanager/api/v2/client"
 	"github.com/prometheus/alertmanager/api/v2/client/alert"
+	"github.com/prometheus/alertmanager/api/v2/client/general"
 	"github.com/prometheus/alertmanager/api/v2/client/silence"
 	"github.com/prometheus/alertmanager/api/v2/models"
+	"golang.org/x/sync/singleflight"
 )
 
+// ErrReadOnly is returned instead of creating or expiring silences in read-only mode
+// It aliases config.ErrReadOnly, which the Grafana client returns as well
+var ErrReadOnly = config.ErrReadOnly
+
+// ErrInvalidSilence is returned when Alertmanager rejects a silence as invalid (HTTP 400),
+// e.g. for an invalid matcher or an end time in the past; retrying the same silence can't succeed
+var ErrInvalidSilence = errors.New("alertmanager rejected the silence as invalid")
+
 // Client wraps the Alertmanager API client
 type Client struct {
 	api          *amclient.AlertmanagerAPI
 	silenceCache map[string]*models.GettableSilence
 	cacheMutex   sync.RWMutex
+	// silenceFetches coalesces concurrent fetches of the same uncached silence
+	silenceFetches singleflight.Group
+
+	// alertFilter narrows the alerts returned by GetAllAlerts; maxAlerts caps how many are kept (0 = no cap)
+	alertFilter AlertFilter
+	maxAlerts   int
+
+	// getAlertsTimeout and silenceTimeout bound operations whose context has no deadline (0 = no timeout)
+	getAlertsTimeout time.Duration
+	silenceTimeout   time.Duration
+
+	// readOnly rejects silence creation and expiry with ErrReadOnly
+	readOnly bool
+
+	// requestObserver is notified of every API request with its method and status code
+	requestObserver RequestObserver
+	// truncationObserver is notified of the alerts dropped by the maxAlerts cap
+	truncationObserver TruncationObserver
+	// silenceObserver is notified of every silence created or expired
+	silenceObserver SilenceObserver
+}
+
+// RequestObserver is called after each API request with the HTTP method and the
+// response status code, or "error" when no response was received
+type RequestObserver func(method, code string)
+
+// TruncationObserver is called when GetAllAlerts drops alerts beyond the configured maximum,
+// with the number of alerts dropped
+type TruncationObserver func(dropped int)
+
+// SilenceObserver is called after a silence was successfully created or expired,
+// with SilenceCreated or SilenceExpired
+type SilenceObserver func(action string)
+
+// Silence actions reported to the silence observer
+const (
+	SilenceCreated = "created"
+	SilenceExpired = "expired"
+)
+
+// ToolSilenceCommentPrefix starts the comment of every silence created by this tool,
+// which ends with the Grafana IRM alert group ID as "(ID: <id>)"
+const ToolSilenceCommentPrefix = "Automated silence for Grafana IRM Alert Group:"
+
+// ToolSilenceAlertGroupID returns the Grafana IRM alert group ID recorded in the comment of a
+// silence created by this tool; it reports false for any other comment
+func ToolSilenceAlertGroupID(comment string) (string, bool) {
+	if !strings.HasPrefix(comment, ToolSilenceCommentPrefix) || !strings.HasSuffix(comment, ")") {
+		return "", false
+	}
+	start := strings.LastIndex(comment, "(ID: ")
+	if start < 0 {
+		return "", false
+	}
+	id := comment[start+len("(ID: ") : len(comment)-1]
+	return id, id != ""
+}
+
+// ClientConfig holds the explicit settings used to build an Alertmanager client
+type ClientConfig struct {
+	// Host is the Alertmanager host:port
+	Host string
+	// BasePath is an optional path prefix Alertmanager is served under (e.g. /alertmanager)
+	BasePath string
+	// AlertFilter narrows the alerts returned by GetAllAlerts
+	AlertFilter AlertFilter
+	// MaxAlerts caps the number of alerts returned by GetAllAlerts (0 = no cap)
+	MaxAlerts int
+	// GetAlertsTimeout bounds alert fetches when the context has no deadline (0 = no timeout)
+	GetAlertsTimeout time.Duration
+	// SilenceTimeout bounds silence operations when the context has no deadline (0 = no timeout)
+	SilenceTimeout time.Duration
+	// ReadOnly rejects silence creation and expiry with ErrReadOnly without sending a request
+	ReadOnly bool
+	// UserAgent is sent with every request, defaulting to alertmanager-alert-sync/<version>
+	UserAgent string
+	// HTTPClient is used for all API calls; http.DefaultClient is used when nil
+	HTTPClient *http.Client
+}
+
+// NewClient creates a new Alertmanager client for the configured host
+func NewClient(cfg config.AlertmanagerConfig) *Client {
+	return NewClientWithConfig(ClientConfig{
+		Host:             cfg.Host,
+		BasePath:         cfg.BasePath,
+		AlertFilter:      AlertFilter{Matchers: cfg.AlertFilter},
+		MaxAlerts:        cfg.MaxAlerts,
+		GetAlertsTimeout: cfg.GetAlertsTimeout,
+		SilenceTimeout:   cfg.SilenceTimeout,
+		ReadOnly:         cfg.ReadOnly,
+		UserAgent:        cfg.UserAgent,
+	})
+}
+
+// NewClientWithConfig creates a new Alertmanager client from an explicit host and HTTP client
+func NewClientWithConfig(cfg ClientConfig) *Client {
+	c := &Client{
+		silenceCache:     make(map[string]*models.GettableSilence),
+		alertFilter:      cfg.AlertFilter,
+		maxAlerts:        cfg.MaxAlerts,
+		getAlertsTimeout: cfg.GetAlertsTimeout,
+		silenceTimeout:   cfg.SilenceTimeout,
+		readOnly:         cfg.ReadOnly,
+	}
+
+	// Route every API call through an observing transport on a copy of the HTTP client
+	httpClient := &http.Client{}
+	if cfg.HTTPClient != nil {
+		*httpClient = *cfg.HTTPClient
+	}
+	next := httpClient.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	userAgent := cfg.UserAgent
+	if userAgent == "" {
+		userAgent = version.UserAgent()
+	}
+	httpClient.Transport = &observedTransport{
+		client: c,
+		next:   &userAgentTransport{userAgent: userAgent, next: next},
+	}
+
+	basePath := apiBasePath(cfg.BasePath)
+	transport := httptransport.NewWithClient(cfg.Host, basePath, amclient.DefaultSchemes, httpClient)
+	c.api = amclient.New(transport, strfmt.Default)
+	log.Printf("Alertmanager client initialized for host: %s (base path: %s)", cfg.Host, basePath)
+	if cfg.ReadOnly {
+		log.Println("Alertmanager client is read-only, silences will not be created or expired")
+	}
+
+	return c
+}
+
+// SetRequestObserver registers a function notified of every API request
+// It must be called before the client is used concurrently
+func (c *Client) SetRequestObserver(observer RequestObserver) {
+	c.requestObserver = observer
+}
+
+// SetTruncationObserver registers a function notified when alerts are dropped by the maximum alert cap
+// It must be called before the client is used concurrently
+func (c *Client) SetTruncationObserver(observer TruncationObserver) {
+	c.truncationObserver = observer
+}
+
+// SetSilenceObserver registers a function notified of every silence created or expired
+// It must be called before the client is used concurrently
+func (c *Client) SetSilenceObserver(observer SilenceObserver) {
+	c.silenceObserver = observer
+}
+
+// observeSilence notifies the silence observer, if any
+func (c *Client) observeSilence(action string) {
+	if c.silenceObserver != nil {
+		c.silenceObserver(action)
+	}
+}
+
+// userAgentTransport sets the User-Agent header on every request
+type userAgentTransport struct {
+	userAgent string
+	next      http.RoundTripper
+}
+
+// RoundTrip performs the request with the User-Agent header set on a copy of it
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", t.userAgent)
+	return t.next.RoundTrip(req)
+}
+
+// observedTransport reports each round trip to the client's request observer
+type observedTransport struct {
+	client *Client
+	next   http.RoundTripper
 }
 
-// NewClient creates a new Alertmanager client
-// It reads the ALERTMANAGER_HOST environment variable or defaults to localhost:9093
-func NewClient() *Client {
-	alertmanagerHost := os.Getenv("ALERTMANAGER_HOST")
-	if alertmanagerHost == "" {
-		alertmanagerHost = "localhost:9093"
+// RoundTrip performs the request and notifies the request observer, if any
+func (t *observedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if observer := t.client.requestObserver; observer != nil {
+		if err != nil {
+			observer(req.Method, "error")
+		} else {
+			observer(req.Method, strconv.Itoa(resp.StatusCode))
+		}
 	}
+	return resp, err
+}
 
-	cfg := amclient.DefaultTransportConfig().WithHost(alertmanagerHost)
-	api := amclient.NewHTTPClientWithConfig(strfmt.Default, cfg)
-	log.Printf("Alertmanager client initialized for host: %s", alertmanagerHost)
+// apiBasePath joins the optional path prefix with the Alertmanager API v2 base path
+func apiBasePath(prefix string) string {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return amclient.DefaultBasePath
+	}
+	return "/" + prefix + amclient.DefaultBasePath
+}
 
-	return &Client{
-		api:          api,
-		silenceCache: make(map[string]*models.GettableSilence),
+// withTimeout bounds ctx by timeout unless it already has a deadline or timeout is 0
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if _, hasDeadline := ctx.Deadline(); hasDeadline || timeout <= 0 {
+		return ctx, func() {}
 	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// Ping checks connectivity to Alertmanager by querying its status endpoint
+func (c *Client) Ping(ctx context.Context) error {
+	params := general.NewGetStatusParams().
+		WithContext(ctx)
+
+	_, err := c.api.General.GetStatus(params)
+	return err
 }
 
-// GetAllAlerts fetches all alerts from Alertmanager, including resolved and silenced
+// AlertFilter narrows the alerts requested from Alertmanager
+// Nil state flags keep Alertmanager's default of including those alerts
+type AlertFilter struct {
+	// Matchers are label matchers such as team="payments" or severity=~"critical|warning"
+	Matchers []string
+	// Receiver is a regex the alert receivers must match
+	Receiver string
+
+	Active      *bool
+	Silenced    *bool
+	Inhibited   *bool
+	Unprocessed *bool
+}
+
+// GetAllAlerts fetches all alerts from Alertmanager, including silenced ones
+// The configured alert filter is applied and the result is capped at the configured maximum
+// The cap is applied while decoding, so alerts beyond it are counted but never held in memory
 func (c *Client) GetAllAlerts(ctx context.Context) ([]*models.GettableAlert, error) {
+	if c.maxAlerts <= 0 {
+		return c.GetAlertsFiltered(ctx, c.alertFilter)
+	}
+
+	reader := &cappedAlertsReader{maxAlerts: c.maxAlerts}
+	alerts, err := c.getAlerts(ctx, c.alertFilter, func(op *runtime.ClientOperation) {
+		reader.next = op.Reader
+		op.Reader = reader
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if dropped := reader.total - len(alerts); dropped > 0 {
+		logging.Printf(ctx, "Warning: Alertmanager returned %d alerts, only processing the first %d (ALERTMANAGER_MAX_ALERTS)",
+			reader.total, c.maxAlerts)
+		if c.truncationObserver != nil {
+			c.truncationObserver(dropped)
+		}
+	}
+
+	return alerts, nil
+}
+
+// GetAlertsFiltered fetches the alerts matching the filter from Alertmanager
+// Filtering happens server side, so only matching alerts are transferred and decoded
+func (c *Client) GetAlertsFiltered(ctx context.Context, filter AlertFilter) ([]*models.GettableAlert, error) {
+	return c.getAlerts(ctx, filter)
+}
+
+// getAlerts fetches the alerts matching the filter, applying opts to the API operation
+func (c *Client) getAlerts(ctx context.Context, filter AlertFilter, opts ...alert.ClientOption) ([]*models.GettableAlert, error) {
+	ctx, cancel := withTimeout(ctx, c.getAlertsTimeout)
+	defer cancel()
+
 	params := alert.NewGetAlertsParams().
 		WithContext(ctx)
 
-	ok, err := c.api.Alert.GetAlerts(params)
+	if len(filter.Matchers) > 0 {
+		params = params.WithFilter(filter.Matchers)
+	}
+	if filter.Receiver != "" {
+		params = params.WithReceiver(&filter.Receiver)
+	}
+	if filter.Active != nil {
+		params = params.WithActive(filter.Active)
+	}
+	if filter.Silenced != nil {
+		params = params.WithSilenced(filter.Silenced)
+	}
+	if filter.Inhibited != nil {
+		params = params.WithInhibited(filter.Inhibited)
+	}
+	if filter.Unprocessed != nil {
+		params = params.WithUnprocessed(filter.Unprocessed)
+	}
+
+	ok, err := c.api.Alert.GetAlerts(params, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -51,6 +339,54 @@ func (c *Client) GetAllAlerts(ctx context.Context) ([]*models.GettableAlert, err
 	return ok.Payload, nil
 }
 
+// cappedAlertsReader decodes a successful get alerts response one alert at a time, keeping at most
+// maxAlerts of them; the others are only counted in total. Error responses are left to next
+type cappedAlertsReader struct {
+	next      runtime.ClientResponseReader
+	maxAlerts int
+	total     int
+}
+
+// ReadResponse implements runtime.ClientResponseReader
+func (r *cappedAlertsReader) ReadResponse(response runtime.ClientResponse, consumer runtime.Consumer) (interface{}, error) {
+	if response.Code() != http.StatusOK {
+		return r.next.ReadResponse(response, consumer)
+	}
+
+	decoder := json.NewDecoder(response.Body())
+	if token, err := decoder.Token(); err != nil {
+		return nil, fmt.Errorf("decoding alerts: %w", err)
+	} else if token == nil {
+		// A null payload is an empty alert list
+		return &alert.GetAlertsOK{}, nil
+	} else if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return nil, fmt.Errorf("decoding alerts: expected an array, got %v", token)
+	}
+
+	alerts := make(models.GettableAlerts, 0, min(r.maxAlerts, 1024))
+	for decoder.More() {
+		r.total++
+		if len(alerts) < r.maxAlerts {
+			var gettable models.GettableAlert
+			if err := decoder.Decode(&gettable); err != nil {
+				return nil, fmt.Errorf("decoding alert %d: %w", r.total, err)
+			}
+			alerts = append(alerts, &gettable)
+			continue
+		}
+		// Alerts beyond the cap are skipped without being kept
+		var skipped json.RawMessage
+		if err := decoder.Decode(&skipped); err != nil {
+			return nil, fmt.Errorf("decoding alert %d: %w", r.total, err)
+		}
+	}
+	if _, err := decoder.Token(); err != nil {
+		return nil, fmt.Errorf("decoding alerts: %w", err)
+	}
+
+	return &alert.GetAlertsOK{Payload: alerts}, nil
+}
+
 // GetSilence retrieves silence details by silence ID with caching
 func (c *Client) GetSilence(ctx context.Context, silenceID string) (*models.GettableSilence, error) {
 	if silenceID == "" {
@@ -66,13 +402,35 @@ func (c *Client) GetSilence(ctx context.Context, silenceID string) (*models.Gett
 	c.cacheMutex.RUnlock()
 
 	// Silence not in cache, fetch from API
+	// Concurrent misses for the same silence share a single request
+	// The shared fetch ignores the caller's cancellation, which would otherwise fail every waiter,
+	// and is bounded by the client's own timeout instead
+	fetch := c.silenceFetches.DoChan(silenceID, func() (interface{}, error) {
+		return c.fetchSilence(context.WithoutCancel(ctx), silenceID)
+	})
+	select {
+	case result := <-fetch:
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		return result.Val.(*models.GettableSilence), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// fetchSilence fetches a silence from the API and stores it in the cache
+func (c *Client) fetchSilence(ctx context.Context, silenceID string) (*models.GettableSilence, error) {
+	ctx, cancel := withTimeout(ctx, c.silenceTimeout)
+	defer cancel()
+
 	params := silence.NewGetSilenceParams().
 		WithSilenceID(strfmt.UUID(silenceID)).
 		WithContext(ctx)
 
 	ok, err := c.api.Silence.GetSilence(params)
 	if err != nil {
-		log.Printf("Failed to fetch silence %s: %v", silenceID, err)
+		logging.Printf(ctx, "Failed to fetch silence %s: %v", silenceID, err)
 		return nil, err
 	}
 
@@ -81,10 +439,53 @@ func (c *Client) GetSilence(ctx context.Context, silenceID string) (*models.Gett
 	c.silenceCache[silenceID] = ok.Payload
 	c.cacheMutex.Unlock()
 
-	log.Printf("Cached silence %s (author: %s)", silenceID, *ok.Payload.CreatedBy)
+	logging.Printf(ctx, "Cached silence %s (author: %s)", silenceID, *ok.Payload.CreatedBy)
 	return ok.Payload, nil
 }
 
+// PrewarmSilences caches the given silences that aren't cached yet with a single list request,
+// so an export referencing the same silences from many alerts doesn't fetch each one separately
+// Failures are only logged: the silences are then fetched one by one on first use
+func (c *Client) PrewarmSilences(ctx context.Context, silenceIDs []string) {
+	missing := make(map[string]bool, len(silenceIDs))
+	c.cacheMutex.RLock()
+	for _, silenceID := range silenceIDs {
+		if _, exists := c.silenceCache[silenceID]; !exists && silenceID != "" {
+			missing[silenceID] = true
+		}
+	}
+	c.cacheMutex.RUnlock()
+
+	if len(missing) == 0 {
+		return
+	}
+
+	silences, err := c.GetSilences(ctx)
+	if err != nil {
+		logging.Printf(ctx, "Failed to prewarm %d silences: %v", len(missing), err)
+		return
+	}
+
+	cached := 0
+	c.cacheMutex.Lock()
+	for _, s := range silences {
+		if s != nil && s.ID != nil && missing[*s.ID] {
+			c.silenceCache[*s.ID] = s
+			cached++
+		}
+	}
+	c.cacheMutex.Unlock()
+
+	logging.Printf(ctx, "Prewarmed %d of %d uncached silences", cached, len(missing))
+}
+
+// SilenceCacheSize returns the number of silences currently cached
+func (c *Client) SilenceCacheSize() int {
+	c.cacheMutex.RLock()
+	defer c.cacheMutex.RUnlock()
+	return len(c.silenceCache)
+}
+
 // GetSilenceAuthor retrieves the author of a silence by silence ID (with caching)
 func (c *Client) GetSilenceAuthor(ctx context.Context, silenceID string) string {
 	silence, err := c.GetSilence(ctx, silenceID)
@@ -97,22 +498,108 @@ func (c *Client) GetSilenceAuthor(ctx context.Context, silenceID string) string
 	return ""
 }
 
+// GetSilences fetches all silences from Alertmanager, including expired ones
+func (c *Client) GetSilences(ctx context.Context) ([]*models.GettableSilence, error) {
+	ctx, cancel := withTimeout(ctx, c.silenceTimeout)
+	defer cancel()
+
+	params := silence.NewGetSilencesParams().
+		WithContext(ctx)
+
+	ok, err := c.api.Silence.GetSilences(params)
+	if err != nil {
+		return nil, err
+	}
+
+	return ok.Payload, nil
+}
+
+// FindSilencesByComment returns the silences whose comment contains substr
+func (c *Client) FindSilencesByComment(ctx context.Context, substr string) ([]*models.GettableSilence, error) {
+	silences, err := c.GetSilences(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []*models.GettableSilence
+	for _, s := range silences {
+		if s != nil && s.Comment != nil && strings.Contains(*s.Comment, substr) {
+			matches = append(matches, s)
+		}
+	}
+
+	return matches, nil
+}
+
+// GetSilenceComment retrieves the comment of a silence by silence ID (with caching)
+func (c *Client) GetSilenceComment(ctx context.Context, silenceID string) string {
+	silence, err := c.GetSilence(ctx, silenceID)
+	if err != nil || silence == nil {
+		return ""
+	}
+	if silence.Comment != nil {
+		return *silence.Comment
+	}
+	return ""
+}
+
 // CreateSilence creates a new silence in Alertmanager
 func (c *Client) CreateSilence(ctx context.Context, silenceSpec *models.PostableSilence) (string, error) {
+	if c.readOnly {
+		logging.Printf(ctx, "Read-only mode, not creating silence (comment: %s)", *silenceSpec.Comment)
+		return "", ErrReadOnly
+	}
+
+	ctx, cancel := withTimeout(ctx, c.silenceTimeout)
+	defer cancel()
+
 	params := silence.NewPostSilencesParams().
 		WithSilence(silenceSpec).
 		WithContext(ctx)
 
 	ok, err := c.api.Silence.PostSilences(params)
 	if err != nil {
+		var badRequest *silence.PostSilencesBadRequest
+		if errors.As(err, &badRequest) {
+			return "", fmt.Errorf("%w: %s", ErrInvalidSilence, strings.TrimSpace(badRequest.Payload))
+		}
 		return "", err
 	}
 
 	silenceID := ok.Payload.SilenceID
-	log.Printf("Created silence %s (author: %s, comment: %s)", silenceID, *silenceSpec.CreatedBy, *silenceSpec.Comment)
+	c.observeSilence(SilenceCreated)
+	logging.Printf(ctx, "Created silence %s (author: %s, comment: %s)", silenceID, *silenceSpec.CreatedBy, *silenceSpec.Comment)
 	return silenceID, nil
 }
 
+// ExpireSilence expires the silence with the given ID in Alertmanager
+// The cached copy is dropped so later lookups see the expired silence
+func (c *Client) ExpireSilence(ctx context.Context, silenceID string) error {
+	if c.readOnly {
+		logging.Printf(ctx, "Read-only mode, not expiring silence %s", silenceID)
+		return ErrReadOnly
+	}
+
+	ctx, cancel := withTimeout(ctx, c.silenceTimeout)
+	defer cancel()
+
+	params := silence.NewDeleteSilenceParams().
+		WithSilenceID(strfmt.UUID(silenceID)).
+		WithContext(ctx)
+
+	if _, err := c.api.Silence.DeleteSilence(params); err != nil {
+		return err
+	}
+
+	c.cacheMutex.Lock()
+	delete(c.silenceCache, silenceID)
+	c.cacheMutex.Unlock()
+	c.observeSilence(SilenceExpired)
+
+	logging.Printf(ctx, "Expired silence %s", silenceID)
+	return nil
+}
+
 // IsAlertSilenced checks if an alert is currently silenced in Alertmanager
 func (c *Client) IsAlertSilenced(alert *models.GettableAlert) bool {
 	if alert.Status == nil {
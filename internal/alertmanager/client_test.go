@@ -0,0 +1,604 @@
+package alertmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/config"
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/version"
+	"github.com/go-openapi/strfmt"
+	"github.com/prometheus/alertmanager/api/v2/models"
+)
+
+// countingTransport counts the requests going through the wrapped transport
+type countingTransport struct {
+	next     http.RoundTripper
+	requests atomic.Int32
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests.Add(1)
+	return t.next.RoundTrip(req)
+}
+
+func TestNewClientWithConfig(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/alerts" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `[{"labels":{"alertname":"DiskFull"},"annotations":{},"fingerprint":"fp1",
+			"receivers":[{"name":"default"}],"startsAt":"2024-01-01T00:00:00Z","endsAt":"2024-01-01T01:00:00Z",
+			"updatedAt":"2024-01-01T00:00:00Z","status":{"state":"active","silencedBy":[],"inhibitedBy":[]}}]`)
+	}))
+	defer srv.Close()
+
+	transport := &countingTransport{next: srv.Client().Transport}
+	client := NewClientWithConfig(ClientConfig{
+		Host:       strings.TrimPrefix(srv.URL, "http://"),
+		HTTPClient: &http.Client{Transport: transport},
+	})
+
+	alerts, err := client.GetAllAlerts(context.Background())
+	if err != nil {
+		t.Fatalf("GetAllAlerts() error = %v", err)
+	}
+	if len(alerts) != 1 || *alerts[0].Fingerprint != "fp1" {
+		t.Errorf("GetAllAlerts() = %v, want the served alert fp1", alerts)
+	}
+	if got := transport.requests.Load(); got != 1 {
+		t.Errorf("injected HTTP client made %d requests, want 1", got)
+	}
+}
+
+// deadlineTransport records how far away the request context deadline is
+type deadlineTransport struct {
+	next      http.RoundTripper
+	remaining time.Duration
+	hasLimit  bool
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *deadlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	deadline, ok := req.Context().Deadline()
+	t.hasLimit = ok
+	t.remaining = time.Until(deadline)
+	return t.next.RoundTrip(req)
+}
+
+func TestOperationTimeouts(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `[]`)
+	}))
+	defer srv.Close()
+
+	getAlerts := func(ctx context.Context, c *Client) error {
+		_, err := c.GetAllAlerts(ctx)
+		return err
+	}
+	getSilences := func(ctx context.Context, c *Client) error {
+		_, err := c.GetSilences(ctx)
+		return err
+	}
+
+	// The timeouts stay below the 30s default the OpenAPI runtime applies to every request
+	tests := []struct {
+		name             string
+		getAlertsTimeout time.Duration
+		silenceTimeout   time.Duration
+		callerTimeout    time.Duration
+		call             func(context.Context, *Client) error
+		wantDeadline     time.Duration
+	}{
+		{name: "alerts use the get alerts timeout", getAlertsTimeout: 20 * time.Second, silenceTimeout: 10 * time.Second, call: getAlerts, wantDeadline: 20 * time.Second},
+		{name: "silences use the silence timeout", getAlertsTimeout: 20 * time.Second, silenceTimeout: 10 * time.Second, call: getSilences, wantDeadline: 10 * time.Second},
+		{name: "caller deadline is kept", getAlertsTimeout: 5 * time.Second, callerTimeout: 15 * time.Second, call: getAlerts, wantDeadline: 15 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := &deadlineTransport{next: srv.Client().Transport}
+			client := NewClientWithConfig(ClientConfig{
+				Host:             strings.TrimPrefix(srv.URL, "http://"),
+				GetAlertsTimeout: tt.getAlertsTimeout,
+				SilenceTimeout:   tt.silenceTimeout,
+				HTTPClient:       &http.Client{Transport: transport},
+			})
+
+			ctx := context.Background()
+			if tt.callerTimeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.callerTimeout)
+				defer cancel()
+			}
+			if err := tt.call(ctx, client); err != nil {
+				t.Fatalf("call error = %v", err)
+			}
+
+			if !transport.hasLimit {
+				t.Fatalf("request had no deadline, want %v", tt.wantDeadline)
+			}
+			if transport.remaining > tt.wantDeadline || transport.remaining < tt.wantDeadline-time.Second {
+				t.Errorf("request deadline %v away, want about %v", transport.remaining, tt.wantDeadline)
+			}
+		})
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		want      string
+	}{
+		{name: "default", want: version.UserAgent()},
+		{name: "override", userAgent: "irm-sync/test", want: "irm-sync/test"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var userAgents []string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				userAgents = append(userAgents, r.Header.Get("User-Agent"))
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprint(w, `[]`)
+			}))
+			defer srv.Close()
+
+			client := NewClientWithConfig(ClientConfig{
+				Host:       strings.TrimPrefix(srv.URL, "http://"),
+				UserAgent:  tt.userAgent,
+				HTTPClient: srv.Client(),
+			})
+			if _, err := client.GetAllAlerts(context.Background()); err != nil {
+				t.Fatalf("GetAllAlerts() error = %v", err)
+			}
+			if len(userAgents) != 1 || userAgents[0] != tt.want {
+				t.Errorf("requests sent User-Agent %q, want %q", userAgents, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewClientWithConfigBasePath(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if r.URL.Path != "/alertmanager/api/v2/alerts" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `[]`)
+	}))
+	defer srv.Close()
+
+	for _, basePath := range []string{"/alertmanager", "alertmanager/", "/alertmanager/"} {
+		client := NewClientWithConfig(ClientConfig{
+			Host:       strings.TrimPrefix(srv.URL, "http://"),
+			BasePath:   basePath,
+			HTTPClient: srv.Client(),
+		})
+		if _, err := client.GetAllAlerts(context.Background()); err != nil {
+			t.Errorf("GetAllAlerts() with base path %q error = %v (requested %v)", basePath, err, paths)
+		}
+	}
+}
+
+func TestAPIBasePath(t *testing.T) {
+	tests := map[string]string{
+		"":              "/api/v2/",
+		"/":             "/api/v2/",
+		"/alertmanager": "/alertmanager/api/v2/",
+		"am/prod/":      "/am/prod/api/v2/",
+	}
+	for prefix, want := range tests {
+		if got := apiBasePath(prefix); got != want {
+			t.Errorf("apiBasePath(%q) = %q, want %q", prefix, got, want)
+		}
+	}
+}
+
+func TestRequestObserver(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v2/alerts":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `[]`)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `"boom"`)
+		}
+	}))
+
+	client := NewClientWithConfig(ClientConfig{Host: strings.TrimPrefix(srv.URL, "http://"), HTTPClient: srv.Client()})
+	var observed []string
+	client.SetRequestObserver(func(method, code string) {
+		observed = append(observed, method+" "+code)
+	})
+
+	if _, err := client.GetAllAlerts(context.Background()); err != nil {
+		t.Fatalf("GetAllAlerts() error = %v", err)
+	}
+	if err := client.Ping(context.Background()); err == nil {
+		t.Fatal("Ping() error = nil against a failing server")
+	}
+	srv.Close()
+	if _, err := client.GetAllAlerts(context.Background()); err == nil {
+		t.Fatal("GetAllAlerts() error = nil against a closed server")
+	}
+
+	want := []string{"GET 200", "GET 500", "GET error"}
+	if !slices.Equal(observed, want) {
+		t.Errorf("observed requests = %v, want %v", observed, want)
+	}
+}
+
+func TestSilenceObserver(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/api/v2/silences":
+			fmt.Fprint(w, `{"silenceID":"s1"}`)
+		case r.Method == http.MethodDelete && r.URL.Path == "/api/v2/silence/s1":
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `"boom"`)
+		}
+	}))
+	defer srv.Close()
+
+	client := NewClientWithConfig(ClientConfig{Host: strings.TrimPrefix(srv.URL, "http://"), HTTPClient: srv.Client()})
+	var observed []string
+	client.SetSilenceObserver(func(action string) {
+		observed = append(observed, action)
+	})
+
+	ctx := context.Background()
+	createdBy, comment := "oncall@example.com", "maintenance"
+	startsAt, endsAt := strfmt.DateTime(time.Now()), strfmt.DateTime(time.Now().Add(time.Hour))
+	isEqual, isRegex, name, value := true, false, "alertname", "DiskFull"
+	silence := &models.PostableSilence{Silence: models.Silence{
+		CreatedBy: &createdBy,
+		Comment:   &comment,
+		StartsAt:  &startsAt,
+		EndsAt:    &endsAt,
+		Matchers:  models.Matchers{{IsEqual: &isEqual, IsRegex: &isRegex, Name: &name, Value: &value}},
+	}}
+	if _, err := client.CreateSilence(ctx, silence); err != nil {
+		t.Fatalf("CreateSilence() error = %v", err)
+	}
+	if err := client.ExpireSilence(ctx, "s1"); err != nil {
+		t.Fatalf("ExpireSilence() error = %v", err)
+	}
+	if err := client.ExpireSilence(ctx, "s2"); err == nil {
+		t.Fatal("ExpireSilence() error = nil against a failing server")
+	}
+
+	want := []string{SilenceCreated, SilenceExpired}
+	if !slices.Equal(observed, want) {
+		t.Errorf("observed silence actions = %v, want %v; failed operations must not be counted", observed, want)
+	}
+}
+
+func TestFindSilencesByComment(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/silences" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `[
+			{"id":"s1","comment":"Silenced from Grafana IRM alert group IG1","createdBy":"irm","matchers":[],
+			 "startsAt":"2024-01-01T00:00:00Z","endsAt":"2024-01-01T01:00:00Z","updatedAt":"2024-01-01T00:00:00Z","status":{"state":"active"}},
+			{"id":"s2","comment":"maintenance window","createdBy":"ops","matchers":[],
+			 "startsAt":"2024-01-01T00:00:00Z","endsAt":"2024-01-01T01:00:00Z","updatedAt":"2024-01-01T00:00:00Z","status":{"state":"active"}},
+			{"id":"s3","createdBy":"ops","matchers":[],
+			 "startsAt":"2024-01-01T00:00:00Z","endsAt":"2024-01-01T01:00:00Z","updatedAt":"2024-01-01T00:00:00Z","status":{"state":"expired"}},
+			{"id":"s4","comment":"Silenced from Grafana IRM alert group IG2","createdBy":"irm","matchers":[],
+			 "startsAt":"2024-01-01T00:00:00Z","endsAt":"2024-01-01T01:00:00Z","updatedAt":"2024-01-01T00:00:00Z","status":{"state":"expired"}}
+		]`)
+	}))
+	defer srv.Close()
+	client := NewClientWithConfig(ClientConfig{Host: strings.TrimPrefix(srv.URL, "http://"), HTTPClient: srv.Client()})
+
+	tests := []struct {
+		substr string
+		want   []string
+	}{
+		{substr: "Grafana IRM", want: []string{"s1", "s4"}},
+		{substr: "alert group IG1", want: []string{"s1"}},
+		{substr: "no such comment", want: nil},
+	}
+	for _, tt := range tests {
+		silences, err := client.FindSilencesByComment(context.Background(), tt.substr)
+		if err != nil {
+			t.Fatalf("FindSilencesByComment(%q) error = %v", tt.substr, err)
+		}
+		var got []string
+		for _, s := range silences {
+			got = append(got, *s.ID)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("FindSilencesByComment(%q) = %v, want %v", tt.substr, got, tt.want)
+		}
+	}
+}
+
+// alertsJSON renders n alerts as an Alertmanager get alerts response
+func TestGetSilenceCoalescesConcurrentMisses(t *testing.T) {
+	var requests atomic.Int32
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		started <- struct{}{}
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"s1","comment":"maintenance","createdBy":"ops","matchers":[],
+			"startsAt":"2024-01-01T00:00:00Z","endsAt":"2024-01-01T01:00:00Z","updatedAt":"2024-01-01T00:00:00Z","status":{"state":"active"}}`)
+	}))
+	defer srv.Close()
+	client := NewClientWithConfig(ClientConfig{Host: strings.TrimPrefix(srv.URL, "http://"), HTTPClient: srv.Client()})
+
+	// The first lookup starts the fetch and is then cancelled, which must not fail the others
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := client.GetSilence(leaderCtx, "s1")
+		leaderErr <- err
+	}()
+	<-started
+
+	const lookups = 20
+	errs := make(chan error, lookups)
+	for range lookups {
+		go func() {
+			silence, err := client.GetSilence(context.Background(), "s1")
+			if err == nil && *silence.ID != "s1" {
+				err = fmt.Errorf("got silence %s", *silence.ID)
+			}
+			errs <- err
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	cancelLeader()
+	if err := <-leaderErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled GetSilence() error = %v, want context.Canceled", err)
+	}
+	close(release)
+
+	for range lookups {
+		if err := <-errs; err != nil {
+			t.Errorf("GetSilence() error = %v", err)
+		}
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("%d concurrent lookups made %d requests, want 1", lookups+1, got)
+	}
+}
+
+func TestCreateSilenceErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		body        string
+		wantInvalid bool
+	}{
+		{name: "rejected silence", status: http.StatusBadRequest, body: `"silence invalid: end time can't be in the past"`, wantInvalid: true},
+		{name: "server error", status: http.StatusInternalServerError, body: `"failed to create silence"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			}))
+			defer srv.Close()
+			client := NewClientWithConfig(ClientConfig{Host: strings.TrimPrefix(srv.URL, "http://"), HTTPClient: srv.Client()})
+
+			comment := "maintenance"
+			_, err := client.CreateSilence(context.Background(), &models.PostableSilence{Silence: models.Silence{Comment: &comment}})
+			if err == nil {
+				t.Fatal("CreateSilence() error = nil, want a failure")
+			}
+			if got := errors.Is(err, ErrInvalidSilence); got != tt.wantInvalid {
+				t.Errorf("errors.Is(%v, ErrInvalidSilence) = %v, want %v", err, got, tt.wantInvalid)
+			}
+			if tt.wantInvalid && !strings.Contains(err.Error(), "end time can't be in the past") {
+				t.Errorf("CreateSilence() error = %v, want Alertmanager's reason", err)
+			}
+		})
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	transport := &countingTransport{next: http.DefaultTransport}
+	client := NewClientWithConfig(ClientConfig{
+		Host:       "127.0.0.1:1",
+		ReadOnly:   true,
+		HTTPClient: &http.Client{Transport: transport},
+	})
+
+	ctx := context.Background()
+	comment := "maintenance"
+	if _, err := client.CreateSilence(ctx, &models.PostableSilence{Silence: models.Silence{Comment: &comment}}); !errors.Is(err, config.ErrReadOnly) {
+		t.Errorf("CreateSilence() error = %v, want config.ErrReadOnly", err)
+	}
+	if err := client.ExpireSilence(ctx, "s1"); !errors.Is(err, config.ErrReadOnly) {
+		t.Errorf("ExpireSilence() error = %v, want config.ErrReadOnly", err)
+	}
+	if got := transport.requests.Load(); got != 0 {
+		t.Errorf("read-only client made %d requests, want none", got)
+	}
+}
+
+func alertsJSON(n int) string {
+	alerts := make([]string, n)
+	for i := range alerts {
+		alerts[i] = fmt.Sprintf(`{"labels":{"alertname":"Alert%d"},"annotations":{},"fingerprint":"fp%d",`+
+			`"receivers":[{"name":"default"}],"startsAt":"2026-01-01T00:00:00Z","endsAt":"2026-01-01T01:00:00Z",`+
+			`"updatedAt":"2026-01-01T00:00:00Z","status":{"state":"active","silencedBy":[],"inhibitedBy":[]}}`, i, i)
+	}
+	return "[" + strings.Join(alerts, ",") + "]"
+}
+
+func TestGetAllAlertsCap(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		maxAlerts   int
+		wantAlerts  int
+		wantDropped int
+	}{
+		{name: "no cap", body: alertsJSON(5), maxAlerts: 0, wantAlerts: 5},
+		{name: "below the cap", body: alertsJSON(3), maxAlerts: 5, wantAlerts: 3},
+		{name: "exactly the cap", body: alertsJSON(5), maxAlerts: 5, wantAlerts: 5},
+		{name: "above the cap", body: alertsJSON(8), maxAlerts: 5, wantAlerts: 5, wantDropped: 3},
+		{name: "large payload", body: alertsJSON(50000), maxAlerts: 100, wantAlerts: 100, wantDropped: 49900},
+		{name: "empty list", body: "[]", maxAlerts: 5, wantAlerts: 0},
+		{name: "null payload", body: "null", maxAlerts: 5, wantAlerts: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/v2/alerts" {
+					http.NotFound(w, r)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprint(w, tt.body)
+			}))
+			defer srv.Close()
+
+			client := NewClientWithConfig(ClientConfig{
+				Host:       strings.TrimPrefix(srv.URL, "http://"),
+				MaxAlerts:  tt.maxAlerts,
+				HTTPClient: srv.Client(),
+			})
+			dropped := 0
+			client.SetTruncationObserver(func(n int) { dropped += n })
+
+			alerts, err := client.GetAllAlerts(context.Background())
+			if err != nil {
+				t.Fatalf("GetAllAlerts() error = %v", err)
+			}
+			if len(alerts) != tt.wantAlerts {
+				t.Errorf("GetAllAlerts() returned %d alerts, want %d", len(alerts), tt.wantAlerts)
+			}
+			if tt.maxAlerts > 0 && cap(alerts) > tt.maxAlerts {
+				t.Errorf("GetAllAlerts() kept capacity for %d alerts, want at most %d", cap(alerts), tt.maxAlerts)
+			}
+			for i, alert := range alerts {
+				if want := fmt.Sprintf("fp%d", i); alert.Fingerprint == nil || *alert.Fingerprint != want {
+					t.Errorf("alert %d has fingerprint %v, want %s", i, alert.Fingerprint, want)
+				}
+			}
+			if dropped != tt.wantDropped {
+				t.Errorf("truncation observer saw %d dropped alerts, want %d", dropped, tt.wantDropped)
+			}
+		})
+	}
+}
+
+func TestGetAllAlertsCapErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+	}{
+		{name: "server error", status: http.StatusInternalServerError, body: `"boom"`},
+		{name: "bad request", status: http.StatusBadRequest, body: `"bad filter"`},
+		{name: "not an array", status: http.StatusOK, body: `{"alerts":[]}`},
+		{name: "malformed alert", status: http.StatusOK, body: `[{"labels":`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			}))
+			defer srv.Close()
+
+			client := NewClientWithConfig(ClientConfig{
+				Host:       strings.TrimPrefix(srv.URL, "http://"),
+				MaxAlerts:  5,
+				HTTPClient: srv.Client(),
+			})
+			if _, err := client.GetAllAlerts(context.Background()); err == nil {
+				t.Error("GetAllAlerts() returned no error")
+			}
+		})
+	}
+}
+
+func TestGetAlertsFiltered(t *testing.T) {
+	var query url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `[]`)
+	}))
+	defer srv.Close()
+	client := NewClientWithConfig(ClientConfig{Host: strings.TrimPrefix(srv.URL, "http://"), HTTPClient: srv.Client()})
+
+	silenced := false
+	filter := AlertFilter{Matchers: []string{`team="payments"`, `severity=~"critical|warning"`}, Receiver: "oncall", Silenced: &silenced}
+	if _, err := client.GetAlertsFiltered(context.Background(), filter); err != nil {
+		t.Fatalf("GetAlertsFiltered() error = %v", err)
+	}
+
+	if got := query["filter"]; !slices.Equal(got, filter.Matchers) {
+		t.Errorf("filter query = %v, want %v", got, filter.Matchers)
+	}
+	if query.Get("receiver") != "oncall" || query.Get("silenced") != "false" {
+		t.Errorf("receiver, silenced query = %q, %q, want oncall and false", query.Get("receiver"), query.Get("silenced"))
+	}
+	if query.Has("active") || query.Has("inhibited") {
+		t.Errorf("unset state flags were sent: %v", query)
+	}
+}
+
+func TestToolSilenceAlertGroupID(t *testing.T) {
+	tests := []struct {
+		name    string
+		comment string
+		want    string
+		wantOK  bool
+	}{
+		{name: "tool silence", comment: ToolSilenceCommentPrefix + " DiskFull - https://grafana.example.com (ID: IG1)", want: "IG1", wantOK: true},
+		{name: "title with parentheses", comment: ToolSilenceCommentPrefix + " Disk (root) full - https://grafana.example.com (ID: IG2)", want: "IG2", wantOK: true},
+		{name: "manual silence", comment: "maintenance (ID: IG1)"},
+		{name: "no alert group ID", comment: ToolSilenceCommentPrefix + " DiskFull - https://grafana.example.com"},
+		{name: "empty alert group ID", comment: ToolSilenceCommentPrefix + " DiskFull (ID: )"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ToolSilenceAlertGroupID(tt.comment)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("ToolSilenceAlertGroupID(%q) = %q, %v, want %q, %v", tt.comment, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
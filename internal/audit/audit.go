@@ -0,0 +1,101 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/logging"
+)
+
+// Audited actions
+const (
+	ActionResolveAlertGroup   = "resolve_alert_group"
+	ActionUnsilenceAlertGroup = "unsilence_alert_group"
+	ActionCreateSilence       = "create_silence"
+	ActionExpireSilence       = "expire_silence"
+)
+
+// SystemActor is the actor recorded for actions taken by the reconciler itself
+const SystemActor = "alertmanager-alert-sync"
+
+// Event describes an automated action taken against Alertmanager or Grafana IRM
+type Event struct {
+	Action string
+	// Actor is the user on whose behalf the action was taken, or SystemActor
+	Actor        string
+	Reason       string
+	AlertGroupID string
+	Fingerprint  string
+	SilenceID    string
+	// Err is the error returned by the action, nil if it succeeded
+	Err error
+}
+
+var (
+	mu     sync.Mutex
+	logger = newLogger(os.Stderr)
+	file   *os.File
+)
+
+// newLogger builds the JSON audit logger writing to w
+func newLogger(w io.Writer) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, nil)).With("log", "audit")
+}
+
+// Configure sends audit records to the file at path (appending), or to stderr when path is empty
+func Configure(path string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if path == "" {
+		logger = newLogger(os.Stderr)
+		return nil
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return fmt.Errorf("opening audit log file: %w", err)
+	}
+	if file != nil {
+		file.Close()
+	}
+	file = f
+	logger = newLogger(f)
+	return nil
+}
+
+// Record writes an audit record for the event, tagged with the correlation ID from ctx
+func Record(ctx context.Context, event Event) {
+	attrs := []any{
+		"action", event.Action,
+		"actor", event.Actor,
+		"correlation_id", logging.ID(ctx),
+	}
+	if event.Reason != "" {
+		attrs = append(attrs, "reason", event.Reason)
+	}
+	if event.AlertGroupID != "" {
+		attrs = append(attrs, "alert_group_id", event.AlertGroupID)
+	}
+	if event.Fingerprint != "" {
+		attrs = append(attrs, "fingerprint", event.Fingerprint)
+	}
+	if event.SilenceID != "" {
+		attrs = append(attrs, "silence_id", event.SilenceID)
+	}
+
+	outcome := "success"
+	if event.Err != nil {
+		outcome = "failure"
+		attrs = append(attrs, "error", event.Err.Error())
+	}
+	attrs = append(attrs, "outcome", outcome)
+
+	mu.Lock()
+	defer mu.Unlock()
+	logger.InfoContext(ctx, "audit", attrs...)
+}
@@ -0,0 +1,126 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/logging"
+)
+
+func TestRecord(t *testing.T) {
+	tests := []struct {
+		name  string
+		event Event
+		want  map[string]any
+	}{
+		{
+			name: "successful resolution",
+			event: Event{
+				Action:       ActionResolveAlertGroup,
+				Actor:        SystemActor,
+				Reason:       "alert silenced in Alertmanager",
+				AlertGroupID: "IG1",
+				Fingerprint:  "fp1",
+			},
+			want: map[string]any{
+				"action":         ActionResolveAlertGroup,
+				"actor":          SystemActor,
+				"correlation_id": "abcd1234",
+				"reason":         "alert silenced in Alertmanager",
+				"alert_group_id": "IG1",
+				"fingerprint":    "fp1",
+				"outcome":        "success",
+			},
+		},
+		{
+			name: "failed silence creation omits empty fields",
+			event: Event{
+				Action: ActionCreateSilence,
+				Actor:  "oncall@example.com",
+				Err:    errors.New("alertmanager unavailable"),
+			},
+			want: map[string]any{
+				"action":         ActionCreateSilence,
+				"actor":          "oncall@example.com",
+				"correlation_id": "abcd1234",
+				"error":          "alertmanager unavailable",
+				"outcome":        "failure",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			setLogger(t, newLogger(&buf))
+
+			Record(logging.WithID(context.Background(), "abcd1234"), tt.event)
+
+			var record map[string]any
+			if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+				t.Fatalf("audit record %q is not JSON: %v", buf.String(), err)
+			}
+			if record["msg"] != "audit" || record["log"] != "audit" {
+				t.Errorf("audit record msg, log = %v, %v, want audit, audit", record["msg"], record["log"])
+			}
+			for _, key := range []string{"time", "level", "msg", "log"} {
+				delete(record, key)
+			}
+			if !reflect.DeepEqual(record, tt.want) {
+				t.Errorf("audit record = %v, want %v", record, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigureAppendsToFile(t *testing.T) {
+	setLogger(t, logger)
+	path := filepath.Join(t.TempDir(), "audit.log")
+	if err := os.WriteFile(path, []byte("{}\n"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Configure(path); err != nil {
+		t.Fatalf("Configure() error = %v", err)
+	}
+	Record(context.Background(), Event{Action: ActionCreateSilence, Actor: "oncall@example.com", SilenceID: "s1"})
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[1], `"silence_id":"s1"`) {
+		t.Errorf("audit log = %q, want the existing line followed by the create_silence record", data)
+	}
+
+	if err := Configure(filepath.Join(t.TempDir(), "missing", "audit.log")); err == nil {
+		t.Error("Configure() with a missing directory succeeded, want an error")
+	}
+}
+
+// setLogger replaces the audit logger for the duration of the test, restoring the previous one afterwards
+func setLogger(t *testing.T, l *slog.Logger) {
+	t.Helper()
+	mu.Lock()
+	previousLogger, previousFile := logger, file
+	logger = l
+	mu.Unlock()
+
+	t.Cleanup(func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if file != nil && file != previousFile {
+			file.Close()
+		}
+		logger, file = previousLogger, previousFile
+	})
+}
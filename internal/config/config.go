@@ -0,0 +1,799 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/prometheus/alertmanager/pkg/labels"
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrReadOnly is returned by the API clients instead of modifying a backend when READ_ONLY is set
+var ErrReadOnly = errors.New("read-only mode, backend modifications are disabled")
+
+// Config holds the complete service configuration
+// Values are loaded from the optional YAML file referenced by CONFIG_FILE,
+// then overridden by any environment variables that are set
+type Config struct {
+	Alertmanager AlertmanagerConfig `yaml:"alertmanager"`
+	Grafana      GrafanaConfig      `yaml:"grafana"`
+	Metrics      MetricsConfig      `yaml:"metrics"`
+	Reconcile    ReconcileConfig    `yaml:"reconcile"`
+	Webhook      WebhookConfig      `yaml:"webhook"`
+	Server       ServerConfig       `yaml:"server"`
+	Audit        AuditConfig        `yaml:"audit"`
+	Tenant       TenantConfig       `yaml:"tenant"`
+}
+
+// AlertmanagerConfig holds the Alertmanager client settings
+type AlertmanagerConfig struct {
+	Host string `yaml:"host"`
+	// BasePath is the path prefix Alertmanager is served under, empty when served at the root
+	BasePath string `yaml:"base_path"`
+	// AlertFilter lists label matchers (e.g. team="payments") narrowing the alerts fetched from Alertmanager
+	AlertFilter []string `yaml:"alert_filter"`
+	// MaxAlerts caps the number of alerts processed per fetch (0 = no cap)
+	MaxAlerts int `yaml:"max_alerts"`
+	// UserAgent overrides the default alertmanager-alert-sync/<version> User-Agent
+	UserAgent string `yaml:"user_agent"`
+	// GetAlertsTimeout and SilenceTimeout bound alert fetches and silence operations
+	// when the caller's context has no deadline (0 = no timeout)
+	GetAlertsTimeout time.Duration `yaml:"get_alerts_timeout"`
+	SilenceTimeout   time.Duration `yaml:"silence_timeout"`
+	// ReadOnly makes the client refuse to create or expire silences
+	ReadOnly bool `yaml:"read_only"`
+}
+
+// GrafanaConfig holds the Grafana IRM client settings
+type GrafanaConfig struct {
+	URL   string `yaml:"url"`
+	Token string `yaml:"token"`
+	// AuthScheme prefixes the token in the Authorization header (e.g. Bearer), empty sends the raw token
+	AuthScheme string `yaml:"auth_scheme"`
+	// RateLimit is the maximum number of Grafana IRM requests per second (0 disables rate limiting)
+	RateLimit float64 `yaml:"rate_limit"`
+	RateBurst int     `yaml:"rate_burst"`
+	// AlertGroupCacheTTL is how long alert group listings are reused between fetches (0 disables caching)
+	AlertGroupCacheTTL time.Duration `yaml:"alert_group_cache_ttl"`
+	// UserAgent overrides the default alertmanager-alert-sync/<version> User-Agent
+	UserAgent string `yaml:"user_agent"`
+	// ReadOnly makes the client refuse every request that would modify alert groups
+	ReadOnly bool `yaml:"read_only"`
+}
+
+// MetricsConfig holds the alert metrics export settings
+type MetricsConfig struct {
+	AlertLabels      []string `yaml:"alert_labels"`
+	AlertAnnotations []string `yaml:"alert_annotations"`
+	// PrimaryLabel is the alert label identifying an alert in metrics and reconciliation
+	PrimaryLabel string `yaml:"primary_label"`
+	// DefaultLabels selects the default alert state labels to export (empty exports all of them)
+	DefaultLabels []string `yaml:"default_labels"`
+	// SilenceCommentLabel adds the silence_comment label, truncated to SilenceCommentMaxLength characters
+	SilenceCommentLabel     bool `yaml:"silence_comment_label"`
+	SilenceCommentMaxLength int  `yaml:"silence_comment_max_length"`
+	// MaxLabelValueLength truncates every alert metric label value to this many characters
+	MaxLabelValueLength int `yaml:"max_label_value_length"`
+	// AlertGroupState exports the number of active alerts per Grafana IRM alert group
+	AlertGroupState bool `yaml:"alert_group_state"`
+	// Fields maps extra metric labels to the sources tried in order for their value,
+	// each as label:<name> or annotation:<name> (set through FIELD_<label> variables)
+	Fields map[string][]string `yaml:"fields"`
+	// MetricPrefix starts the name of every exported metric
+	MetricPrefix string `yaml:"metric_prefix"`
+	// ExportFilter is an Alertmanager matcher expression selecting which alerts are exported as metrics
+	ExportFilter string `yaml:"export_filter"`
+}
+
+// ReconcileConfig holds the reconciliation loop settings
+type ReconcileConfig struct {
+	// Interval and Timeout are expressed in seconds
+	Interval int `yaml:"interval"`
+	Timeout  int `yaml:"timeout"`
+	// Jitter delays the first cycle and each following one by a random duration up to this value
+	Jitter        time.Duration `yaml:"jitter"`
+	MatchStrategy string        `yaml:"match_strategy"`
+	// Mode is export_only (metrics only), resolve (resolution only) or both
+	Mode        string `yaml:"mode"`
+	IgnoreLabel string `yaml:"ignore_label"`
+	// CircuitBreakerThreshold consecutive Grafana failures open the circuit for CircuitBreakerCooldown seconds
+	CircuitBreakerThreshold int `yaml:"circuit_breaker_threshold"`
+	CircuitBreakerCooldown  int `yaml:"circuit_breaker_cooldown"`
+	// ResolveGracePeriod is how long an alert must be silenced before it is resolved in Grafana IRM
+	ResolveGracePeriod time.Duration `yaml:"resolve_grace_period"`
+	// ResolveMinSeverity restricts resolution to alerts whose severity label is at least this
+	// (info < warning < error < critical); empty resolves every severity
+	ResolveMinSeverity string `yaml:"resolve_min_severity"`
+	// ResolveAddNote adds a resolution note, rendered from ResolveNoteTemplate, to resolved alert groups
+	ResolveAddNote      bool   `yaml:"resolve_add_note"`
+	ResolveNoteTemplate string `yaml:"resolve_note_template"`
+	// GrafanaActiveStates lists the Grafana IRM alert group states eligible for resolution
+	// (empty defaults to firing only; firing is an alias of IRM's new state)
+	GrafanaActiveStates []string `yaml:"grafana_active_states"`
+	// ManagedIntegrations lists the Grafana IRM integration IDs reconciled (empty reconciles all of them)
+	ManagedIntegrations []string `yaml:"managed_integrations"`
+	// ProtectedAlertnames lists alertnames never resolved automatically, even while silenced
+	ProtectedAlertnames []string `yaml:"protected_alertnames"`
+	// ExpireOrphanedSilences expires the silences created by this tool whose alert group is resolved or gone
+	ExpireOrphanedSilences bool `yaml:"expire_orphaned_silences"`
+}
+
+// WebhookConfig holds the Grafana IRM webhook settings
+type WebhookConfig struct {
+	Username       string   `yaml:"username"`
+	Password       string   `yaml:"password"`
+	EmailAllowlist []string `yaml:"email_allowlist"`
+	// Credentials lists extra accepted basic auth credentials as user:pass, e.g. one per sender or during rotation
+	Credentials []string `yaml:"credentials"`
+	// DomainAllowlist allows every email address of the listed domains
+	DomainAllowlist []string `yaml:"domain_allowlist"`
+	// AllowlistFile is an optional file (one email or *@domain per line) reloaded when it changes
+	AllowlistFile string `yaml:"allowlist_file"`
+	// AllowlistReloadInterval is how often the allowlist file is checked for changes, in seconds
+	AllowlistReloadInterval int `yaml:"allowlist_reload_interval"`
+	// SilenceMode is per_alert (one silence per alert) or grouped (one silence from the common labels)
+	SilenceMode string `yaml:"silence_mode"`
+	// DefaultSilenceDuration is applied to silence events without an until time (0 ignores them)
+	DefaultSilenceDuration time.Duration `yaml:"default_silence_duration"`
+	// MinSilenceDuration extends silences ending sooner than this (0 disables the minimum)
+	MinSilenceDuration time.Duration `yaml:"min_silence_duration"`
+	// RegexMatchLabels lists labels matched by regex in created silences, as name=pattern or
+	// just name to derive a prefix pattern from the alert's value
+	RegexMatchLabels []string `yaml:"regex_match_labels"`
+	// ExtraMatchers lists name=value matchers added to every created silence
+	ExtraMatchers []string `yaml:"extra_matchers"`
+	// AuthorTemplate renders the author of created silences from the webhook user (ID, Username, Email)
+	// The user's email is used when it is empty or fails to render
+	AuthorTemplate string `yaml:"author_template"`
+	// MaxBodyBytes limits the size of webhook request bodies
+	MaxBodyBytes int `yaml:"max_body_bytes"`
+	// ExpireOnResolve expires the silences created for an alert group when it is resolved in Grafana IRM
+	ExpireOnResolve bool `yaml:"expire_on_resolve"`
+}
+
+// ServerConfig holds the HTTP server settings
+type ServerConfig struct {
+	Port string `yaml:"port"`
+	// EnablePprof exposes the /debug/pprof/ profiling endpoints (off by default)
+	EnablePprof bool `yaml:"enable_pprof"`
+	// MetricsAuthToken protects /metrics, /export and /inconsistencies with a bearer token (open when empty)
+	MetricsAuthToken string `yaml:"metrics_auth_token"`
+	// ShutdownTimeout bounds how long shutdown waits for in-flight requests and the current reconciliation cycle
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// TLSCertFile and TLSKeyFile serve HTTPS when both are set (HTTP otherwise)
+	TLSCertFile string `yaml:"tls_cert_file"`
+	TLSKeyFile  string `yaml:"tls_key_file"`
+}
+
+// AuditConfig holds the audit log settings
+type AuditConfig struct {
+	// File receives the JSON audit records (appended); empty writes them to stderr
+	File string `yaml:"file"`
+}
+
+// TenantConfig scopes exported metrics and reconciliation to the alerts of a single tenant
+type TenantConfig struct {
+	// Label and Value select the tenant's alerts; alerts without the label are excluded (unscoped when empty)
+	Label string `yaml:"label"`
+	Value string `yaml:"value"`
+}
+
+// Load builds the configuration from the CONFIG_FILE YAML file (if set) and environment variables
+// Environment variables take precedence over values from the file
+func Load() (*Config, error) {
+	cfg := &Config{}
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+		log.Printf("Loaded configuration file: %s", path)
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+
+	cfg.applyDefaults()
+	return cfg, nil
+}
+
+// Validate checks the configuration for invalid values and inconsistent combinations
+// Every problem found is reported in the returned error, one per line
+func (c *Config) Validate() error {
+	errs := c.validateBackends()
+	grafanaConfigured := c.grafanaConfigured()
+
+	errs = append(errs, c.validateMetricLabels()...)
+	for field, sources := range c.Metrics.Fields {
+		for _, source := range sources {
+			kind, name, found := strings.Cut(source, ":")
+			if !found || name == "" || (kind != "label" && kind != "annotation") {
+				errs = append(errs, fmt.Errorf("%s%s sources must be label:<name> or annotation:<name>, got '%s'", fieldEnvPrefix, field, source))
+			}
+		}
+	}
+
+	if !model.IsValidLegacyMetricName(c.Metrics.MetricPrefix) {
+		errs = append(errs, fmt.Errorf("METRIC_PREFIX must be a valid metric name prefix ([a-zA-Z_:][a-zA-Z0-9_:]*), got '%s'", c.Metrics.MetricPrefix))
+	}
+	if c.Metrics.ExportFilter != "" {
+		if _, err := labels.ParseMatchers(c.Metrics.ExportFilter); err != nil {
+			errs = append(errs, fmt.Errorf("EXPORT_FILTER is not a valid matcher expression: %w", err))
+		}
+	}
+
+	if (c.Tenant.Label == "") != (c.Tenant.Value == "") {
+		errs = append(errs, errors.New("TENANT_LABEL and TENANT_VALUE must be set together"))
+	}
+
+	if c.Reconcile.Interval < 0 {
+		errs = append(errs, fmt.Errorf("RECONCILE_INTERVAL must be a positive integer (seconds), got %d", c.Reconcile.Interval))
+	}
+	if c.Reconcile.Timeout < 0 {
+		errs = append(errs, fmt.Errorf("RECONCILE_TIMEOUT must be a positive integer (seconds), got %d", c.Reconcile.Timeout))
+	}
+	if c.Reconcile.Interval > 0 && !grafanaConfigured {
+		errs = append(errs, errors.New("RECONCILE_INTERVAL requires GRAFANA_IRM_URL and GRAFANA_IRM_TOKEN"))
+	}
+	switch c.Reconcile.MatchStrategy {
+	case "", "fingerprint", "labels", "both":
+	default:
+		errs = append(errs, fmt.Errorf("MATCH_STRATEGY must be fingerprint, labels or both, got '%s'", c.Reconcile.MatchStrategy))
+	}
+	switch c.Reconcile.Mode {
+	case "", "export_only", "resolve", "both":
+	default:
+		errs = append(errs, fmt.Errorf("RECONCILE_MODE must be export_only, resolve or both, got '%s'", c.Reconcile.Mode))
+	}
+	if c.Reconcile.IgnoreLabel != "" {
+		if name, _, found := strings.Cut(c.Reconcile.IgnoreLabel, "="); !found || strings.TrimSpace(name) == "" {
+			errs = append(errs, fmt.Errorf("RECONCILE_IGNORE_LABEL must be in the form name=value, got '%s'", c.Reconcile.IgnoreLabel))
+		}
+	}
+	for _, state := range c.Reconcile.GrafanaActiveStates {
+		switch strings.ToLower(state) {
+		case "firing", "new", "acknowledged", "silenced":
+		default:
+			errs = append(errs, fmt.Errorf("GRAFANA_ACTIVE_STATES entries must be firing, new, acknowledged or silenced, got '%s'", state))
+		}
+	}
+	if c.Reconcile.Jitter < 0 {
+		errs = append(errs, fmt.Errorf("RECONCILE_JITTER must not be negative, got %v", c.Reconcile.Jitter))
+	}
+	if c.Reconcile.ResolveGracePeriod < 0 {
+		errs = append(errs, fmt.Errorf("RESOLVE_GRACE_PERIOD must not be negative, got %v", c.Reconcile.ResolveGracePeriod))
+	}
+
+	switch strings.ToLower(c.Reconcile.ResolveMinSeverity) {
+	case "", "info", "warning", "error", "critical":
+	default:
+		errs = append(errs, fmt.Errorf("RESOLVE_MIN_SEVERITY must be info, warning, error or critical, got '%s'", c.Reconcile.ResolveMinSeverity))
+	}
+
+	// The webhook handler is enabled together with the Grafana IRM integration
+	webhookPairSet := c.Webhook.Username != "" || c.Webhook.Password != ""
+	if webhookPairSet && (c.Webhook.Username == "" || c.Webhook.Password == "") {
+		errs = append(errs, errors.New("WEBHOOK_USERNAME and WEBHOOK_PASSWORD must be set together"))
+	}
+	if grafanaConfigured && !webhookPairSet && len(c.Webhook.Credentials) == 0 {
+		errs = append(errs, errors.New("WEBHOOK_USERNAME and WEBHOOK_PASSWORD or WEBHOOK_CREDENTIALS must be set when Grafana IRM is configured"))
+	}
+	for _, credential := range c.Webhook.Credentials {
+		// The entry itself is not reported as it may hold a password
+		if username, password, found := strings.Cut(credential, ":"); !found || username == "" || password == "" {
+			errs = append(errs, errors.New("WEBHOOK_CREDENTIALS entries must be in the form user:pass"))
+		}
+	}
+	switch c.Webhook.SilenceMode {
+	case "", "per_alert", "grouped":
+	default:
+		errs = append(errs, fmt.Errorf("WEBHOOK_SILENCE_MODE must be per_alert or grouped, got '%s'", c.Webhook.SilenceMode))
+	}
+	for _, matcher := range c.Webhook.ExtraMatchers {
+		if name, _, found := strings.Cut(matcher, "="); !found || strings.TrimSpace(name) == "" {
+			errs = append(errs, fmt.Errorf("WEBHOOK_EXTRA_MATCHERS entries must be in the form name=value, got '%s'", matcher))
+		}
+	}
+	if c.Reconcile.ResolveNoteTemplate != "" {
+		if _, err := template.New("resolution_note").Parse(c.Reconcile.ResolveNoteTemplate); err != nil {
+			errs = append(errs, fmt.Errorf("RESOLVE_NOTE_TEMPLATE is not a valid template: %w", err))
+		}
+	}
+	if c.Webhook.AuthorTemplate != "" {
+		if _, err := template.New("author").Parse(c.Webhook.AuthorTemplate); err != nil {
+			errs = append(errs, fmt.Errorf("WEBHOOK_AUTHOR_TEMPLATE is not a valid template: %w", err))
+		}
+	}
+	if c.Webhook.DefaultSilenceDuration < 0 {
+		errs = append(errs, fmt.Errorf("WEBHOOK_DEFAULT_SILENCE_DURATION must not be negative, got %v", c.Webhook.DefaultSilenceDuration))
+	}
+	if c.Webhook.MinSilenceDuration < 0 {
+		errs = append(errs, fmt.Errorf("WEBHOOK_MIN_SILENCE_DURATION must not be negative, got %v", c.Webhook.MinSilenceDuration))
+	}
+
+	if (c.Server.TLSCertFile == "") != (c.Server.TLSKeyFile == "") {
+		errs = append(errs, errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together"))
+	}
+	if port, err := strconv.Atoi(c.Server.Port); err != nil || port <= 0 || port > 65535 {
+		errs = append(errs, fmt.Errorf("PORT must be a valid port number, got '%s'", c.Server.Port))
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateMetricLabels checks the names of the alert state metric labels built from the configuration
+// Invalid, duplicated or clashing names would make registering the metric panic at startup
+func (c *Config) validateMetricLabels() []error {
+	var errs []error
+
+	builtin := make(map[string]bool, len(DefaultAlertLabels)+1)
+	for _, label := range DefaultAlertLabels {
+		builtin[label] = true
+	}
+	builtin[SilenceCommentLabelName] = true
+
+	primary := c.Metrics.PrimaryLabel
+	if !validLabelName(primary) {
+		errs = append(errs, fmt.Errorf("PRIMARY_LABEL must be a valid label name, got '%s'", primary))
+	} else if builtin[primary] {
+		errs = append(errs, fmt.Errorf("PRIMARY_LABEL must not be a built-in metric label, got '%s'", primary))
+	}
+
+	// The primary label may be listed again, it is only exported once
+	exported := map[string]bool{primary: true}
+	for _, label := range c.Metrics.AlertLabels {
+		switch {
+		case label == primary:
+		case !validLabelName(label):
+			errs = append(errs, fmt.Errorf("ALERTMANAGER_ALERTS_LABELS entries must be valid label names, got '%s'", label))
+		case builtin[label]:
+			errs = append(errs, fmt.Errorf("ALERTMANAGER_ALERTS_LABELS entry '%s' clashes with a built-in metric label", label))
+		case exported[label]:
+			errs = append(errs, fmt.Errorf("ALERTMANAGER_ALERTS_LABELS lists '%s' more than once", label))
+		}
+		exported[label] = true
+	}
+
+	// Annotations clashing with a label are exported with a prefix, so only their names are checked
+	annotations := make(map[string]bool, len(c.Metrics.AlertAnnotations))
+	for _, annotation := range c.Metrics.AlertAnnotations {
+		switch {
+		case !validLabelName(annotation):
+			errs = append(errs, fmt.Errorf("ALERTMANAGER_ALERTS_ANNOTATIONS entries must be valid label names, got '%s'", annotation))
+		case annotations[annotation]:
+			errs = append(errs, fmt.Errorf("ALERTMANAGER_ALERTS_ANNOTATIONS lists '%s' more than once", annotation))
+		}
+		annotations[annotation] = true
+	}
+
+	for _, field := range slices.Sorted(maps.Keys(c.Metrics.Fields)) {
+		switch {
+		case !validLabelName(field):
+			errs = append(errs, fmt.Errorf("%s%s does not name a valid label", fieldEnvPrefix, field))
+		case builtin[field] || exported[field]:
+			errs = append(errs, fmt.Errorf("%s%s clashes with another metric label", fieldEnvPrefix, field))
+		}
+	}
+
+	return errs
+}
+
+// validLabelName reports whether name can be used as a Prometheus label name
+// Names starting with __ are reserved for Prometheus' internal use
+func validLabelName(name string) bool {
+	return model.LabelName(name).IsValid() && !strings.HasPrefix(name, "__")
+}
+
+// ValidateBackends checks only the Alertmanager and Grafana IRM connection settings
+// It suits the -check mode, which connects to the backends without serving webhooks or reconciling
+func (c *Config) ValidateBackends() error {
+	return errors.Join(c.validateBackends()...)
+}
+
+// validateBackends returns the problems found in the Alertmanager and Grafana IRM connection settings
+func (c *Config) validateBackends() []error {
+	var errs []error
+
+	if c.Alertmanager.MaxAlerts < 0 {
+		errs = append(errs, fmt.Errorf("ALERTMANAGER_MAX_ALERTS must not be negative, got %d", c.Alertmanager.MaxAlerts))
+	}
+	if c.Alertmanager.GetAlertsTimeout < 0 {
+		errs = append(errs, fmt.Errorf("ALERTMANAGER_GETALERTS_TIMEOUT must not be negative, got %v", c.Alertmanager.GetAlertsTimeout))
+	}
+	if c.Alertmanager.SilenceTimeout < 0 {
+		errs = append(errs, fmt.Errorf("ALERTMANAGER_SILENCE_TIMEOUT must not be negative, got %v", c.Alertmanager.SilenceTimeout))
+	}
+
+	if c.grafanaConfigured() && (c.Grafana.URL == "" || c.Grafana.Token == "") {
+		errs = append(errs, errors.New("GRAFANA_IRM_URL and GRAFANA_IRM_TOKEN must be set together"))
+	}
+	if c.Grafana.RateLimit < 0 {
+		errs = append(errs, fmt.Errorf("GRAFANA_RATE_LIMIT must not be negative, got %g", c.Grafana.RateLimit))
+	}
+	if c.Grafana.RateBurst < 0 {
+		errs = append(errs, fmt.Errorf("GRAFANA_RATE_BURST must not be negative, got %d", c.Grafana.RateBurst))
+	}
+	if c.Grafana.AlertGroupCacheTTL < 0 {
+		errs = append(errs, fmt.Errorf("GRAFANA_ALERTGROUP_CACHE_TTL must not be negative, got %v", c.Grafana.AlertGroupCacheTTL))
+	}
+
+	return errs
+}
+
+// grafanaConfigured reports whether any Grafana IRM connection setting is set
+func (c *Config) grafanaConfigured() bool {
+	return c.Grafana.URL != "" || c.Grafana.Token != ""
+}
+
+// loadFile parses the YAML configuration file at path into the config
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return fmt.Errorf("parsing config file: %w", err)
+	}
+
+	return nil
+}
+
+// applyEnv overrides config values with the environment variables that are set
+func (c *Config) applyEnv() error {
+	envString(&c.Alertmanager.Host, "ALERTMANAGER_HOST")
+	envString(&c.Alertmanager.BasePath, "ALERTMANAGER_BASE_PATH")
+	envList(&c.Alertmanager.AlertFilter, "ALERTMANAGER_ALERT_FILTER")
+	if err := envInt(&c.Alertmanager.MaxAlerts, "ALERTMANAGER_MAX_ALERTS"); err != nil {
+		return err
+	}
+	if err := envDuration(&c.Alertmanager.GetAlertsTimeout, "ALERTMANAGER_GETALERTS_TIMEOUT"); err != nil {
+		return err
+	}
+	if err := envDuration(&c.Alertmanager.SilenceTimeout, "ALERTMANAGER_SILENCE_TIMEOUT"); err != nil {
+		return err
+	}
+
+	envString(&c.Grafana.URL, "GRAFANA_IRM_URL")
+	envString(&c.Grafana.Token, "GRAFANA_IRM_TOKEN")
+	envString(&c.Grafana.AuthScheme, "GRAFANA_IRM_AUTH_SCHEME")
+	if err := envFloat(&c.Grafana.RateLimit, "GRAFANA_RATE_LIMIT"); err != nil {
+		return err
+	}
+	if err := envInt(&c.Grafana.RateBurst, "GRAFANA_RATE_BURST"); err != nil {
+		return err
+	}
+	if err := envDuration(&c.Grafana.AlertGroupCacheTTL, "GRAFANA_ALERTGROUP_CACHE_TTL"); err != nil {
+		return err
+	}
+
+	envList(&c.Metrics.AlertLabels, "ALERTMANAGER_ALERTS_LABELS")
+	envList(&c.Metrics.AlertAnnotations, "ALERTMANAGER_ALERTS_ANNOTATIONS")
+	envString(&c.Metrics.PrimaryLabel, "PRIMARY_LABEL")
+	envList(&c.Metrics.DefaultLabels, "ALERTMANAGER_ALERTS_DEFAULT_LABELS")
+	if err := envBool(&c.Metrics.SilenceCommentLabel, "SILENCE_COMMENT_LABEL"); err != nil {
+		return err
+	}
+	if err := envInt(&c.Metrics.SilenceCommentMaxLength, "SILENCE_COMMENT_MAX_LENGTH"); err != nil {
+		return err
+	}
+	if err := envInt(&c.Metrics.MaxLabelValueLength, "MAX_LABEL_VALUE_LENGTH"); err != nil {
+		return err
+	}
+	if err := envBool(&c.Metrics.AlertGroupState, "ALERT_GROUP_STATE_METRIC"); err != nil {
+		return err
+	}
+	envFields(&c.Metrics.Fields, fieldEnvPrefix)
+	envString(&c.Metrics.ExportFilter, "EXPORT_FILTER")
+	envString(&c.Metrics.MetricPrefix, "METRIC_PREFIX")
+
+	if err := envInt(&c.Reconcile.Interval, "RECONCILE_INTERVAL"); err != nil {
+		return err
+	}
+	if err := envInt(&c.Reconcile.Timeout, "RECONCILE_TIMEOUT"); err != nil {
+		return err
+	}
+	envString(&c.Reconcile.MatchStrategy, "MATCH_STRATEGY")
+	envString(&c.Reconcile.Mode, "RECONCILE_MODE")
+	envString(&c.Reconcile.IgnoreLabel, "RECONCILE_IGNORE_LABEL")
+	if err := envInt(&c.Reconcile.CircuitBreakerThreshold, "GRAFANA_CIRCUIT_BREAKER_THRESHOLD"); err != nil {
+		return err
+	}
+	if err := envInt(&c.Reconcile.CircuitBreakerCooldown, "GRAFANA_CIRCUIT_BREAKER_COOLDOWN"); err != nil {
+		return err
+	}
+
+	if err := envDuration(&c.Reconcile.Jitter, "RECONCILE_JITTER"); err != nil {
+		return err
+	}
+	if err := envDuration(&c.Reconcile.ResolveGracePeriod, "RESOLVE_GRACE_PERIOD"); err != nil {
+		return err
+	}
+	envList(&c.Reconcile.GrafanaActiveStates, "GRAFANA_ACTIVE_STATES")
+	envList(&c.Reconcile.ManagedIntegrations, "GRAFANA_MANAGED_INTEGRATIONS")
+	if err := envBool(&c.Reconcile.ResolveAddNote, "RESOLVE_ADD_NOTE"); err != nil {
+		return err
+	}
+	envString(&c.Reconcile.ResolveNoteTemplate, "RESOLVE_NOTE_TEMPLATE")
+	envString(&c.Reconcile.ResolveMinSeverity, "RESOLVE_MIN_SEVERITY")
+	envList(&c.Reconcile.ProtectedAlertnames, "RECONCILE_PROTECTED_ALERTNAMES")
+	if err := envBool(&c.Reconcile.ExpireOrphanedSilences, "EXPIRE_ORPHANED_SILENCES"); err != nil {
+		return err
+	}
+
+	envString(&c.Webhook.Username, "WEBHOOK_USERNAME")
+	envString(&c.Webhook.Password, "WEBHOOK_PASSWORD")
+	envList(&c.Webhook.Credentials, "WEBHOOK_CREDENTIALS")
+	envList(&c.Webhook.EmailAllowlist, "WEBHOOK_EMAIL_ALLOWLIST")
+	envList(&c.Webhook.DomainAllowlist, "WEBHOOK_DOMAIN_ALLOWLIST")
+	envString(&c.Webhook.AllowlistFile, "WEBHOOK_ALLOWLIST_FILE")
+	if err := envInt(&c.Webhook.AllowlistReloadInterval, "WEBHOOK_ALLOWLIST_RELOAD_INTERVAL"); err != nil {
+		return err
+	}
+	envString(&c.Webhook.SilenceMode, "WEBHOOK_SILENCE_MODE")
+	envList(&c.Webhook.RegexMatchLabels, "WEBHOOK_REGEX_MATCH_LABELS")
+	envList(&c.Webhook.ExtraMatchers, "WEBHOOK_EXTRA_MATCHERS")
+	envString(&c.Webhook.AuthorTemplate, "WEBHOOK_AUTHOR_TEMPLATE")
+	if err := envInt(&c.Webhook.MaxBodyBytes, "WEBHOOK_MAX_BODY_BYTES"); err != nil {
+		return err
+	}
+	if err := envDuration(&c.Webhook.DefaultSilenceDuration, "WEBHOOK_DEFAULT_SILENCE_DURATION"); err != nil {
+		return err
+	}
+	if err := envDuration(&c.Webhook.MinSilenceDuration, "WEBHOOK_MIN_SILENCE_DURATION"); err != nil {
+		return err
+	}
+	if err := envBool(&c.Webhook.ExpireOnResolve, "WEBHOOK_EXPIRE_ON_RESOLVE"); err != nil {
+		return err
+	}
+
+	envString(&c.Server.Port, "PORT")
+
+	// A single User-Agent override applies to both backends
+	envString(&c.Alertmanager.UserAgent, "HTTP_USER_AGENT")
+	envString(&c.Grafana.UserAgent, "HTTP_USER_AGENT")
+
+	// READ_ONLY guarantees neither backend is ever modified, whoever the caller is
+	if err := envBool(&c.Alertmanager.ReadOnly, "READ_ONLY"); err != nil {
+		return err
+	}
+	if err := envBool(&c.Grafana.ReadOnly, "READ_ONLY"); err != nil {
+		return err
+	}
+
+	envString(&c.Audit.File, "AUDIT_LOG_FILE")
+	envString(&c.Tenant.Label, "TENANT_LABEL")
+	envString(&c.Tenant.Value, "TENANT_VALUE")
+	if err := envBool(&c.Server.EnablePprof, "ENABLE_PPROF"); err != nil {
+		return err
+	}
+	envString(&c.Server.MetricsAuthToken, "METRICS_AUTH_TOKEN")
+	if err := envDuration(&c.Server.ShutdownTimeout, "SHUTDOWN_TIMEOUT"); err != nil {
+		return err
+	}
+	envString(&c.Server.TLSCertFile, "TLS_CERT_FILE")
+	envString(&c.Server.TLSKeyFile, "TLS_KEY_FILE")
+
+	return nil
+}
+
+// applyDefaults fills in default values for settings left unset
+func (c *Config) applyDefaults() {
+	if c.Alertmanager.Host == "" {
+		c.Alertmanager.Host = "localhost:9093"
+	}
+	if c.Metrics.PrimaryLabel == "" {
+		c.Metrics.PrimaryLabel = "alertname"
+	}
+	if c.Metrics.SilenceCommentMaxLength <= 0 {
+		c.Metrics.SilenceCommentMaxLength = 100
+	}
+	if c.Metrics.MetricPrefix == "" {
+		c.Metrics.MetricPrefix = DefaultMetricPrefix
+	}
+	if c.Metrics.MaxLabelValueLength <= 0 {
+		c.Metrics.MaxLabelValueLength = 1024
+	}
+	if c.Reconcile.CircuitBreakerThreshold <= 0 {
+		c.Reconcile.CircuitBreakerThreshold = 5
+	}
+	if c.Reconcile.CircuitBreakerCooldown <= 0 {
+		c.Reconcile.CircuitBreakerCooldown = 60
+	}
+	if c.Webhook.AllowlistReloadInterval <= 0 {
+		c.Webhook.AllowlistReloadInterval = 30
+	}
+	if c.Webhook.MaxBodyBytes <= 0 {
+		c.Webhook.MaxBodyBytes = 1 << 20
+	}
+	if c.Server.Port == "" {
+		c.Server.Port = "8080"
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		c.Server.ShutdownTimeout = 30 * time.Second
+	}
+}
+
+// DefaultAlertLabels are the alert state metric labels exported besides the primary label
+// ALERTMANAGER_ALERTS_DEFAULT_LABELS can select a subset of them to reduce cardinality
+var DefaultAlertLabels = []string{"fingerprint", "state", "suppressed", "acknowledged_by", "resolved_by", "silenced_by", "inhibited_by", "inhibited_by_alertname", "alert_group_id", "acknowledged_at", "created_at", "resolved_at"}
+
+// SilenceCommentLabelName is the alert state metric label added by SilenceCommentLabel
+const SilenceCommentLabelName = "silence_comment"
+
+// DefaultMetricPrefix is the metric name prefix used when METRIC_PREFIX is not set
+const DefaultMetricPrefix = "alertmanager_sync"
+
+// fieldEnvPrefix prefixes the environment variables defining metric field fallback chains
+const fieldEnvPrefix = "FIELD_"
+
+// envFields sets a field fallback chain for every environment variable named prefix<field>,
+// overriding the chain of the same field from the config file
+func envFields(target *map[string][]string, prefix string) {
+	for _, entry := range os.Environ() {
+		key, value, _ := strings.Cut(entry, "=")
+		field, found := strings.CutPrefix(key, prefix)
+		if !found || field == "" || value == "" {
+			continue
+		}
+		if *target == nil {
+			*target = make(map[string][]string)
+		}
+		(*target)[field] = parseList(value)
+	}
+}
+
+// envString overrides target with the environment variable value if it is set
+func envString(target *string, envVar string) {
+	if value := os.Getenv(envVar); value != "" {
+		*target = value
+	}
+}
+
+// envInt overrides target with the integer value of the environment variable if it is set
+func envInt(target *int, envVar string) error {
+	value := os.Getenv(envVar)
+	if value == "" {
+		return nil
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("invalid %s value '%s': must be an integer", envVar, value)
+	}
+
+	*target = parsed
+	return nil
+}
+
+// envFloat overrides target with the floating point value of the environment variable if it is set
+func envFloat(target *float64, envVar string) error {
+	value := os.Getenv(envVar)
+	if value == "" {
+		return nil
+	}
+
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s value '%s': must be a number", envVar, value)
+	}
+
+	*target = parsed
+	return nil
+}
+
+// envBool overrides target with the boolean value of the environment variable if it is set
+func envBool(target *bool, envVar string) error {
+	value := os.Getenv(envVar)
+	if value == "" {
+		return nil
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("invalid %s value '%s': must be true or false", envVar, value)
+	}
+
+	*target = parsed
+	return nil
+}
+
+// envDuration overrides target with the duration value (e.g. "5m") of the environment variable if it is set
+func envDuration(target *time.Duration, envVar string) error {
+	value := os.Getenv(envVar)
+	if value == "" {
+		return nil
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("invalid %s value '%s': must be a duration (e.g. 5m)", envVar, value)
+	}
+
+	*target = parsed
+	return nil
+}
+
+// envList overrides target with the comma-separated environment variable value if it is set
+func envList(target *[]string, envVar string) {
+	if value := os.Getenv(envVar); value != "" {
+		*target = parseList(value)
+	}
+}
+
+// parseList parses a comma-separated value into a list of trimmed strings
+// A value that is a JSON array of strings is decoded as such. Otherwise an entry starting with a
+// double or single quote extends to the matching quote, so it may contain commas, and commas,
+// backslashes and quotes can be escaped with a backslash; other backslashes, as in regex patterns, are kept
+func parseList(value string) []string {
+	if trimmed := strings.TrimSpace(value); strings.HasPrefix(trimmed, "[") {
+		var entries []string
+		if err := json.Unmarshal([]byte(trimmed), &entries); err == nil {
+			return compactList(entries)
+		}
+	}
+
+	var entries []string
+	var entry strings.Builder
+	var quote rune
+	escaped := false
+
+	for _, r := range value {
+		switch {
+		case escaped:
+			if r != ',' && r != '\\' && r != '"' && r != '\'' {
+				entry.WriteRune('\\')
+			}
+			entry.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				entry.WriteRune(r)
+			}
+		case (r == '"' || r == '\'') && strings.TrimSpace(entry.String()) == "":
+			// Quotes only delimit an entry when they open it, so apostrophes inside values are kept
+			entry.Reset()
+			quote = r
+		case r == ',':
+			entries = append(entries, entry.String())
+			entry.Reset()
+		default:
+			entry.WriteRune(r)
+		}
+	}
+	if escaped {
+		entry.WriteRune('\\')
+	}
+	entries = append(entries, entry.String())
+
+	return compactList(entries)
+}
+
+// compactList trims every entry and drops the empty ones
+func compactList(entries []string) []string {
+	result := make([]string, 0, len(entries))
+
+	for _, entry := range entries {
+		trimmed := strings.TrimSpace(entry)
+		if trimmed != "" {
+			result = append(result, trimmed)
+		}
+	}
+
+	return result
+}
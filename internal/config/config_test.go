@@ -0,0 +1,470 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// validConfig returns a configuration that passes Validate, with Grafana IRM and webhooks configured
+func validConfig() *Config {
+	cfg := &Config{}
+	cfg.Grafana.URL = "https://grafana.example.com"
+	cfg.Grafana.Token = "glsa_token"
+	cfg.Webhook.Username = "webhook"
+	cfg.Webhook.Password = "secret"
+	cfg.applyDefaults()
+	return cfg
+}
+
+// writeConfigFile writes a YAML configuration file and points CONFIG_FILE at it
+func writeConfigFile(t *testing.T, content string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_FILE", path)
+}
+
+func TestLoad(t *testing.T) {
+	const file = `
+alertmanager:
+  host: alertmanager.monitoring:9093
+grafana:
+  url: https://oncall.example.com
+  token: file-token
+metrics:
+  alert_labels: [severity, cluster]
+reconcile:
+  interval: 300
+  match_strategy: labels
+webhook:
+  username: irm
+  email_allowlist: [oncall@example.com]
+`
+
+	tests := []struct {
+		name  string
+		file  string
+		env   map[string]string
+		check func(t *testing.T, cfg *Config)
+	}{
+		{
+			name: "defaults without a file",
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Alertmanager.Host != "localhost:9093" || cfg.Server.Port != "8080" {
+					t.Errorf("Alertmanager.Host, Server.Port = %q, %q, want the defaults", cfg.Alertmanager.Host, cfg.Server.Port)
+				}
+			},
+		},
+		{
+			name: "values from the file",
+			file: file,
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Alertmanager.Host != "alertmanager.monitoring:9093" {
+					t.Errorf("Alertmanager.Host = %q", cfg.Alertmanager.Host)
+				}
+				if cfg.Grafana.URL != "https://oncall.example.com" || cfg.Grafana.Token != "file-token" {
+					t.Errorf("Grafana = %+v", cfg.Grafana)
+				}
+				if !reflect.DeepEqual(cfg.Metrics.AlertLabels, []string{"severity", "cluster"}) {
+					t.Errorf("Metrics.AlertLabels = %v", cfg.Metrics.AlertLabels)
+				}
+				if cfg.Reconcile.Interval != 300 || cfg.Reconcile.MatchStrategy != "labels" {
+					t.Errorf("Reconcile = %+v", cfg.Reconcile)
+				}
+				if cfg.Webhook.Username != "irm" || !reflect.DeepEqual(cfg.Webhook.EmailAllowlist, []string{"oncall@example.com"}) {
+					t.Errorf("Webhook = %+v", cfg.Webhook)
+				}
+			},
+		},
+		{
+			name: "environment overrides the file",
+			file: file,
+			env: map[string]string{
+				"GRAFANA_IRM_TOKEN":          "env-token",
+				"ALERTMANAGER_ALERTS_LABELS": "team, ,service",
+				"RECONCILE_INTERVAL":         "60",
+				"WEBHOOK_EMAIL_ALLOWLIST":    "a@example.com,b@example.com",
+				"GRAFANA_RATE_LIMIT":         "2.5",
+				"GRAFANA_RATE_BURST":         "5",
+				"HTTP_USER_AGENT":            "irm-sync/test",
+			},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Grafana.Token != "env-token" || cfg.Grafana.URL != "https://oncall.example.com" {
+					t.Errorf("Grafana = %+v, want the token from the environment and the URL from the file", cfg.Grafana)
+				}
+				if cfg.Grafana.RateLimit != 2.5 || cfg.Grafana.RateBurst != 5 {
+					t.Errorf("Grafana.RateLimit, Grafana.RateBurst = %v, %d, want 2.5 and 5", cfg.Grafana.RateLimit, cfg.Grafana.RateBurst)
+				}
+				if cfg.Alertmanager.UserAgent != "irm-sync/test" || cfg.Grafana.UserAgent != "irm-sync/test" {
+					t.Errorf("UserAgent = %q, %q, want irm-sync/test for both backends", cfg.Alertmanager.UserAgent, cfg.Grafana.UserAgent)
+				}
+				if !reflect.DeepEqual(cfg.Metrics.AlertLabels, []string{"team", "service"}) {
+					t.Errorf("Metrics.AlertLabels = %v", cfg.Metrics.AlertLabels)
+				}
+				if cfg.Reconcile.Interval != 60 || cfg.Reconcile.MatchStrategy != "labels" {
+					t.Errorf("Reconcile = %+v", cfg.Reconcile)
+				}
+				if !reflect.DeepEqual(cfg.Webhook.EmailAllowlist, []string{"a@example.com", "b@example.com"}) {
+					t.Errorf("Webhook.EmailAllowlist = %v", cfg.Webhook.EmailAllowlist)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.file != "" {
+				writeConfigFile(t, tt.file)
+			}
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			cfg, err := Load()
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			tt.check(t, cfg)
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+	}{
+		{name: "invalid YAML", file: "alertmanager: [unclosed"},
+		{name: "missing file", env: map[string]string{"CONFIG_FILE": filepath.Join(os.TempDir(), "does-not-exist.yaml")}},
+		{name: "invalid integer", env: map[string]string{"RECONCILE_INTERVAL": "5m"}},
+		{name: "invalid number", env: map[string]string{"GRAFANA_RATE_LIMIT": "fast"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.file != "" {
+				writeConfigFile(t, tt.file)
+			}
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			if _, err := Load(); err == nil {
+				t.Error("Load() succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(*Config)
+		wantErr string
+	}{
+		{name: "valid", modify: func(*Config) {}},
+		{
+			name:    "grafana url without token",
+			modify:  func(c *Config) { c.Grafana.Token = "" },
+			wantErr: "GRAFANA_IRM_URL and GRAFANA_IRM_TOKEN must be set together",
+		},
+		{
+			name:    "grafana without webhook credentials",
+			modify:  func(c *Config) { c.Webhook.Username, c.Webhook.Password = "", "" },
+			wantErr: "WEBHOOK_USERNAME and WEBHOOK_PASSWORD or WEBHOOK_CREDENTIALS must be set when Grafana IRM is configured",
+		},
+		{
+			name: "webhook credentials list only",
+			modify: func(c *Config) {
+				c.Webhook.Username, c.Webhook.Password = "", ""
+				c.Webhook.Credentials = []string{"irm:secret", "alerting:rotated"}
+			},
+		},
+		{
+			name:    "webhook username without password",
+			modify:  func(c *Config) { c.Webhook.Password = "" },
+			wantErr: "WEBHOOK_USERNAME and WEBHOOK_PASSWORD must be set together",
+		},
+		{
+			name:    "malformed webhook credential",
+			modify:  func(c *Config) { c.Webhook.Credentials = []string{"irm:secret", "alerting"} },
+			wantErr: "WEBHOOK_CREDENTIALS entries must be in the form user:pass",
+		},
+		{
+			name: "reconcile without grafana",
+			modify: func(c *Config) {
+				c.Grafana.URL, c.Grafana.Token = "", ""
+				c.Reconcile.Interval = 60
+			},
+			wantErr: "RECONCILE_INTERVAL requires GRAFANA_IRM_URL and GRAFANA_IRM_TOKEN",
+		},
+		{
+			name:    "negative max alerts",
+			modify:  func(c *Config) { c.Alertmanager.MaxAlerts = -1 },
+			wantErr: "ALERTMANAGER_MAX_ALERTS must not be negative",
+		},
+		{
+			name:    "negative rate limit",
+			modify:  func(c *Config) { c.Grafana.RateLimit = -1 },
+			wantErr: "GRAFANA_RATE_LIMIT must not be negative",
+		},
+		{
+			name:    "negative reconcile jitter",
+			modify:  func(c *Config) { c.Reconcile.Jitter = -time.Second },
+			wantErr: "RECONCILE_JITTER must not be negative",
+		},
+		{
+			name:    "unknown grafana active state",
+			modify:  func(c *Config) { c.Reconcile.GrafanaActiveStates = []string{"firing", "resolved"} },
+			wantErr: "GRAFANA_ACTIVE_STATES entries must be firing, new, acknowledged or silenced, got 'resolved'",
+		},
+		{
+			name:    "unknown match strategy",
+			modify:  func(c *Config) { c.Reconcile.MatchStrategy = "name" },
+			wantErr: "MATCH_STRATEGY must be fingerprint, labels or both, got 'name'",
+		},
+		{
+			name:    "unknown reconcile mode",
+			modify:  func(c *Config) { c.Reconcile.Mode = "dry_run" },
+			wantErr: "RECONCILE_MODE must be export_only, resolve or both, got 'dry_run'",
+		},
+		{
+			name:    "malformed ignore label",
+			modify:  func(c *Config) { c.Reconcile.IgnoreLabel = "sync_ignore" },
+			wantErr: "RECONCILE_IGNORE_LABEL must be in the form name=value",
+		},
+		{
+			name:    "unknown silence mode",
+			modify:  func(c *Config) { c.Webhook.SilenceMode = "all" },
+			wantErr: "WEBHOOK_SILENCE_MODE must be per_alert or grouped, got 'all'",
+		},
+		{
+			name:    "invalid primary label",
+			modify:  func(c *Config) { c.Metrics.PrimaryLabel = "alert-name" },
+			wantErr: "PRIMARY_LABEL must be a valid label name, got 'alert-name'",
+		},
+		{
+			name:    "primary label clashing with a built-in label",
+			modify:  func(c *Config) { c.Metrics.PrimaryLabel = "fingerprint" },
+			wantErr: "PRIMARY_LABEL must not be a built-in metric label",
+		},
+		{
+			name:   "primary label listed as an alert label",
+			modify: func(c *Config) { c.Metrics.AlertLabels = []string{"alertname", "severity"} },
+		},
+		{
+			name:    "invalid alert label",
+			modify:  func(c *Config) { c.Metrics.AlertLabels = []string{"team-name"} },
+			wantErr: "ALERTMANAGER_ALERTS_LABELS entries must be valid label names, got 'team-name'",
+		},
+		{
+			name:    "reserved alert label",
+			modify:  func(c *Config) { c.Metrics.AlertLabels = []string{"__name__"} },
+			wantErr: "ALERTMANAGER_ALERTS_LABELS entries must be valid label names",
+		},
+		{
+			name:    "alert label clashing with a built-in label",
+			modify:  func(c *Config) { c.Metrics.AlertLabels = []string{"state"} },
+			wantErr: "ALERTMANAGER_ALERTS_LABELS entry 'state' clashes with a built-in metric label",
+		},
+		{
+			name:    "alert label clashing with the silence comment label",
+			modify:  func(c *Config) { c.Metrics.AlertLabels = []string{"silence_comment"} },
+			wantErr: "clashes with a built-in metric label",
+		},
+		{
+			name:    "duplicate alert label",
+			modify:  func(c *Config) { c.Metrics.AlertLabels = []string{"severity", "severity"} },
+			wantErr: "ALERTMANAGER_ALERTS_LABELS lists 'severity' more than once",
+		},
+		{
+			name:    "invalid annotation",
+			modify:  func(c *Config) { c.Metrics.AlertAnnotations = []string{"runbook-url"} },
+			wantErr: "ALERTMANAGER_ALERTS_ANNOTATIONS entries must be valid label names, got 'runbook-url'",
+		},
+		{
+			name:   "annotation clashing with a label",
+			modify: func(c *Config) { c.Metrics.AlertAnnotations = []string{"state"} },
+		},
+		{
+			name:    "invalid field name",
+			modify:  func(c *Config) { c.Metrics.Fields = map[string][]string{"service-name": {"label:service"}} },
+			wantErr: "FIELD_service-name does not name a valid label",
+		},
+		{
+			name: "field clashing with an alert label",
+			modify: func(c *Config) {
+				c.Metrics.AlertLabels = []string{"service"}
+				c.Metrics.Fields = map[string][]string{"service": {"annotation:service_name"}}
+			},
+			wantErr: "FIELD_service clashes with another metric label",
+		},
+		{
+			name: "valid field",
+			modify: func(c *Config) {
+				c.Metrics.Fields = map[string][]string{"service": {"label:service", "annotation:service_name"}}
+			},
+		},
+		{
+			name:    "invalid field source",
+			modify:  func(c *Config) { c.Metrics.Fields = map[string][]string{"service": {"label:service", "env:SERVICE"}} },
+			wantErr: "FIELD_service sources must be label:<name> or annotation:<name>, got 'env:SERVICE'",
+		},
+		{
+			name:    "tls certificate without key",
+			modify:  func(c *Config) { c.Server.TLSCertFile = "/etc/tls/tls.crt" },
+			wantErr: "TLS_CERT_FILE and TLS_KEY_FILE must be set together",
+		},
+		{
+			name:    "invalid export filter",
+			modify:  func(c *Config) { c.Metrics.ExportFilter = `{severity=~"[unclosed"}` },
+			wantErr: "EXPORT_FILTER is not a valid matcher expression",
+		},
+		{
+			name:    "invalid metric prefix",
+			modify:  func(c *Config) { c.Metrics.MetricPrefix = "team-sync" },
+			wantErr: "METRIC_PREFIX must be a valid metric name prefix",
+		},
+		{
+			name:    "tenant label without value",
+			modify:  func(c *Config) { c.Tenant.Label = "tenant" },
+			wantErr: "TENANT_LABEL and TENANT_VALUE must be set together",
+		},
+		{
+			name:    "malformed extra matcher",
+			modify:  func(c *Config) { c.Webhook.ExtraMatchers = []string{"source=grafana-irm", "=irm"} },
+			wantErr: "WEBHOOK_EXTRA_MATCHERS entries must be in the form name=value, got '=irm'",
+		},
+		{
+			name:    "unknown minimum severity",
+			modify:  func(c *Config) { c.Reconcile.ResolveMinSeverity = "page" },
+			wantErr: "RESOLVE_MIN_SEVERITY must be info, warning, error or critical, got 'page'",
+		},
+		{
+			name:    "invalid resolution note template",
+			modify:  func(c *Config) { c.Reconcile.ResolveNoteTemplate = "{{.Alertname" },
+			wantErr: "RESOLVE_NOTE_TEMPLATE is not a valid template",
+		},
+		{
+			name:    "invalid author template",
+			modify:  func(c *Config) { c.Webhook.AuthorTemplate = "{{.Username" },
+			wantErr: "WEBHOOK_AUTHOR_TEMPLATE is not a valid template",
+		},
+		{
+			name:    "invalid port",
+			modify:  func(c *Config) { c.Server.Port = "http" },
+			wantErr: "PORT must be a valid port number",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			tt.modify(cfg)
+
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate() error = %v, want none", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Validate() error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	cfg := validConfig()
+	cfg.Grafana.RateBurst = -1
+	cfg.Server.Port = "0"
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Validate() returned no error")
+	}
+	if lines := strings.Split(err.Error(), "\n"); len(lines) != 2 {
+		t.Errorf("Validate() reported %d problems, want 2: %v", len(lines), err)
+	}
+}
+
+func TestValidateBackends(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(*Config)
+		wantErr string
+	}{
+		{
+			name:   "webhook credentials are not required",
+			modify: func(c *Config) { c.Webhook.Username, c.Webhook.Password = "", "" },
+		},
+		{
+			name:   "non-backend settings are ignored",
+			modify: func(c *Config) { c.Server.Port = "http" },
+		},
+		{
+			name:    "grafana token without url",
+			modify:  func(c *Config) { c.Grafana.URL = "" },
+			wantErr: "GRAFANA_IRM_URL and GRAFANA_IRM_TOKEN must be set together",
+		},
+		{
+			name:    "negative alertmanager timeout",
+			modify:  func(c *Config) { c.Alertmanager.GetAlertsTimeout = -1 },
+			wantErr: "ALERTMANAGER_GETALERTS_TIMEOUT must not be negative",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			tt.modify(cfg)
+
+			err := cfg.ValidateBackends()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("ValidateBackends() error = %v, want none", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("ValidateBackends() error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseList(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  []string
+	}{
+		{name: "plain", value: " team, severity ,,service", want: []string{"team", "severity", "service"}},
+		{name: "empty", value: "", want: []string{}},
+		{name: "double quoted", value: `"a,b", c`, want: []string{"a,b", "c"}},
+		{name: "single quoted", value: `'a,b','c'`, want: []string{"a,b", "c"}},
+		{name: "apostrophe inside value", value: "on-call's team,c", want: []string{"on-call's team", "c"}},
+		{name: "escaped comma", value: `a\,b,c`, want: []string{"a,b", "c"}},
+		{name: "escaped quote", value: `\"a\",b`, want: []string{`"a"`, "b"}},
+		{name: "regex backslashes kept", value: `db-\d+,c`, want: []string{`db-\d+`, "c"}},
+		{name: "json array", value: ` ["a,b", "c", ""]`, want: []string{"a,b", "c"}},
+		{name: "invalid json array", value: "[a,b]", want: []string{"[a", "b]"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseList(tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseList(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
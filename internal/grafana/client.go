@@ -1,149 +1,492 @@
 package grafana
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"mime"
 	"net/http"
-	"os"
+	"net/url"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/config"
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/logging"
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/version"
+	"golang.org/x/sync/singleflight"
+	"golang.org/x/time/rate"
 )
 
 const (
-	alertGroupsEndpoint   = "/api/v1/alert_groups"
-	resolveAlertEndpoint  = "/api/v1/alert_groups/%s/resolve"
+	alertGroupsEndpoint    = "/api/v1/alert_groups"
+	alertGroupEndpoint     = "/api/v1/alert_groups/%s"
+	resolveAlertEndpoint   = "/api/v1/alert_groups/%s/resolve"
 	unsilenceAlertEndpoint = "/api/v1/alert_groups/%s/unsilence"
-	userEndpoint          = "/api/v1/users/%s"
+	userEndpoint           = "/api/v1/users/%s"
+	resolutionNoteEndpoint = "/api/v1/resolution_notes/"
+)
+
+const (
+	// maxAlertGroupPages bounds the number of alert group pages fetched by GetAllAlertGroups
+	maxAlertGroupPages = 100
+	// maxRateLimitRetries is how many times a request rejected with 429 is retried
+	maxRateLimitRetries = 3
+	// defaultRetryAfter is the wait before retrying a 429 response without a usable Retry-After header
+	defaultRetryAfter = time.Second
+	// maxRetryAfter caps the wait requested by a Retry-After header
+	maxRetryAfter = time.Minute
 )
 
 // Client wraps the Grafana IRM API client
 type Client struct {
 	baseURL    string
 	apiToken   string
+	authScheme string
+	userAgent  string
+	readOnly   bool
 	httpClient *http.Client
+	limiter    *rate.Limiter
 	userCache  map[string]*User
 	cacheMutex sync.RWMutex
+	// userFetches coalesces concurrent fetches of the same uncached user
+	userFetches singleflight.Group
+
+	// alertGroupCache holds recent GetAllAlertGroups results by request path for alertGroupCacheTTL
+	alertGroupCacheTTL   time.Duration
+	alertGroupCache      map[string]alertGroupCacheEntry
+	alertGroupCacheMutex sync.Mutex
+
+	// requestObserver is notified of every API request with its method and status code
+	requestObserver RequestObserver
+}
+
+// alertGroupCacheEntry is a cached alert group listing
+type alertGroupCacheEntry struct {
+	groups    []AlertGroup
+	fetchedAt time.Time
+}
+
+// RequestObserver is called after each API request with the HTTP method and the
+// response status code, or "error" when no response was received
+type RequestObserver func(method, code string)
+
+// ClientConfig holds the explicit settings used to build a Grafana IRM client
+type ClientConfig struct {
+	BaseURL    string
+	Token      string
+	AuthScheme string
+	// RateLimit is the maximum number of requests per second (0 disables rate limiting)
+	// RateBurst is the number of requests allowed above the rate, at least 1
+	RateLimit float64
+	RateBurst int
+	// AlertGroupCacheTTL is how long alert group listings are reused (0 disables the cache)
+	AlertGroupCacheTTL time.Duration
+	// UserAgent is sent with every request, defaulting to alertmanager-alert-sync/<version>
+	UserAgent string
+	// ReadOnly rejects every non-GET request with ErrReadOnly without sending it
+	ReadOnly bool
+	// HTTPClient is used for all API calls; a client with a 10s timeout is used when nil
+	HTTPClient *http.Client
 }
 
 // NewClient creates a new Grafana IRM client
-// It reads GRAFANA_IRM_URL and GRAFANA_IRM_TOKEN from environment variables
-func NewClient() (*Client, error) {
-	baseURL := os.Getenv("GRAFANA_IRM_URL")
-	if baseURL == "" {
-		return nil, fmt.Errorf("GRAFANA_IRM_URL environment variable not set")
+// It requires both the Grafana IRM URL (GRAFANA_IRM_URL) and token (GRAFANA_IRM_TOKEN) to be configured
+func NewClient(cfg config.GrafanaConfig) (*Client, error) {
+	return NewClientWithConfig(ClientConfig{
+		BaseURL:    cfg.URL,
+		Token:      cfg.Token,
+		AuthScheme: cfg.AuthScheme,
+		RateLimit:  cfg.RateLimit,
+		RateBurst:  cfg.RateBurst,
+
+		AlertGroupCacheTTL: cfg.AlertGroupCacheTTL,
+		UserAgent:          cfg.UserAgent,
+		ReadOnly:           cfg.ReadOnly,
+	})
+}
+
+// NewClientWithConfig creates a new Grafana IRM client from an explicit base URL and HTTP client
+func NewClientWithConfig(cfg ClientConfig) (*Client, error) {
+	if cfg.BaseURL == "" {
+		return nil, fmt.Errorf("GRAFANA_IRM_URL not configured")
 	}
 
-	apiToken := os.Getenv("GRAFANA_IRM_TOKEN")
-	if apiToken == "" {
-		return nil, fmt.Errorf("GRAFANA_IRM_TOKEN environment variable not set")
+	if cfg.Token == "" {
+		return nil, fmt.Errorf("GRAFANA_IRM_TOKEN not configured")
 	}
 
-	return &Client{
-		baseURL:  baseURL,
-		apiToken: apiToken,
-		httpClient: &http.Client{
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{
 			Timeout: 10 * time.Second,
-		},
-		userCache: make(map[string]*User),
+		}
+	}
+
+	limiter := rate.NewLimiter(rate.Inf, 0)
+	if cfg.RateLimit > 0 {
+		burst := cfg.RateBurst
+		if burst < 1 {
+			burst = 1
+		}
+		limiter = rate.NewLimiter(rate.Limit(cfg.RateLimit), burst)
+		log.Printf("Grafana IRM requests limited to %g/s (burst %d)", cfg.RateLimit, burst)
+	}
+
+	userAgent := cfg.UserAgent
+	if userAgent == "" {
+		userAgent = version.UserAgent()
+	}
+
+	if cfg.ReadOnly {
+		log.Println("Grafana IRM client is read-only, alert groups will not be modified")
+	}
+
+	return &Client{
+		baseURL:    cfg.BaseURL,
+		apiToken:   cfg.Token,
+		authScheme: cfg.AuthScheme,
+		userAgent:  userAgent,
+		httpClient: httpClient,
+		limiter:    limiter,
+		userCache:  make(map[string]*User),
+		readOnly:   cfg.ReadOnly,
+
+		alertGroupCacheTTL: cfg.AlertGroupCacheTTL,
+		alertGroupCache:    make(map[string]alertGroupCacheEntry),
 	}, nil
 }
 
-// GetAllAlertGroups retrieves all alert groups from Grafana IRM (firing, resolved, etc.)
-func (c *Client) GetAllAlertGroups() ([]AlertGroup, error) {
-	url := fmt.Sprintf("%s%s", c.baseURL, alertGroupsEndpoint)
-	log.Printf("Fetching all alert groups from URL: %s", url)
+// SetRequestObserver registers a function notified of every API request
+// It must be called before the client is used concurrently
+func (c *Client) SetRequestObserver(observer RequestObserver) {
+	c.requestObserver = observer
+}
 
-	req, err := http.NewRequest("GET", url, nil)
+// observeRequest notifies the request observer, if any
+func (c *Client) observeRequest(method, code string) {
+	if c.requestObserver != nil {
+		c.requestObserver(method, code)
+	}
+}
+
+// newRequest builds a request to the Grafana IRM API with the authorization, content-type and user-agent headers set
+func (c *Client) newRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
 	if err != nil {
-		return nil, fmt.Errorf("creating request: %w", err)
+		return nil, err
 	}
 
-	req.Header.Set("Authorization", c.apiToken)
+	req.Header.Set("Authorization", c.authorizationHeader())
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", c.userAgent)
+	return req, nil
+}
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("executing request: %w", err)
+// authorizationHeader returns the Authorization header value, prefixing the token with the
+// configured scheme (e.g. "Bearer <token>") or sending the raw token when no scheme is set
+func (c *Client) authorizationHeader() string {
+	if c.authScheme == "" {
+		return c.apiToken
 	}
+	return c.authScheme + " " + c.apiToken
+}
+
+// doRequest executes a request against the Grafana IRM API
+// Requests wait for the rate limiter and are retried when Grafana answers 429 Too Many Requests
+// Non-2xx responses are returned as *APIError; on success the JSON body is decoded into out (if non-nil)
+func (c *Client) doRequest(ctx context.Context, method, path string, body io.Reader, out interface{}) error {
+	// Every mutation goes through here, so this is the single place read-only mode is enforced
+	if c.readOnly && method != http.MethodGet {
+		logging.Printf(ctx, "Read-only mode, not sending %s %s", method, path)
+		return fmt.Errorf("%s %s: %w", method, path, ErrReadOnly)
+	}
+
+	// Buffer the body so the request can be rebuilt for retries
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = io.ReadAll(body); err != nil {
+			return fmt.Errorf("reading request body: %w", err)
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		if err := c.limiter.Wait(ctx); err != nil {
+			return fmt.Errorf("waiting for rate limiter: %w", err)
+		}
+
+		var reqBody io.Reader
+		if payload != nil {
+			reqBody = bytes.NewReader(payload)
+		}
+		req, err := c.newRequest(ctx, method, path, reqBody)
+		if err != nil {
+			return fmt.Errorf("creating request: %w", err)
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			c.observeRequest(method, "error")
+			return fmt.Errorf("executing request: %w", err)
+		}
+		c.observeRequest(method, strconv.Itoa(resp.StatusCode))
+
+		if resp.StatusCode == http.StatusTooManyRequests && attempt < maxRateLimitRetries {
+			wait := retryAfter(resp.Header.Get("Retry-After"), time.Now())
+			resp.Body.Close()
+			logging.Printf(ctx, "Grafana IRM rate limited %s %s, retrying in %v (attempt %d/%d)",
+				method, path, wait, attempt+1, maxRateLimitRetries)
+
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return fmt.Errorf("waiting to retry rate limited request: %w", ctx.Err())
+			case <-timer.C:
+			}
+			continue
+		}
+
+		return decodeResponse(resp, out)
+	}
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP date
+// It falls back to defaultRetryAfter when the header is missing or invalid and never exceeds maxRetryAfter
+func retryAfter(header string, now time.Time) time.Duration {
+	wait := defaultRetryAfter
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		wait = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(header); err == nil {
+		wait = date.Sub(now)
+	}
+
+	if wait < 0 {
+		wait = 0
+	}
+	if wait > maxRetryAfter {
+		wait = maxRetryAfter
+	}
+	return wait
+}
+
+// decodeResponse closes the response body and decodes it into out (if non-nil)
+// Non-2xx responses are returned as *APIError
+func decodeResponse(resp *http.Response, out interface{}) error {
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return &APIError{StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+
+	if out == nil {
+		return nil
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("reading response: %w", err)
+		return fmt.Errorf("reading response: %w", err)
 	}
 
-	var response AlertGroupResponse
-	if err := json.Unmarshal(body, &response); err != nil {
-		return nil, fmt.Errorf("parsing response: %w", err)
+	// An empty body is an empty result, leaving out untouched
+	if len(bytes.TrimSpace(respBody)) == 0 {
+		return nil
 	}
 
-	return response.Results, nil
-}
+	// Proxies in front of Grafana may answer 200 with an HTML page instead of JSON
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" && !isJSONContentType(contentType) {
+		return fmt.Errorf("unexpected response content type %q: %s", contentType, bodySnippet(string(respBody)))
+	}
 
-func (c *Client) ResolveAlertGroup(alertGroupID string) error {
-	url := fmt.Sprintf("%s%s", c.baseURL, fmt.Sprintf(resolveAlertEndpoint, alertGroupID))
-	log.Printf("Resolving alert group at URL: %s", url)
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("parsing response: %w (body: %s)", err, bodySnippet(string(respBody)))
+	}
 
-	req, err := http.NewRequest("POST", url, nil)
+	return nil
+}
+
+// isJSONContentType reports whether a Content-Type header denotes JSON (application/json or +json types)
+func isJSONContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
 	if err != nil {
-		return fmt.Errorf("creating request: %w", err)
+		return false
 	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
 
-	req.Header.Set("Authorization", c.apiToken)
-	req.Header.Set("Content-Type", "application/json")
+// Ping checks connectivity and credentials against the Grafana IRM API
+func (c *Client) Ping(ctx context.Context) error {
+	return c.doRequest(ctx, "GET", alertGroupsEndpoint, nil, nil)
+}
 
-	resp, err := c.httpClient.Do(req)
+// GetAllAlertGroups retrieves all alert groups from Grafana IRM (firing, resolved, etc.), following pagination
+// Results are reused for the configured alert group cache TTL, if any
+// When a page after the first fails or the listing spans more than maxAlertGroupPages, the groups already
+// fetched are returned with an error matching ErrPartialResults, so callers can proceed with partial data;
+// partial results are not cached
+func (c *Client) GetAllAlertGroups(ctx context.Context) ([]AlertGroup, error) {
+	if groups, ok := c.cachedAlertGroups(alertGroupsEndpoint); ok {
+		logging.Printf(ctx, "Using %d cached alert groups", len(groups))
+		return groups, nil
+	}
+
+	var groups []AlertGroup
+	path := alertGroupsEndpoint
+	for page := 1; page <= maxAlertGroupPages; page++ {
+		logging.Printf(ctx, "Fetching alert groups from URL: %s", c.baseURL+path)
+
+		var response AlertGroupResponse
+		err := c.doRequest(ctx, "GET", path, nil, &response)
+		if err == nil {
+			groups = append(groups, response.Results...)
+			path, err = nextPagePath(alertGroupsEndpoint, response.Next)
+		}
+		if err != nil {
+			if page == 1 && groups == nil {
+				return nil, err
+			}
+			logging.Printf(ctx, "Failed to fetch alert groups page %d, continuing with the %d groups fetched: %v",
+				page, len(groups), err)
+			return groups, fmt.Errorf("fetching alert groups page %d: %w: %w", page, ErrPartialResults, err)
+		}
+
+		if path == "" {
+			c.cacheAlertGroups(alertGroupsEndpoint, groups)
+			return groups, nil
+		}
+	}
+
+	logging.Printf(ctx, "Warning: stopped fetching alert groups after %d pages, continuing with the %d groups fetched",
+		maxAlertGroupPages, len(groups))
+	return groups, fmt.Errorf("alert groups span more than %d pages: %w", maxAlertGroupPages, ErrPartialResults)
+}
+
+// nextPagePath returns the path requesting the page the next field of a paginated response points to,
+// or "" on the last page
+// Only the query of the next URL is kept, so its cursor, filters and page size carry over while
+// requests keep going to the configured base URL
+func nextPagePath(endpoint string, next interface{}) (string, error) {
+	link, ok := next.(string)
+	if !ok || link == "" {
+		return "", nil
+	}
+	nextURL, err := url.Parse(link)
 	if err != nil {
-		return fmt.Errorf("executing request: %w", err)
+		return "", fmt.Errorf("parsing next page URL: %w", err)
 	}
-	defer resp.Body.Close()
+	if nextURL.RawQuery == "" {
+		return "", fmt.Errorf("next page URL %q has no query", link)
+	}
+	return endpoint + "?" + nextURL.RawQuery, nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+// GetAlertGroup retrieves a single alert group by ID from Grafana IRM, bypassing the alert group cache
+// An unknown ID returns an error matching ErrNotFound
+func (c *Client) GetAlertGroup(ctx context.Context, alertGroupID string) (*AlertGroup, error) {
+	path := fmt.Sprintf(alertGroupEndpoint, alertGroupID)
+	logging.Printf(ctx, "Fetching alert group from URL: %s", c.baseURL+path)
+
+	var group AlertGroup
+	if err := c.doRequest(ctx, "GET", path, nil, &group); err != nil {
+		return nil, err
 	}
 
-	log.Printf("Successfully resolved alert group: %s", alertGroupID)
-	return nil
+	return &group, nil
 }
 
-// UnsilenceAlertGroup unsilences an alert group in Grafana IRM
-func (c *Client) UnsilenceAlertGroup(alertGroupID string) error {
-	url := fmt.Sprintf("%s%s", c.baseURL, fmt.Sprintf(unsilenceAlertEndpoint, alertGroupID))
-	log.Printf("Unsilencing alert group at URL: %s", url)
+// cachedAlertGroups returns a copy of the alert groups cached for path if they are still fresh
+func (c *Client) cachedAlertGroups(path string) ([]AlertGroup, bool) {
+	if c.alertGroupCacheTTL <= 0 {
+		return nil, false
+	}
+
+	c.alertGroupCacheMutex.Lock()
+	defer c.alertGroupCacheMutex.Unlock()
 
-	req, err := http.NewRequest("POST", url, nil)
+	entry, exists := c.alertGroupCache[path]
+	if !exists || time.Since(entry.fetchedAt) > c.alertGroupCacheTTL {
+		return nil, false
+	}
+	return append([]AlertGroup(nil), entry.groups...), true
+}
+
+// cacheAlertGroups stores a copy of the alert groups fetched from path
+func (c *Client) cacheAlertGroups(path string, groups []AlertGroup) {
+	if c.alertGroupCacheTTL <= 0 {
+		return
+	}
+
+	c.alertGroupCacheMutex.Lock()
+	defer c.alertGroupCacheMutex.Unlock()
+	c.alertGroupCache[path] = alertGroupCacheEntry{
+		groups:    append([]AlertGroup(nil), groups...),
+		fetchedAt: time.Now(),
+	}
+}
+
+// invalidateAlertGroups drops every cached alert group listing after a write to an alert group
+func (c *Client) invalidateAlertGroups() {
+	c.alertGroupCacheMutex.Lock()
+	defer c.alertGroupCacheMutex.Unlock()
+	clear(c.alertGroupCache)
+}
+
+// ResolveAlertGroup resolves an alert group in Grafana IRM
+func (c *Client) ResolveAlertGroup(ctx context.Context, alertGroupID string) error {
+	path := fmt.Sprintf(resolveAlertEndpoint, alertGroupID)
+	logging.Printf(ctx, "Resolving alert group at URL: %s", c.baseURL+path)
+
+	err := c.doRequest(ctx, "POST", path, nil, nil)
+	c.invalidateAlertGroups()
 	if err != nil {
-		return fmt.Errorf("creating request: %w", err)
+		return err
 	}
 
-	req.Header.Set("Authorization", c.apiToken)
-	req.Header.Set("Content-Type", "application/json")
+	logging.Printf(ctx, "Successfully resolved alert group: %s", alertGroupID)
+	return nil
+}
 
-	resp, err := c.httpClient.Do(req)
+// CreateResolutionNote adds a resolution note with the given text to an alert group in Grafana IRM
+func (c *Client) CreateResolutionNote(ctx context.Context, alertGroupID, text string) error {
+	body, err := json.Marshal(ResolutionNote{AlertGroupID: alertGroupID, Text: text})
 	if err != nil {
-		return fmt.Errorf("executing request: %w", err)
+		return fmt.Errorf("encoding resolution note: %w", err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+	logging.Printf(ctx, "Adding resolution note to alert group %s", alertGroupID)
+	err = c.doRequest(ctx, "POST", resolutionNoteEndpoint, bytes.NewReader(body), nil)
+	c.invalidateAlertGroups()
+	if err != nil {
+		return err
+	}
+
+	logging.Printf(ctx, "Successfully added resolution note to alert group: %s", alertGroupID)
+	return nil
+}
+
+// UnsilenceAlertGroup unsilences an alert group in Grafana IRM
+func (c *Client) UnsilenceAlertGroup(ctx context.Context, alertGroupID string) error {
+	path := fmt.Sprintf(unsilenceAlertEndpoint, alertGroupID)
+	logging.Printf(ctx, "Unsilencing alert group at URL: %s", c.baseURL+path)
+
+	err := c.doRequest(ctx, "POST", path, nil, nil)
+	c.invalidateAlertGroups()
+	if err != nil {
+		return err
 	}
 
-	log.Printf("Successfully unsilenced alert group: %s", alertGroupID)
+	logging.Printf(ctx, "Successfully unsilenced alert group: %s", alertGroupID)
 	return nil
 }
 
 // GetUser retrieves user information by user ID with caching
-func (c *Client) GetUser(userID string) (*User, error) {
+func (c *Client) GetUser(ctx context.Context, userID string) (*User, error) {
 	if userID == "" {
 		return nil, nil
 	}
@@ -157,36 +500,31 @@ func (c *Client) GetUser(userID string) (*User, error) {
 	c.cacheMutex.RUnlock()
 
 	// User not in cache, fetch from API
-	url := fmt.Sprintf("%s%s", c.baseURL, fmt.Sprintf(userEndpoint, userID))
-	log.Printf("Fetching user from URL: %s", url)
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("creating request: %w", err)
-	}
-
-	req.Header.Set("Authorization", c.apiToken)
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("executing request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+	// Concurrent misses for the same user share a single request
+	// The shared fetch ignores the caller's cancellation, which would otherwise fail every waiter,
+	// and is bounded by the client's own timeout instead
+	fetch := c.userFetches.DoChan(userID, func() (interface{}, error) {
+		return c.fetchUser(context.WithoutCancel(ctx), userID)
+	})
+	select {
+	case result := <-fetch:
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		return result.Val.(*User), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
+}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("reading response: %w", err)
-	}
+// fetchUser fetches a user from the API and stores it in the cache
+func (c *Client) fetchUser(ctx context.Context, userID string) (*User, error) {
+	path := fmt.Sprintf(userEndpoint, userID)
+	logging.Printf(ctx, "Fetching user from URL: %s", c.baseURL+path)
 
 	var user User
-	if err := json.Unmarshal(body, &user); err != nil {
-		return nil, fmt.Errorf("parsing response: %w", err)
+	if err := c.doRequest(ctx, "GET", path, nil, &user); err != nil {
+		return nil, err
 	}
 
 	// Store in cache (write lock)
@@ -194,15 +532,22 @@ func (c *Client) GetUser(userID string) (*User, error) {
 	c.userCache[userID] = &user
 	c.cacheMutex.Unlock()
 
-	log.Printf("Cached user %s (email: %s)", userID, user.Email)
+	logging.Printf(ctx, "Cached user %s (email: %s)", userID, user.Email)
 	return &user, nil
 }
 
+// UserCacheSize returns the number of users currently cached
+func (c *Client) UserCacheSize() int {
+	c.cacheMutex.RLock()
+	defer c.cacheMutex.RUnlock()
+	return len(c.userCache)
+}
+
 // GetUserEmail retrieves only the email for a user ID (with caching)
-func (c *Client) GetUserEmail(userID string) string {
-	user, err := c.GetUser(userID)
+func (c *Client) GetUserEmail(ctx context.Context, userID string) string {
+	user, err := c.GetUser(ctx, userID)
 	if err != nil {
-		log.Printf("Failed to fetch user %s: %v", userID, err)
+		logging.Printf(ctx, "Failed to fetch user %s: %v", userID, err)
 		return ""
 	}
 	if user == nil {
@@ -0,0 +1,841 @@
+package grafana
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/config"
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/version"
+)
+
+func TestAuthorizationHeader(t *testing.T) {
+	tests := []struct {
+		scheme string
+		want   string
+	}{
+		{scheme: "", want: "glsa_test"},
+		{scheme: "Bearer", want: "Bearer glsa_test"},
+		{scheme: "OnCall", want: "OnCall glsa_test"},
+	}
+
+	for _, tt := range tests {
+		t.Run("scheme "+tt.scheme, func(t *testing.T) {
+			var mutex sync.Mutex
+			headers := make(map[string]string)
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				mutex.Lock()
+				headers[r.Method+" "+r.URL.Path] = r.Header.Get("Authorization")
+				mutex.Unlock()
+
+				w.Header().Set("Content-Type", "application/json")
+				switch {
+				case strings.HasPrefix(r.URL.Path, "/api/v1/users/"):
+					json.NewEncoder(w).Encode(User{ID: "U1", Email: "oncall@example.com"})
+				case r.URL.Path == "/api/v1/alert_groups":
+					json.NewEncoder(w).Encode(AlertGroupResponse{})
+				default:
+					w.Write([]byte(`{}`))
+				}
+			}, config.GrafanaConfig{AuthScheme: tt.scheme})
+
+			ctx := context.Background()
+			if err := client.Ping(ctx); err != nil {
+				t.Fatalf("Ping() error = %v", err)
+			}
+			if _, err := client.GetAllAlertGroups(ctx); err != nil {
+				t.Fatalf("GetAllAlertGroups() error = %v", err)
+			}
+			if err := client.ResolveAlertGroup(ctx, "IG1"); err != nil {
+				t.Fatalf("ResolveAlertGroup() error = %v", err)
+			}
+			if err := client.UnsilenceAlertGroup(ctx, "IG1"); err != nil {
+				t.Fatalf("UnsilenceAlertGroup() error = %v", err)
+			}
+			if _, err := client.GetUser(ctx, "U1"); err != nil {
+				t.Fatalf("GetUser() error = %v", err)
+			}
+
+			for _, request := range []string{
+				"GET /api/v1/alert_groups",
+				"POST /api/v1/alert_groups/IG1/resolve",
+				"POST /api/v1/alert_groups/IG1/unsilence",
+				"GET /api/v1/users/U1",
+			} {
+				if got, sent := headers[request]; !sent || got != tt.want {
+					t.Errorf("%s sent Authorization %q, want %q", request, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		want      string
+	}{
+		{name: "default", want: version.UserAgent()},
+		{name: "override", userAgent: "irm-sync/test", want: "irm-sync/test"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mutex sync.Mutex
+			userAgents := make(map[string]string)
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				mutex.Lock()
+				userAgents[r.Method+" "+r.URL.Path] = r.Header.Get("User-Agent")
+				mutex.Unlock()
+
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{}`))
+			}, config.GrafanaConfig{UserAgent: tt.userAgent})
+
+			ctx := context.Background()
+			if _, err := client.GetAllAlertGroups(ctx); err != nil {
+				t.Fatalf("GetAllAlertGroups() error = %v", err)
+			}
+			if err := client.ResolveAlertGroup(ctx, "IG1"); err != nil {
+				t.Fatalf("ResolveAlertGroup() error = %v", err)
+			}
+
+			for _, request := range []string{"GET /api/v1/alert_groups", "POST /api/v1/alert_groups/IG1/resolve"} {
+				if got := userAgents[request]; got != tt.want {
+					t.Errorf("%s sent User-Agent %q, want %q", request, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestDoRequest(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		body         string
+		wantUser     User
+		wantStatus   int
+		wantNotFound bool
+		wantDecodeOK bool
+	}{
+		{name: "success", status: http.StatusOK, body: `{"id":"U1","email":"oncall@example.com"}`, wantUser: User{ID: "U1", Email: "oncall@example.com"}, wantDecodeOK: true},
+		{name: "not found", status: http.StatusNotFound, body: `{"detail":"Not found."}`, wantStatus: http.StatusNotFound, wantNotFound: true},
+		{name: "server error", status: http.StatusInternalServerError, body: `{"detail":"boom"}`, wantStatus: http.StatusInternalServerError},
+		{name: "invalid body", status: http.StatusOK, body: `not json`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}, config.GrafanaConfig{})
+
+			var user User
+			err := client.doRequest(context.Background(), http.MethodGet, "/api/v1/users/U1", nil, &user)
+
+			if tt.wantDecodeOK {
+				if err != nil {
+					t.Fatalf("doRequest() error = %v", err)
+				}
+				if user != tt.wantUser {
+					t.Errorf("decoded %+v, want %+v", user, tt.wantUser)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("doRequest() error = nil, want an error")
+			}
+
+			var apiErr *APIError
+			isAPIErr := errors.As(err, &apiErr)
+			if tt.wantStatus == 0 {
+				if isAPIErr {
+					t.Errorf("doRequest() error = %v, want a decoding error", err)
+				}
+				return
+			}
+			if !isAPIErr || apiErr.StatusCode != tt.wantStatus || apiErr.Body != tt.body {
+				t.Errorf("doRequest() error = %v, want an APIError with status %d and the response body", err, tt.wantStatus)
+			}
+			if errors.Is(err, ErrNotFound) != tt.wantNotFound {
+				t.Errorf("errors.Is(err, ErrNotFound) = %v, want %v", !tt.wantNotFound, tt.wantNotFound)
+			}
+		})
+	}
+}
+
+// countingTransport counts the requests going through the wrapped transport
+type countingTransport struct {
+	next     http.RoundTripper
+	requests atomic.Int32
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests.Add(1)
+	return t.next.RoundTrip(req)
+}
+
+func TestNewClientWithConfig(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(AlertGroupResponse{Results: []AlertGroup{{ID: "IG1", State: "new"}}})
+	}))
+	defer srv.Close()
+
+	transport := &countingTransport{next: srv.Client().Transport}
+	client, err := NewClientWithConfig(ClientConfig{
+		BaseURL:    srv.URL,
+		Token:      "glsa_test",
+		HTTPClient: &http.Client{Transport: transport},
+	})
+	if err != nil {
+		t.Fatalf("NewClientWithConfig() error = %v", err)
+	}
+
+	groups, err := client.GetAllAlertGroups(context.Background())
+	if err != nil {
+		t.Fatalf("GetAllAlertGroups() error = %v", err)
+	}
+	if len(groups) != 1 || groups[0].ID != "IG1" {
+		t.Errorf("GetAllAlertGroups() = %v, want the served alert group IG1", groups)
+	}
+	if got := transport.requests.Load(); got != 1 {
+		t.Errorf("injected HTTP client made %d requests, want 1", got)
+	}
+
+	if _, err := NewClientWithConfig(ClientConfig{Token: "glsa_test"}); err == nil {
+		t.Error("NewClientWithConfig() without a base URL error = nil, want an error")
+	}
+}
+
+func TestGetUserCoalescesConcurrentMisses(t *testing.T) {
+	var requests atomic.Int32
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		started <- struct{}{}
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(User{ID: "U1", Email: "oncall@example.com"})
+	}, config.GrafanaConfig{})
+
+	// The first lookup starts the fetch and is then cancelled, which must not fail the others
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := client.GetUser(leaderCtx, "U1")
+		leaderErr <- err
+	}()
+	<-started
+
+	const lookups = 20
+	emails := make(chan string, lookups)
+	for range lookups {
+		go func() {
+			user, err := client.GetUser(context.Background(), "U1")
+			if err != nil {
+				emails <- err.Error()
+				return
+			}
+			emails <- user.Email
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	cancelLeader()
+	if err := <-leaderErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled GetUser() error = %v, want context.Canceled", err)
+	}
+	close(release)
+
+	for range lookups {
+		if email := <-emails; email != "oncall@example.com" {
+			t.Errorf("GetUser() = %q, want oncall@example.com", email)
+		}
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("%d concurrent lookups made %d requests, want 1", lookups+1, got)
+	}
+}
+
+func TestRequestObserver(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(AlertGroupResponse{})
+	}, config.GrafanaConfig{})
+
+	var observed []string
+	client.SetRequestObserver(func(method, code string) {
+		observed = append(observed, method+" "+code)
+	})
+
+	if _, err := client.GetAllAlertGroups(context.Background()); err != nil {
+		t.Fatalf("GetAllAlertGroups() error = %v", err)
+	}
+	if err := client.ResolveAlertGroup(context.Background(), "IG1"); err == nil {
+		t.Fatal("ResolveAlertGroup() error = nil on a 503 response")
+	}
+	client.baseURL = "http://127.0.0.1:0"
+	if err := client.Ping(context.Background()); err == nil {
+		t.Fatal("Ping() error = nil against an unreachable server")
+	}
+
+	want := []string{"GET 200", "POST 503", "GET error"}
+	if !slices.Equal(observed, want) {
+		t.Errorf("observed requests = %v, want %v", observed, want)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(AlertGroupResponse{})
+	}))
+	defer srv.Close()
+
+	client, err := NewClientWithConfig(ClientConfig{BaseURL: srv.URL, Token: "glsa_test", RateLimit: 20, RateBurst: 1})
+	if err != nil {
+		t.Fatalf("NewClientWithConfig() error = %v", err)
+	}
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if err := client.Ping(context.Background()); err != nil {
+			t.Fatalf("Ping() error = %v", err)
+		}
+	}
+	// The burst lets the first request through, the next three wait 50ms each
+	if elapsed := time.Since(start); elapsed < 140*time.Millisecond {
+		t.Errorf("4 requests at 20/s took %v, want them throttled to at least 150ms", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := client.Ping(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Ping() with a cancelled context error = %v, want context.Canceled", err)
+	}
+	if got := requests.Load(); got != 4 {
+		t.Errorf("server received %d requests, want 4", got)
+	}
+}
+
+func TestRateLimitRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		rejections   int
+		wantErr      bool
+		wantRequests int32
+	}{
+		{name: "429 is retried until it succeeds", rejections: 2, wantRequests: 3},
+		{name: "retries are bounded", rejections: 10, wantErr: true, wantRequests: maxRateLimitRetries + 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			var bodies []string
+			var mu sync.Mutex
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				mu.Lock()
+				bodies = append(bodies, string(body))
+				mu.Unlock()
+				if requests.Add(1) <= int32(tt.rejections) {
+					w.Header().Set("Retry-After", "0")
+					http.Error(w, "slow down", http.StatusTooManyRequests)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			}, config.GrafanaConfig{})
+
+			err := client.ResolveAlertGroup(context.Background(), "IG1")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveAlertGroup() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var apiErr *APIError
+			if tt.wantErr && (!errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests) {
+				t.Errorf("ResolveAlertGroup() error = %v, want a 429 *APIError", err)
+			}
+			if got := requests.Load(); got != tt.wantRequests {
+				t.Errorf("server received %d requests, want %d", got, tt.wantRequests)
+			}
+			for _, body := range bodies {
+				if body != bodies[0] {
+					t.Errorf("retried request bodies differ: %q", bodies)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeResponse(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		contentType string
+		body        string
+		want        string
+		wantErr     string
+		wantStatus  int
+	}{
+		{name: "valid JSON", status: http.StatusOK, contentType: "application/json", body: `{"id":"IG1"}`, want: "IG1"},
+		{name: "JSON with charset", status: http.StatusOK, contentType: "application/json; charset=utf-8", body: `{"id":"IG1"}`, want: "IG1"},
+		{name: "vendor JSON type", status: http.StatusOK, contentType: "application/vnd.api+json", body: `{"id":"IG1"}`, want: "IG1"},
+		{name: "no content type", status: http.StatusOK, body: `{"id":"IG1"}`, want: "IG1"},
+		{name: "empty body", status: http.StatusOK, contentType: "application/json", body: "  \n"},
+		{name: "no content", status: http.StatusNoContent},
+		{name: "HTML page", status: http.StatusOK, contentType: "text/html", body: "<html>Bad gateway</html>", wantErr: `unexpected response content type "text/html": <html>Bad gateway</html>`},
+		{name: "invalid JSON", status: http.StatusOK, contentType: "application/json", body: `{"id":`, wantErr: "parsing response"},
+		{name: "server error", status: http.StatusBadGateway, contentType: "text/html", body: "<html>Bad gateway</html>", wantErr: "API returned status 502: <html>Bad gateway</html>", wantStatus: http.StatusBadGateway},
+		{name: "not found", status: http.StatusNotFound, contentType: "application/json", body: `{"detail":"Not found."}`, wantErr: "API returned status 404", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{
+				StatusCode: tt.status,
+				Header:     http.Header{},
+				Body:       io.NopCloser(strings.NewReader(tt.body)),
+			}
+			if tt.contentType != "" {
+				resp.Header.Set("Content-Type", tt.contentType)
+			}
+
+			var out AlertGroup
+			err := decodeResponse(resp, &out)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("decodeResponse() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				var apiErr *APIError
+				if isAPIError := errors.As(err, &apiErr); isAPIError != (tt.wantStatus != 0) {
+					t.Fatalf("decodeResponse() error is APIError = %v, want %v", isAPIError, tt.wantStatus != 0)
+				}
+				if apiErr != nil && apiErr.StatusCode != tt.wantStatus {
+					t.Errorf("APIError.StatusCode = %d, want %d", apiErr.StatusCode, tt.wantStatus)
+				}
+				if errors.Is(err, ErrNotFound) != (tt.wantStatus == http.StatusNotFound) {
+					t.Errorf("errors.Is(err, ErrNotFound) = %v for status %d", errors.Is(err, ErrNotFound), tt.status)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeResponse() error = %v", err)
+			}
+			if out.ID != tt.want {
+				t.Errorf("decoded ID = %q, want %q", out.ID, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIErrorTruncatesBody(t *testing.T) {
+	err := &APIError{StatusCode: http.StatusBadGateway, Body: strings.Repeat("x", maxBodySnippet+100)}
+	want := "API returned status 502: " + strings.Repeat("x", maxBodySnippet) + "... (truncated)"
+	if got := err.Error(); got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
+func TestGetAllAlertGroupsResponseBodies(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantErr     string
+	}{
+		{name: "empty body", contentType: "application/json"},
+		{name: "HTML page from a proxy", contentType: "text/html; charset=utf-8", body: "<html><body>Sign in</body></html>", wantErr: "<html><body>Sign in</body></html>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				io.WriteString(w, tt.body)
+			}))
+			defer srv.Close()
+			client, err := NewClientWithConfig(ClientConfig{BaseURL: srv.URL, Token: "token"})
+			if err != nil {
+				t.Fatalf("NewClientWithConfig() error = %v", err)
+			}
+
+			groups, err := client.GetAllAlertGroups(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("GetAllAlertGroups() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || len(groups) != 0 {
+				t.Errorf("GetAllAlertGroups() = %v, %v, want no groups and no error", groups, err)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := map[string]time.Duration{
+		"":                              defaultRetryAfter,
+		"soon":                          defaultRetryAfter,
+		"0":                             0,
+		"5":                             5 * time.Second,
+		"3600":                          maxRetryAfter,
+		"Mon, 01 Jan 2024 12:00:30 GMT": 30 * time.Second,
+		"Mon, 01 Jan 2024 11:00:00 GMT": 0,
+	}
+	for header, want := range tests {
+		if got := retryAfter(header, now); got != want {
+			t.Errorf("retryAfter(%q) = %v, want %v", header, got, want)
+		}
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	var mutex sync.Mutex
+	var requests []string
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		mutex.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(AlertGroupResponse{Results: []AlertGroup{{ID: "IG1", State: "new"}}})
+	}, config.GrafanaConfig{ReadOnly: true})
+
+	ctx := context.Background()
+	writes := map[string]func() error{
+		"resolve":   func() error { return client.ResolveAlertGroup(ctx, "IG1") },
+		"unsilence": func() error { return client.UnsilenceAlertGroup(ctx, "IG1") },
+	}
+	for name, write := range writes {
+		if err := write(); !errors.Is(err, config.ErrReadOnly) {
+			t.Errorf("%s error = %v, want config.ErrReadOnly", name, err)
+		}
+	}
+	if len(requests) != 0 {
+		t.Fatalf("read-only client sent %v, want no requests", requests)
+	}
+
+	// Reads still go through
+	if _, err := client.GetAllAlertGroups(ctx); err != nil {
+		t.Fatalf("GetAllAlertGroups() error = %v", err)
+	}
+	if want := []string{"GET /api/v1/alert_groups"}; !slices.Equal(requests, want) {
+		t.Errorf("requests = %v, want %v", requests, want)
+	}
+}
+
+func TestGetAlertGroup(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodGet || r.URL.Path != "/api/v1/alert_groups/IG1" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"detail":"Not found."}`))
+			return
+		}
+		json.NewEncoder(w).Encode(AlertGroup{ID: "IG1", State: "acknowledged", AlertsCount: 2})
+	}, config.GrafanaConfig{})
+	ctx := context.Background()
+
+	group, err := client.GetAlertGroup(ctx, "IG1")
+	if err != nil {
+		t.Fatalf("GetAlertGroup(IG1) error = %v", err)
+	}
+	if group.ID != "IG1" || group.State != "acknowledged" || group.AlertsCount != 2 {
+		t.Errorf("GetAlertGroup(IG1) = %+v, want the served alert group", group)
+	}
+
+	group, err = client.GetAlertGroup(ctx, "IG404")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetAlertGroup(IG404) error = %v, want ErrNotFound", err)
+	}
+	if group != nil {
+		t.Errorf("GetAlertGroup(IG404) = %+v, want nil", group)
+	}
+}
+
+func TestCreateResolutionNote(t *testing.T) {
+	var method, path string
+	var note ResolutionNote
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		if err := json.NewDecoder(r.Body).Decode(&note); err != nil {
+			t.Errorf("decoding request body: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{}`))
+	}, config.GrafanaConfig{})
+
+	if err := client.CreateResolutionNote(context.Background(), "IG1", "silenced in Alertmanager"); err != nil {
+		t.Fatalf("CreateResolutionNote() error = %v", err)
+	}
+	if method != http.MethodPost || path != "/api/v1/resolution_notes/" {
+		t.Errorf("request = %s %s, want POST /api/v1/resolution_notes/", method, path)
+	}
+	if want := (ResolutionNote{AlertGroupID: "IG1", Text: "silenced in Alertmanager"}); note != want {
+		t.Errorf("note = %+v, want %+v", note, want)
+	}
+}
+
+func TestAlertGroupCache(t *testing.T) {
+	writes := map[string]func(ctx context.Context, c *Client) error{
+		"resolve":   func(ctx context.Context, c *Client) error { return c.ResolveAlertGroup(ctx, "IG1") },
+		"unsilence": func(ctx context.Context, c *Client) error { return c.UnsilenceAlertGroup(ctx, "IG1") },
+		"resolution note": func(ctx context.Context, c *Client) error {
+			return c.CreateResolutionNote(ctx, "IG1", "resolved by alertmanager-alert-sync")
+		},
+	}
+
+	for name, write := range writes {
+		t.Run(name, func(t *testing.T) {
+			var listings atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodPost {
+					w.WriteHeader(http.StatusOK)
+					return
+				}
+				listings.Add(1)
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(AlertGroupResponse{Results: []AlertGroup{{ID: "IG1", State: "new"}}})
+			}))
+			defer srv.Close()
+
+			client, err := NewClientWithConfig(ClientConfig{BaseURL: srv.URL, Token: "glsa_test", AlertGroupCacheTTL: time.Minute})
+			if err != nil {
+				t.Fatalf("NewClientWithConfig() error = %v", err)
+			}
+			ctx := context.Background()
+
+			for i := 0; i < 3; i++ {
+				groups, err := client.GetAllAlertGroups(ctx)
+				if err != nil || len(groups) != 1 {
+					t.Fatalf("GetAllAlertGroups() = %v, %v, want the served group", groups, err)
+				}
+			}
+			if got := listings.Load(); got != 1 {
+				t.Errorf("alert groups fetched %d times within the TTL, want 1", got)
+			}
+
+			if err := write(ctx, client); err != nil {
+				t.Fatalf("%s error = %v", name, err)
+			}
+			if _, err := client.GetAllAlertGroups(ctx); err != nil {
+				t.Fatalf("GetAllAlertGroups() error = %v", err)
+			}
+			if got := listings.Load(); got != 2 {
+				t.Errorf("alert groups fetched %d times after a %s, want the cache invalidated", got, name)
+			}
+		})
+	}
+}
+
+func TestAlertGroupCacheExpiry(t *testing.T) {
+	var listings atomic.Int32
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		listings.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(AlertGroupResponse{})
+	}, config.GrafanaConfig{AlertGroupCacheTTL: time.Minute})
+	ctx := context.Background()
+
+	if _, err := client.GetAllAlertGroups(ctx); err != nil {
+		t.Fatalf("GetAllAlertGroups() error = %v", err)
+	}
+	client.alertGroupCacheMutex.Lock()
+	for path, entry := range client.alertGroupCache {
+		entry.fetchedAt = entry.fetchedAt.Add(-2 * time.Minute)
+		client.alertGroupCache[path] = entry
+	}
+	client.alertGroupCacheMutex.Unlock()
+
+	if _, err := client.GetAllAlertGroups(ctx); err != nil {
+		t.Fatalf("GetAllAlertGroups() error = %v", err)
+	}
+	if got := listings.Load(); got != 2 {
+		t.Errorf("alert groups fetched %d times, want a refetch once the TTL expired", got)
+	}
+}
+
+func TestGetAllAlertGroupsPagination(t *testing.T) {
+	tests := []struct {
+		name string
+		// pages holds the alert group IDs served on each page
+		pages [][]string
+		// failPage answers the given page with a 500 (0 never fails)
+		failPage    int
+		want        []string
+		wantErr     bool
+		wantPartial bool
+	}{
+		{name: "single page", pages: [][]string{{"IG1", "IG2"}}, want: []string{"IG1", "IG2"}},
+		{name: "several pages", pages: [][]string{{"IG1"}, {"IG2"}, {"IG3"}}, want: []string{"IG1", "IG2", "IG3"}},
+		{name: "no alert groups", pages: [][]string{{}}},
+		{name: "first page fails", pages: [][]string{{"IG1"}, {"IG2"}}, failPage: 1, wantErr: true},
+		{name: "later page fails", pages: [][]string{{"IG1"}, {"IG2"}, {"IG3"}}, failPage: 3, want: []string{"IG1", "IG2"}, wantErr: true, wantPartial: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				page := 1
+				if value := r.URL.Query().Get("page"); value != "" {
+					fmt.Sscanf(value, "%d", &page)
+				}
+				if page == tt.failPage || page > len(tt.pages) {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				response := AlertGroupResponse{CurrentPageNumber: page, TotalPages: len(tt.pages)}
+				for _, id := range tt.pages[page-1] {
+					response.Results = append(response.Results, AlertGroup{ID: id})
+				}
+				if page < len(tt.pages) {
+					response.Next = fmt.Sprintf("https://grafana.example.com%s/?page=%d", alertGroupsEndpoint, page+1)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(response)
+			}, config.GrafanaConfig{})
+
+			groups, err := client.GetAllAlertGroups(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetAllAlertGroups() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if errors.Is(err, ErrPartialResults) != tt.wantPartial {
+				t.Errorf("errors.Is(err, ErrPartialResults) = %v, want %v (err: %v)", errors.Is(err, ErrPartialResults), tt.wantPartial, err)
+			}
+
+			var got []string
+			for _, group := range groups {
+				got = append(got, group.ID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("GetAllAlertGroups() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetAllAlertGroupsFollowsNext(t *testing.T) {
+	// Cursor pagination: the next URL carries a cursor, the page size and the listing filters,
+	// and points at Grafana's public URL rather than the configured one
+	var queries []string
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.RawQuery)
+		response := AlertGroupResponse{Results: []AlertGroup{{ID: "IG1"}}}
+		if r.URL.Query().Get("cursor") == "" {
+			response.Next = "https://irm.example.com/api/v1/alert_groups/?cursor=c2&perpage=50&state=new"
+		} else {
+			response.Results = []AlertGroup{{ID: "IG2"}}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}, config.GrafanaConfig{})
+
+	groups, err := client.GetAllAlertGroups(context.Background())
+	if err != nil {
+		t.Fatalf("GetAllAlertGroups() error = %v", err)
+	}
+	if len(groups) != 2 || groups[1].ID != "IG2" {
+		t.Errorf("GetAllAlertGroups() = %v, want IG1 and IG2", groups)
+	}
+	if want := []string{"", "cursor=c2&perpage=50&state=new"}; !slices.Equal(queries, want) {
+		t.Errorf("requested queries = %q, want %q", queries, want)
+	}
+}
+
+func TestGetAllAlertGroupsMaxPages(t *testing.T) {
+	var requests atomic.Int32
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		page := requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(AlertGroupResponse{
+			Results: []AlertGroup{{ID: fmt.Sprintf("IG%d", page)}},
+			Next:    fmt.Sprintf("https://grafana.example.com%s/?page=%d", alertGroupsEndpoint, page+1),
+		})
+	}, config.GrafanaConfig{AlertGroupCacheTTL: time.Minute})
+
+	groups, err := client.GetAllAlertGroups(context.Background())
+	if !errors.Is(err, ErrPartialResults) {
+		t.Fatalf("GetAllAlertGroups() error = %v, want ErrPartialResults past %d pages", err, maxAlertGroupPages)
+	}
+	if len(groups) != maxAlertGroupPages {
+		t.Errorf("GetAllAlertGroups() returned %d groups, want the %d of the pages fetched", len(groups), maxAlertGroupPages)
+	}
+
+	// Truncated listings are not cached
+	if _, err := client.GetAllAlertGroups(context.Background()); !errors.Is(err, ErrPartialResults) {
+		t.Fatalf("second GetAllAlertGroups() error = %v, want ErrPartialResults", err)
+	}
+	if got := requests.Load(); got != 2*maxAlertGroupPages {
+		t.Errorf("made %d requests, want %d: the truncated listing must be fetched again", got, 2*maxAlertGroupPages)
+	}
+}
+
+func TestGetAllAlertGroupsCachesCompleteResults(t *testing.T) {
+	tests := []struct {
+		name         string
+		failPage2    bool
+		wantRequests int32
+	}{
+		{name: "complete results are reused", wantRequests: 2},
+		{name: "partial results are fetched again", failPage2: true, wantRequests: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				w.Header().Set("Content-Type", "application/json")
+				if r.URL.Query().Get("page") == "2" {
+					if tt.failPage2 {
+						w.WriteHeader(http.StatusInternalServerError)
+						return
+					}
+					json.NewEncoder(w).Encode(AlertGroupResponse{Results: []AlertGroup{{ID: "IG2"}}})
+					return
+				}
+				json.NewEncoder(w).Encode(AlertGroupResponse{
+					Results: []AlertGroup{{ID: "IG1"}},
+					Next:    "https://grafana.example.com" + alertGroupsEndpoint + "/?page=2",
+				})
+			}, config.GrafanaConfig{AlertGroupCacheTTL: time.Minute})
+
+			for range 2 {
+				_, err := client.GetAllAlertGroups(context.Background())
+				if (err != nil) != tt.failPage2 {
+					t.Fatalf("GetAllAlertGroups() error = %v, want error %v", err, tt.failPage2)
+				}
+			}
+			if got := requests.Load(); got != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", got, tt.wantRequests)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package grafana
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/config"
+)
+
+// maxBodySnippet is the number of response body bytes included in error messages
+const maxBodySnippet = 512
+
+// ErrNotFound is matched (via errors.Is) by API errors with a 404 status
+var ErrNotFound = errors.New("not found")
+
+// ErrReadOnly is returned instead of sending a request that would modify Grafana IRM in read-only mode
+// Both API clients return config.ErrReadOnly, so either refusal matches it
+var ErrReadOnly = config.ErrReadOnly
+
+// ErrPartialResults is matched (via errors.Is) when a paginated listing failed after some pages were fetched
+// The results fetched so far are returned alongside the error
+var ErrPartialResults = errors.New("partial results")
+
+// APIError is returned when the Grafana IRM API responds with a non-success status
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+// Error implements the error interface
+// Long bodies (e.g. HTML error pages from a proxy) are truncated
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API returned status %d: %s", e.StatusCode, bodySnippet(e.Body))
+}
+
+// bodySnippet returns the trimmed body, truncated to maxBodySnippet bytes
+func bodySnippet(body string) string {
+	body = strings.TrimSpace(body)
+	if len(body) <= maxBodySnippet {
+		return body
+	}
+	return body[:maxBodySnippet] + "... (truncated)"
+}
+
+// Is reports whether the API error matches target, so errors.Is(err, ErrNotFound) works for 404s
+func (e *APIError) Is(target error) bool {
+	return target == ErrNotFound && e.StatusCode == http.StatusNotFound
+}
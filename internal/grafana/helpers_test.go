@@ -0,0 +1,27 @@
+package grafana
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/config"
+)
+
+// newTestClient starts a fake Grafana IRM API and returns a client pointed at it
+// The configuration's URL is replaced by the fake's and a test token is used when none is set
+func newTestClient(t *testing.T, handler http.HandlerFunc, cfg config.GrafanaConfig) *Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	cfg.URL = srv.URL
+	if cfg.Token == "" {
+		cfg.Token = "glsa_test"
+	}
+	client, err := NewClient(cfg)
+	if err != nil {
+		t.Fatalf("creating grafana client: %v", err)
+	}
+	return client
+}
@@ -2,9 +2,19 @@ package grafana
 
 import (
 	"encoding/json"
+	"strings"
 	"time"
 )
 
+// Alert group states reported by Grafana IRM
+const (
+	AlertGroupStateNew          = "new"
+	AlertGroupStateAcknowledged = "acknowledged"
+	AlertGroupStateSilenced     = "silenced"
+	// AlertGroupStateResolved is the state of a resolved alert group
+	AlertGroupStateResolved = "resolved"
+)
+
 // NullableTime represents a time that can be null or empty in JSON
 type NullableTime struct {
 	Time  time.Time
@@ -64,6 +74,12 @@ type User struct {
 	Username  string `json:"username,omitempty"`
 }
 
+// ResolutionNote is a note attached to an alert group explaining its resolution
+type ResolutionNote struct {
+	AlertGroupID string `json:"alert_group_id"`
+	Text         string `json:"text"`
+}
+
 // AlertGroupResponse represents the response from Grafana IRM alert groups endpoint
 type AlertGroupResponse struct {
 	Count             int          `json:"count,omitempty"`
@@ -97,6 +113,12 @@ type AlertGroup struct {
 	LastAlert      LastAlert     `json:"last_alert,omitempty"`
 }
 
+// IsResolved reports whether the alert group is currently resolved
+// It only looks at the current state: a reopened group keeps its resolved_at but is firing again
+func (g AlertGroup) IsResolved() bool {
+	return strings.EqualFold(g.State, AlertGroupStateResolved)
+}
+
 
 
 // Permalinks contains various URLs to access the alert group
@@ -142,14 +164,8 @@ type Alert struct {
 	GeneratorURL string       `json:"generatorURL,omitempty"`
 }
 
-// Labels contains alert labels
-type Labels struct {
-	Cluster         string `json:"cluster,omitempty"`
-	Severity        string `json:"severity,omitempty"`
-	Alertname       string `json:"alertname,omitempty"`
-	Component       string `json:"component,omitempty"`
-	ClusterProvider string `json:"cluster_provider,omitempty"`
-}
+// Labels contains the full set of alert labels keyed by label name
+type Labels map[string]string
 
 // Annotations contains alert annotations
 type Annotations struct {
@@ -0,0 +1,58 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+)
+
+// contextKey is the context key under which the correlation ID is stored
+type contextKey struct{}
+
+// NewID generates a short random correlation ID
+func NewID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "00000000"
+	}
+	return hex.EncodeToString(b)
+}
+
+// WithID returns a copy of ctx carrying the correlation ID
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// ID returns the correlation ID stored in ctx, or an empty string if there is none
+func ID(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// EnsureID returns ctx unchanged if it already carries a correlation ID, or a copy with a new one
+func EnsureID(ctx context.Context) context.Context {
+	if ID(ctx) != "" {
+		return ctx
+	}
+	return WithID(ctx, NewID())
+}
+
+// Printf logs like log.Printf, prefixing the message with the correlation ID from ctx
+func Printf(ctx context.Context, format string, args ...interface{}) {
+	log.Print(prefix(ctx) + fmt.Sprintf(format, args...))
+}
+
+// Println logs like log.Println, prefixing the message with the correlation ID from ctx
+func Println(ctx context.Context, args ...interface{}) {
+	log.Print(prefix(ctx) + fmt.Sprintln(args...))
+}
+
+// prefix returns the log prefix for the correlation ID in ctx
+func prefix(ctx context.Context) string {
+	if id := ID(ctx); id != "" {
+		return "[" + id + "] "
+	}
+	return ""
+}
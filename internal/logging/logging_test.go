@@ -0,0 +1,61 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"testing"
+)
+
+func TestEnsureID(t *testing.T) {
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		wantID string
+	}{
+		{name: "keeps an existing ID", ctx: WithID(context.Background(), "abcd1234"), wantID: "abcd1234"},
+		{name: "adds a missing ID", ctx: context.Background()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := ID(EnsureID(tt.ctx))
+			if tt.wantID != "" && id != tt.wantID {
+				t.Errorf("ID() = %q, want %q", id, tt.wantID)
+			}
+			if len(id) != 8 {
+				t.Errorf("ID() = %q, want an 8 character ID", id)
+			}
+		})
+	}
+}
+
+func TestPrintf(t *testing.T) {
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{name: "with correlation ID", ctx: WithID(context.Background(), "abcd1234"), want: "[abcd1234] resolved 2 groups\n"},
+		{name: "without correlation ID", ctx: context.Background(), want: "resolved 2 groups\n"},
+	}
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	t.Cleanup(func() {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(log.LstdFlags)
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			Printf(tt.ctx, "resolved %d groups", 2)
+			if buf.String() != tt.want {
+				t.Errorf("Printf() logged %q, want %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
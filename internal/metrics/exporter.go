@@ -2,17 +2,34 @@ package metrics
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
-	"os"
+	"maps"
+	"slices"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
 
 	"github.com/gabrielpetry/alertmanager-alert-sync/internal/alertmanager"
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/config"
 	"github.com/gabrielpetry/alertmanager-alert-sync/internal/grafana"
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/logging"
 	"github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/prometheus/alertmanager/pkg/labels"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+)
+
+// Alert states exported in the state label of the alert state metric
+// The first three mirror Alertmanager's alert states; unknown covers alerts without a state
+const (
+	alertStateActive      = "active"
+	alertStateSuppressed  = "suppressed"
+	alertStateUnprocessed = "unprocessed"
+	alertStateUnknown     = "unknown"
 )
 
 // Exporter handles Prometheus metrics for alert reconciliation
@@ -21,96 +38,306 @@ type Exporter struct {
 	reconciliationTotal          prometheus.Counter
 	reconciliationFailuresTotal  prometheus.Counter
 	reconciliationDuration       prometheus.Histogram
+	reconciliationPhaseDuration  *prometheus.HistogramVec
 	inconsistenciesFound         prometheus.Gauge
+	inconsistenciesByReason      *prometheus.GaugeVec
 	inconsistenciesResolved      prometheus.Counter
 	inconsistenciesFailedResolve prometheus.Counter
+	resolutionsSkipped           *prometheus.CounterVec
+	protectedSkippedTotal        prometheus.Counter
 	lastReconciliationTime       prometheus.Gauge
 	lastReconciliationSuccess    prometheus.Gauge
+	lastSuccessTime              prometheus.Gauge
+	reconcileIgnoredTotal        prometheus.Counter
+	grafanaCircuitOpenTotal      prometheus.Counter
+	reconcileBackoff             prometheus.Gauge
+	reconcileLoopHeartbeat       prometheus.Counter
+	orphanedSilences             prometheus.Gauge
+	grafanaEnabled               prometheus.Gauge
+	truncatedAlertsTotal         prometheus.Counter
+	droppedAlertsTotal           prometheus.Counter
+	grafanaGroupAlertCount       prometheus.Histogram
 
 	// Alert state metrics
 	alertStateGauge          *prometheus.GaugeVec
+	alertsByReceiver         *prometheus.GaugeVec
+	alertUpdatedTime         *prometheus.GaugeVec
+	alertSilenceCount        *prometheus.GaugeVec
+	resolvedAlertGauge       *prometheus.GaugeVec
+	alertGroupStateGauge     *prometheus.GaugeVec
 	alertExportTotal         prometheus.Counter
 	alertExportFailuresTotal prometheus.Counter
 	lastAlertExportTime      prometheus.Gauge
 
+	// Cache metrics
+	silenceCacheSize prometheus.Gauge
+	userCacheSize    prometheus.Gauge
+
+	// Webhook metrics
+	webhookEventsTotal  *prometheus.CounterVec
+	webhookCallersTotal *prometheus.CounterVec
+
+	// Silence metrics
+	silencesCreatedTotal prometheus.Counter
+	silencesExpiredTotal prometheus.Counter
+
+	// API client metrics
+	apiRequestsTotal *prometheus.CounterVec
+
 	// Configuration for alert labels
+	primaryLabel     string
 	alertLabels      []string
 	alertAnnotations []string
+	// annotationLabels maps each exported annotation to its metric label name,
+	// prefixed with annotationLabelPrefix when it collides with another label
+	annotationLabels map[string]string
+
+	// fields maps extra labels to the label and annotation sources tried in order for their value
+	fields      map[string][]fieldSource
+	fieldLabels []string
+
+	// exportMutex serializes exports, which reset and repopulate the shared alert gauges
+	exportMutex sync.Mutex
+
+	// disabledDefaultLabels holds the default labels left out of the alert state metric
+	disabledDefaultLabels []string
+
+	// silenceComment adds the silence_comment label, truncated to silenceCommentMaxLength characters
+	silenceComment          bool
+	silenceCommentMaxLength int
+
+	// maxLabelValueLength caps the length of every alert state label value
+	maxLabelValueLength int
+
+	// exportFilter selects the alerts exported as metrics (every alert when empty)
+	exportFilter labels.Matchers
+
+	// firingAlerts maps the fingerprints of the alerts firing at the previous export to their
+	// primary label value, so alerts Alertmanager no longer returns can be exported as resolved
+	firingAlerts map[string]string
 }
 
+// annotationLabelPrefix namespaces annotation labels that share a name with another metric label
+const annotationLabelPrefix = "annotation_"
+
 // NewExporter creates and initializes a new metrics exporter for reconciliation
-func NewExporter() *Exporter {
+func NewExporter(cfg config.MetricsConfig, tenant config.TenantConfig) *Exporter {
 	log.Println("Initializing reconciliation metrics...")
 
+	// Every metric name starts with the configured prefix, alertmanager_sync by default
+	prefix := cfg.MetricPrefix
+	if prefix == "" {
+		prefix = config.DefaultMetricPrefix
+	}
+
 	reconciliationTotal := promauto.NewCounter(
 		prometheus.CounterOpts{
-			Name: "alertmanager_sync_reconciliation_total",
-			Help: "Total number of reconciliation attempts",
+			Namespace: prefix,
+			Name:      "reconciliation_total",
+			Help:      "Total number of reconciliation attempts",
 		},
 	)
 
 	reconciliationFailuresTotal := promauto.NewCounter(
 		prometheus.CounterOpts{
-			Name: "alertmanager_sync_reconciliation_failures_total",
-			Help: "Total number of failed reconciliation attempts",
+			Namespace: prefix,
+			Name:      "reconciliation_failures_total",
+			Help:      "Total number of failed reconciliation attempts",
 		},
 	)
 
 	reconciliationDuration := promauto.NewHistogram(
 		prometheus.HistogramOpts{
-			Name:    "alertmanager_sync_reconciliation_duration_seconds",
-			Help:    "Duration of reconciliation operations in seconds",
-			Buckets: prometheus.DefBuckets,
+			Namespace: prefix,
+			Name:      "reconciliation_duration_seconds",
+			Help:      "Duration of reconciliation operations in seconds",
+			Buckets:   prometheus.DefBuckets,
 		},
 	)
 
+	reconciliationPhaseDuration := promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: prefix,
+			Name:      "reconciliation_phase_duration_seconds",
+			Help:      "Duration of each reconciliation phase in seconds",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"phase"},
+	)
+
 	inconsistenciesFound := promauto.NewGauge(
 		prometheus.GaugeOpts{
-			Name: "alertmanager_sync_inconsistencies_found",
-			Help: "Number of inconsistencies found in last reconciliation",
+			Namespace: prefix,
+			Name:      "inconsistencies_found",
+			Help:      "Number of inconsistencies found in last reconciliation",
 		},
 	)
 
+	inconsistenciesByReason := promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: prefix,
+			Name:      "inconsistencies_by_reason",
+			Help:      "Number of inconsistencies found in last reconciliation by reason",
+		},
+		[]string{"reason"},
+	)
+
 	inconsistenciesResolved := promauto.NewCounter(
 		prometheus.CounterOpts{
-			Name: "alertmanager_sync_inconsistencies_resolved_total",
-			Help: "Total number of inconsistencies successfully resolved",
+			Namespace: prefix,
+			Name:      "inconsistencies_resolved_total",
+			Help:      "Total number of inconsistencies successfully resolved",
 		},
 	)
 
 	inconsistenciesFailedResolve := promauto.NewCounter(
 		prometheus.CounterOpts{
-			Name: "alertmanager_sync_inconsistencies_failed_resolve_total",
-			Help: "Total number of inconsistencies that failed to resolve",
+			Namespace: prefix,
+			Name:      "inconsistencies_failed_resolve_total",
+			Help:      "Total number of inconsistencies that failed to resolve",
+		},
+	)
+
+	resolutionsSkipped := promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: prefix,
+			Name:      "resolutions_skipped_total",
+			Help:      "Total number of inconsistencies deliberately left unresolved by reason",
+		},
+		[]string{"reason"},
+	)
+
+	protectedSkippedTotal := promauto.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: prefix,
+			Name:      "protected_skipped_total",
+			Help:      "Total number of inconsistencies left unresolved because their alertname is protected",
 		},
 	)
 
 	lastReconciliationTime := promauto.NewGauge(
 		prometheus.GaugeOpts{
-			Name: "alertmanager_sync_last_reconciliation_timestamp_seconds",
-			Help: "Timestamp of the last reconciliation attempt (Unix time)",
+			Namespace: prefix,
+			Name:      "last_reconciliation_timestamp_seconds",
+			Help:      "Timestamp of the last reconciliation attempt (Unix time)",
 		},
 	)
 
 	lastReconciliationSuccess := promauto.NewGauge(
 		prometheus.GaugeOpts{
-			Name: "alertmanager_sync_last_reconciliation_success",
-			Help: "Whether the last reconciliation was successful (1=success, 0=failure)",
+			Namespace: prefix,
+			Name:      "last_reconciliation_success",
+			Help:      "Whether the last reconciliation was successful (1=success, 0=failure)",
+		},
+	)
+
+	lastSuccessTime := promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: prefix,
+			Name:      "last_success_timestamp_seconds",
+			Help:      "Timestamp of the last successful reconciliation (Unix time)",
+		},
+	)
+
+	reconcileIgnoredTotal := promauto.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: prefix,
+			Name:      "reconcile_ignored_total",
+			Help:      "Total number of silenced alerts excluded from reconciliation by the ignore label",
+		},
+	)
+
+	grafanaCircuitOpenTotal := promauto.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: prefix,
+			Name:      "grafana_circuit_open_total",
+			Help:      "Total number of times the Grafana circuit breaker opened",
+		},
+	)
+
+	reconcileBackoff := promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: prefix,
+			Name:      "reconcile_backoff_seconds",
+			Help:      "Extra delay added to the reconciliation interval after consecutive failed cycles (0 when healthy)",
 		},
 	)
 
-	// Parse alert labels and annotations from environment
-	alertLabels := parseEnvList("ALERTMANAGER_ALERTS_LABELS")
-	alertAnnotations := parseEnvList("ALERTMANAGER_ALERTS_ANNOTATIONS")
+	orphanedSilences := promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: prefix,
+			Name:      "orphaned_silences",
+			Help:      "Number of silences created by this tool whose Grafana IRM alert group is resolved or gone, found in the last reconciliation",
+		},
+	)
 
-	// Default labels that are always included
-	defaultLabels := []string{"alertname", "fingerprint", "suppressed", "acknowledged_by", "resolved_by", "silenced_by", "inhibited_by", "alert_group_id", "acknowledged_at", "created_at", "resolved_at"}
+	grafanaEnabled := promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: prefix,
+			Name:      "grafana_enabled",
+			Help:      "Whether the Grafana IRM integration is active (1) or disabled because it is not configured or failed to initialize (0)",
+		},
+	)
+
+	reconcileLoopHeartbeat := promauto.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: prefix,
+			Name:      "reconcile_loop_heartbeat_total",
+			Help:      "Total number of reconciliation loop ticks; a flat value means the loop stopped",
+		},
+	)
 
-	// Combine all labels for the metric
-	allLabels := append(defaultLabels, alertLabels...)
-	allLabels = append(allLabels, alertAnnotations...)
+	truncatedAlertsTotal := promauto.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: prefix,
+			Name:      "truncated_alerts_total",
+			Help:      "Total number of alerts truncated from Grafana IRM alert group payloads seen during reconciliation",
+		},
+	)
+
+	droppedAlertsTotal := promauto.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: prefix,
+			Name:      "alertmanager_alerts_dropped_total",
+			Help:      "Total number of Alertmanager alerts dropped because a response exceeded ALERTMANAGER_MAX_ALERTS",
+		},
+	)
+
+	grafanaGroupAlertCount := promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: prefix,
+			Name:      "grafana_group_alert_count",
+			Help:      "Number of alerts in each Grafana IRM alert group, observed every reconciliation",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 11),
+		},
+	)
+
+	// Alert labels and annotations to export as metric labels
+	primaryLabel := cfg.PrimaryLabel
+	if primaryLabel == "" {
+		primaryLabel = "alertname"
+	}
+
+	// Default labels, starting with the primary identity label which is always included
+	defaultLabels, disabledDefaultLabels := selectDefaultLabels(cfg.DefaultLabels)
+	defaultLabels = append([]string{primaryLabel}, defaultLabels...)
+
+	if cfg.SilenceCommentLabel {
+		defaultLabels = append(defaultLabels, config.SilenceCommentLabelName)
+	}
+
+	// Combine all labels for the metric, skipping duplicates so the label set stays valid
+	metricLabels := newAlertLabelSet(defaultLabels, withoutLabel(cfg.AlertLabels, primaryLabel), cfg.AlertAnnotations, slices.Sorted(maps.Keys(cfg.Fields)))
+	alertLabels, alertAnnotations, fieldLabels, allLabels := metricLabels.labels, metricLabels.annotations, metricLabels.fields, metricLabels.all
+
+	// Fields with a fallback chain
+	fields := make(map[string][]fieldSource, len(fieldLabels))
+	for _, field := range fieldLabels {
+		fields[field] = parseFieldSources(cfg.Fields[field])
+	}
 
 	log.Printf("Alert export configuration:")
+	log.Printf("  - Primary label: %s", primaryLabel)
 	log.Printf("  - Alert labels to export: %v", alertLabels)
 	log.Printf("  - Alert annotations to export: %v", alertAnnotations)
 	log.Printf("  - All metric labels: %v", allLabels)
@@ -118,71 +345,393 @@ func NewExporter() *Exporter {
 	// Create alert state gauge
 	alertStateGauge := promauto.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Name: "alertmanager_sync_alert_state",
-			Help: "Current state of alerts from Alertmanager (1=active, value indicates if suppressed)",
+			Namespace: prefix,
+			Name:      "alert_state",
+			Help:      "Current state of alerts from Alertmanager (1=active, 0=suppressed, unprocessed or unknown; see the state label)",
 		},
 		allLabels,
 	)
 
+	resolvedAlertGauge := promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: prefix,
+			Name:      "resolved_alert",
+			Help:      "Time recently resolved alerts still returned by Alertmanager ended (Unix time)",
+		},
+		[]string{primaryLabel, "fingerprint"},
+	)
+
+	// The alert group rollup is optional, it is only registered when enabled
+	var alertGroupStateGauge *prometheus.GaugeVec
+	if cfg.AlertGroupState {
+		alertGroupStateGauge = promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: prefix,
+				Name:      "alert_group_state",
+				Help:      "Number of active Alertmanager alerts in each Grafana IRM alert group, by the group's IRM state",
+			},
+			[]string{"alert_group_id", "group_key", "state"},
+		)
+	}
+
+	alertsByReceiver := promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: prefix,
+			Name:      "alerts_by_receiver",
+			Help:      "Number of alerts routed to each Alertmanager receiver",
+		},
+		[]string{"receiver"},
+	)
+
+	alertUpdatedTime := promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: prefix,
+			Name:      "alert_updated_timestamp_seconds",
+			Help:      "Time Alertmanager last updated each alert (Unix time), to detect alerts that stopped being re-sent",
+		},
+		[]string{"fingerprint"},
+	)
+
+	alertSilenceCount := promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: prefix,
+			Name:      "alert_silence_count",
+			Help:      "Number of silences suppressing each alert",
+		},
+		[]string{"fingerprint"},
+	)
+
 	alertExportTotal := promauto.NewCounter(
 		prometheus.CounterOpts{
-			Name: "alertmanager_sync_alert_export_total",
-			Help: "Total number of alert export attempts",
+			Namespace: prefix,
+			Name:      "alert_export_total",
+			Help:      "Total number of alert export attempts",
 		},
 	)
 
 	alertExportFailuresTotal := promauto.NewCounter(
 		prometheus.CounterOpts{
-			Name: "alertmanager_sync_alert_export_failures_total",
-			Help: "Total number of failed alert export attempts",
+			Namespace: prefix,
+			Name:      "alert_export_failures_total",
+			Help:      "Total number of failed alert export attempts",
 		},
 	)
 
 	lastAlertExportTime := promauto.NewGauge(
 		prometheus.GaugeOpts{
-			Name: "alertmanager_sync_last_alert_export_timestamp_seconds",
-			Help: "Timestamp of the last alert export (Unix time)",
+			Namespace: prefix,
+			Name:      "last_alert_export_timestamp_seconds",
+			Help:      "Timestamp of the last alert export (Unix time)",
+		},
+	)
+
+	silenceCacheSize := promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: prefix,
+			Name:      "silence_cache_size",
+			Help:      "Number of Alertmanager silences currently cached",
+		},
+	)
+
+	userCacheSize := promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: prefix,
+			Name:      "user_cache_size",
+			Help:      "Number of Grafana IRM users currently cached",
+		},
+	)
+
+	webhookCallersTotal := promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: prefix,
+			Name:      "webhook_requests_by_caller_total",
+			Help:      "Total number of webhook requests by authenticated basic auth user (unauthorized for failed authentication)",
+		},
+		[]string{"caller"},
+	)
+
+	webhookEventsTotal := promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: prefix,
+			Name:      "webhook_events_total",
+			Help:      "Total number of Grafana IRM webhook events received by event type and outcome",
+		},
+		[]string{"event_type", "outcome"},
+	)
+
+	silencesCreatedTotal := promauto.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: prefix,
+			Name:      "silences_created_total",
+			Help:      "Total number of Alertmanager silences created",
+		},
+	)
+
+	silencesExpiredTotal := promauto.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: prefix,
+			Name:      "silences_expired_total",
+			Help:      "Total number of Alertmanager silences expired",
+		},
+	)
+
+	apiRequestsTotal := promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: prefix,
+			Name:      "api_requests_total",
+			Help:      "Total number of API requests made to each backend by HTTP method and status code",
 		},
+		[]string{"backend", "method", "code"},
 	)
 
+	var exportFilter labels.Matchers
+	if cfg.ExportFilter != "" {
+		matchers, err := labels.ParseMatchers(cfg.ExportFilter)
+		if err != nil {
+			log.Printf("Warning: invalid export filter '%s', exporting every alert: %v", cfg.ExportFilter, err)
+		} else {
+			exportFilter = matchers
+		}
+	}
+	// Scoping to a tenant is an extra equality matcher, which also excludes alerts without the label
+	if tenant.Label != "" {
+		matcher, err := labels.NewMatcher(labels.MatchEqual, tenant.Label, tenant.Value)
+		if err != nil {
+			log.Printf("Warning: invalid tenant %s=%s, exporting alerts of every tenant: %v", tenant.Label, tenant.Value, err)
+		} else {
+			exportFilter = append(exportFilter, matcher)
+		}
+	}
+	if len(exportFilter) > 0 {
+		log.Printf("Exporting only alerts matching %s", exportFilter)
+	}
+
 	return &Exporter{
 		reconciliationTotal:          reconciliationTotal,
 		reconciliationFailuresTotal:  reconciliationFailuresTotal,
 		reconciliationDuration:       reconciliationDuration,
+		reconciliationPhaseDuration:  reconciliationPhaseDuration,
 		inconsistenciesFound:         inconsistenciesFound,
+		inconsistenciesByReason:      inconsistenciesByReason,
 		inconsistenciesResolved:      inconsistenciesResolved,
 		inconsistenciesFailedResolve: inconsistenciesFailedResolve,
+		resolutionsSkipped:           resolutionsSkipped,
+		protectedSkippedTotal:        protectedSkippedTotal,
 		lastReconciliationTime:       lastReconciliationTime,
 		lastReconciliationSuccess:    lastReconciliationSuccess,
+		lastSuccessTime:              lastSuccessTime,
+		reconcileIgnoredTotal:        reconcileIgnoredTotal,
+		grafanaCircuitOpenTotal:      grafanaCircuitOpenTotal,
+		reconcileBackoff:             reconcileBackoff,
+		reconcileLoopHeartbeat:       reconcileLoopHeartbeat,
+		orphanedSilences:             orphanedSilences,
+		grafanaEnabled:               grafanaEnabled,
+		truncatedAlertsTotal:         truncatedAlertsTotal,
+		droppedAlertsTotal:           droppedAlertsTotal,
+		grafanaGroupAlertCount:       grafanaGroupAlertCount,
 		alertStateGauge:              alertStateGauge,
+		alertsByReceiver:             alertsByReceiver,
+		alertUpdatedTime:             alertUpdatedTime,
+		alertSilenceCount:            alertSilenceCount,
+		resolvedAlertGauge:           resolvedAlertGauge,
+		alertGroupStateGauge:         alertGroupStateGauge,
 		alertExportTotal:             alertExportTotal,
 		alertExportFailuresTotal:     alertExportFailuresTotal,
 		lastAlertExportTime:          lastAlertExportTime,
+		silenceCacheSize:             silenceCacheSize,
+		userCacheSize:                userCacheSize,
+		webhookEventsTotal:           webhookEventsTotal,
+		webhookCallersTotal:          webhookCallersTotal,
+		silencesCreatedTotal:         silencesCreatedTotal,
+		silencesExpiredTotal:         silencesExpiredTotal,
+		apiRequestsTotal:             apiRequestsTotal,
+		primaryLabel:                 primaryLabel,
 		alertLabels:                  alertLabels,
 		alertAnnotations:             alertAnnotations,
+		annotationLabels:             metricLabels.annotationLabels,
+		disabledDefaultLabels:        disabledDefaultLabels,
+		fields:                       fields,
+		fieldLabels:                  fieldLabels,
+		silenceComment:               cfg.SilenceCommentLabel,
+		silenceCommentMaxLength:      cfg.SilenceCommentMaxLength,
+		maxLabelValueLength:          cfg.MaxLabelValueLength,
+		exportFilter:                 exportFilter,
+	}
+}
+
+// alertLabelSet is the label set of the alert state metric
+type alertLabelSet struct {
+	// all lists every metric label name, in registration order
+	all []string
+	// labels, annotations and fields are the alert labels, annotations and fields exported
+	labels      []string
+	annotations []string
+	fields      []string
+	// annotationLabels maps each exported annotation to its metric label name
+	annotationLabels map[string]string
+}
+
+// newAlertLabelSet combines the default labels with the extra alert labels, annotations and fields
+// Alert labels colliding with a default label are dropped; annotations colliding with any
+// other label are exported with annotationLabelPrefix, or dropped if that collides too;
+// fields colliding with any other label are dropped
+func newAlertLabelSet(defaultLabels, alertLabels, alertAnnotations, fields []string) alertLabelSet {
+	set := alertLabelSet{
+		all:              append([]string{}, defaultLabels...),
+		labels:           make([]string, 0, len(alertLabels)),
+		annotations:      make([]string, 0, len(alertAnnotations)),
+		fields:           make([]string, 0, len(fields)),
+		annotationLabels: make(map[string]string, len(alertAnnotations)),
+	}
+	taken := make(map[string]bool, len(set.all))
+	for _, label := range set.all {
+		taken[label] = true
+	}
+
+	for _, label := range alertLabels {
+		if taken[label] {
+			log.Printf("Warning: alert label %s collides with a default metric label, not exporting it", label)
+			continue
+		}
+		taken[label] = true
+		set.labels = append(set.labels, label)
+		set.all = append(set.all, label)
+	}
+
+	for _, annotation := range alertAnnotations {
+		if _, exists := set.annotationLabels[annotation]; exists {
+			continue
+		}
+		labelName := annotation
+		if taken[labelName] {
+			labelName = annotationLabelPrefix + annotation
+			log.Printf("Warning: alert annotation %s collides with a metric label, exporting it as %s", annotation, labelName)
+		}
+		if taken[labelName] {
+			log.Printf("Warning: alert annotation %s collides with metric label %s, not exporting it", annotation, labelName)
+			continue
+		}
+		taken[labelName] = true
+		set.annotationLabels[annotation] = labelName
+		set.annotations = append(set.annotations, annotation)
+		set.all = append(set.all, labelName)
+	}
+
+	for _, field := range fields {
+		if taken[field] {
+			log.Printf("Warning: field %s collides with a metric label, not exporting it", field)
+			continue
+		}
+		taken[field] = true
+		set.fields = append(set.fields, field)
+		set.all = append(set.all, field)
+	}
+
+	return set
+}
+
+// filterAlerts returns the alerts matching every export filter matcher
+// Nil alerts are kept so the export loop reports them as before
+func (e *Exporter) filterAlerts(alerts []*models.GettableAlert) []*models.GettableAlert {
+	if len(e.exportFilter) == 0 {
+		return alerts
+	}
+	filtered := make([]*models.GettableAlert, 0, len(alerts))
+	for _, alert := range alerts {
+		if alert == nil || e.exportFilter.Matches(labelSet(alert.Labels)) {
+			filtered = append(filtered, alert)
+		}
+	}
+	return filtered
+}
+
+// labelSet converts Alertmanager API labels to the label set matchers are evaluated against
+func labelSet(apiLabels models.LabelSet) model.LabelSet {
+	set := make(model.LabelSet, len(apiLabels))
+	for name, value := range apiLabels {
+		set[model.LabelName(name)] = model.LabelValue(value)
+	}
+	return set
+}
+
+// fieldSource is one source of a field's value: an alert label or annotation
+type fieldSource struct {
+	annotation bool
+	name       string
+}
+
+// parseFieldSources parses label:<name> and annotation:<name> entries, skipping invalid ones
+func parseFieldSources(entries []string) []fieldSource {
+	sources := make([]fieldSource, 0, len(entries))
+	for _, entry := range entries {
+		kind, name, found := strings.Cut(entry, ":")
+		if !found || name == "" || (kind != "label" && kind != "annotation") {
+			log.Printf("Warning: invalid field source '%s', must be label:<name> or annotation:<name>", entry)
+			continue
+		}
+		sources = append(sources, fieldSource{annotation: kind == "annotation", name: name})
 	}
+	return sources
 }
 
-// parseEnvList parses a comma-separated environment variable into a list of trimmed strings
-func parseEnvList(envVar string) []string {
-	value := os.Getenv(envVar)
-	if value == "" {
-		return []string{}
+// fieldValue returns the value of the first source set on the alert, or an empty string
+func fieldValue(alert *models.GettableAlert, sources []fieldSource) string {
+	for _, source := range sources {
+		values := alert.Labels
+		if source.annotation {
+			values = alert.Annotations
+		}
+		if value := values[source.name]; value != "" {
+			return value
+		}
 	}
+	return ""
+}
 
-	parts := strings.Split(value, ",")
-	result := make([]string, 0, len(parts))
+// selectDefaultLabels splits the default labels into the selected and the disabled ones
+// An empty selection keeps every default label; unknown names are logged and ignored
+func selectDefaultLabels(selection []string) ([]string, []string) {
+	if len(selection) == 0 {
+		return append([]string{}, config.DefaultAlertLabels...), nil
+	}
 
-	for _, part := range parts {
-		trimmed := strings.TrimSpace(part)
-		if trimmed != "" {
-			result = append(result, trimmed)
+	selected := make(map[string]bool, len(selection))
+	for _, label := range selection {
+		if !slices.Contains(config.DefaultAlertLabels, label) {
+			log.Printf("Warning: unknown default label %s in ALERTMANAGER_ALERTS_DEFAULT_LABELS, ignoring", label)
+			continue
 		}
+		selected[label] = true
 	}
 
+	var enabled, disabled []string
+	for _, label := range config.DefaultAlertLabels {
+		if selected[label] {
+			enabled = append(enabled, label)
+		} else {
+			disabled = append(disabled, label)
+		}
+	}
+	return enabled, disabled
+}
+
+// withoutLabel returns labels without any occurrence of name
+// It keeps the primary label from being registered twice when it is also listed as an extra label
+func withoutLabel(labels []string, name string) []string {
+	result := make([]string, 0, len(labels))
+	for _, label := range labels {
+		if label != name {
+			result = append(result, label)
+		}
+	}
 	return result
 }
 
+// PrimaryLabel returns the alert label used to identify alerts
+func (e *Exporter) PrimaryLabel() string {
+	return e.primaryLabel
+}
+
 // RecordReconciliationStart records the start of a reconciliation cycle
 func (e *Exporter) RecordReconciliationStart() func() {
 	e.reconciliationTotal.Inc()
@@ -197,11 +746,69 @@ func (e *Exporter) RecordReconciliationStart() func() {
 	}
 }
 
+// RecordReconciliationPhase starts timing a reconciliation phase
+// The returned function must be called when the phase completes
+func (e *Exporter) RecordReconciliationPhase(phase string) func() {
+	startTime := time.Now()
+
+	return func() {
+		e.reconciliationPhaseDuration.WithLabelValues(phase).Observe(time.Since(startTime).Seconds())
+	}
+}
+
 // RecordReconciliationSuccess records a successful reconciliation
-func (e *Exporter) RecordReconciliationSuccess(inconsistenciesFound, inconsistenciesResolved int) {
-	e.lastReconciliationSuccess.Set(1)
+// Resolutions are counted as they happen by RecordInconsistencyResolved, not here
+func (e *Exporter) RecordReconciliationSuccess(inconsistenciesFound int) {
+	e.RecordExportOnlySuccess()
 	e.inconsistenciesFound.Set(float64(inconsistenciesFound))
-	e.inconsistenciesResolved.Add(float64(inconsistenciesResolved))
+}
+
+// RecordExportOnlySuccess records a successful reconciliation that did not look for inconsistencies
+// The inconsistency metrics are left untouched
+func (e *Exporter) RecordExportOnlySuccess() {
+	e.lastReconciliationSuccess.Set(1)
+	e.lastSuccessTime.SetToCurrentTime()
+}
+
+// RecordInconsistenciesByReason replaces the per-reason inconsistency counts with those of the last cycle
+func (e *Exporter) RecordInconsistenciesByReason(counts map[string]int) {
+	e.inconsistenciesByReason.Reset()
+	for reason, count := range counts {
+		e.inconsistenciesByReason.WithLabelValues(reason).Set(float64(count))
+	}
+}
+
+// APIRequestObserver returns a function recording API requests made to the given backend
+// (alertmanager or grafana); code is the HTTP status code or "error" if no response was received
+func (e *Exporter) APIRequestObserver(backend string) func(method, code string) {
+	return func(method, code string) {
+		e.apiRequestsTotal.WithLabelValues(backend, method, code).Inc()
+	}
+}
+
+// AlertTruncationObserver returns a function counting the Alertmanager alerts dropped by ALERTMANAGER_MAX_ALERTS
+func (e *Exporter) AlertTruncationObserver() func(dropped int) {
+	return func(dropped int) {
+		e.droppedAlertsTotal.Add(float64(dropped))
+	}
+}
+
+// SilenceObserver returns a function counting the silences created and expired in Alertmanager
+func (e *Exporter) SilenceObserver() func(action string) {
+	return func(action string) {
+		switch action {
+		case alertmanager.SilenceCreated:
+			e.silencesCreatedTotal.Inc()
+		case alertmanager.SilenceExpired:
+			e.silencesExpiredTotal.Inc()
+		}
+	}
+}
+
+// RecordCacheSizes records the current sizes of the silence and user caches
+func (e *Exporter) RecordCacheSizes(silenceCacheSize, userCacheSize int) {
+	e.silenceCacheSize.Set(float64(silenceCacheSize))
+	e.userCacheSize.Set(float64(userCacheSize))
 }
 
 // RecordReconciliationFailure records a failed reconciliation
@@ -215,22 +822,122 @@ func (e *Exporter) RecordInconsistencyResolved() {
 	e.inconsistenciesResolved.Inc()
 }
 
+// RecordReconcileIgnored records alerts excluded from reconciliation by the ignore label
+func (e *Exporter) RecordReconcileIgnored(count int) {
+	e.reconcileIgnoredTotal.Add(float64(count))
+}
+
+// RecordGrafanaCircuitOpen records the Grafana circuit breaker opening
+func (e *Exporter) RecordGrafanaCircuitOpen() {
+	e.grafanaCircuitOpenTotal.Inc()
+}
+
+// RecordReconcileBackoff records the extra delay currently added to the reconciliation interval
+func (e *Exporter) RecordReconcileBackoff(backoff time.Duration) {
+	e.reconcileBackoff.Set(backoff.Seconds())
+}
+
+// RecordOrphanedSilences records the number of orphaned silences found in the last reconciliation
+func (e *Exporter) RecordOrphanedSilences(count int) {
+	e.orphanedSilences.Set(float64(count))
+}
+
+// RecordGrafanaEnabled records whether the Grafana IRM integration is active
+func (e *Exporter) RecordGrafanaEnabled(enabled bool) {
+	if enabled {
+		e.grafanaEnabled.Set(1)
+	} else {
+		e.grafanaEnabled.Set(0)
+	}
+}
+
+// RecordReconcileLoopHeartbeat records a tick of the reconciliation loop
+func (e *Exporter) RecordReconcileLoopHeartbeat() {
+	e.reconcileLoopHeartbeat.Inc()
+}
+
+// RecordTruncatedAlerts records alerts dropped from a Grafana IRM alert group payload
+func (e *Exporter) RecordTruncatedAlerts(count int) {
+	e.truncatedAlertsTotal.Add(float64(count))
+}
+
+// RecordGrafanaGroupSizes observes the number of alerts in each Grafana IRM alert group
+func (e *Exporter) RecordGrafanaGroupSizes(groups []grafana.AlertGroup) {
+	for _, group := range groups {
+		e.grafanaGroupAlertCount.Observe(float64(group.AlertsCount))
+	}
+}
+
+// RecordResolutionSkipped records an inconsistency deliberately left unresolved
+func (e *Exporter) RecordResolutionSkipped(reason string) {
+	e.resolutionsSkipped.WithLabelValues(reason).Inc()
+}
+
+// RecordProtectedSkipped records an inconsistency left unresolved because its alertname is protected
+func (e *Exporter) RecordProtectedSkipped() {
+	e.protectedSkippedTotal.Inc()
+}
+
 // RecordInconsistencyFailedResolve records a failed inconsistency resolution
 func (e *Exporter) RecordInconsistencyFailedResolve() {
 	e.inconsistenciesFailedResolve.Inc()
 }
 
+// ExportAlerts exports alerts from Alertmanager without Grafana IRM enrichment
+func (e *Exporter) ExportAlerts(ctx context.Context, alerts []*models.GettableAlert, amClient *alertmanager.Client) error {
+	return e.ExportAlertsWithGrafana(ctx, alerts, nil, nil, amClient)
+}
+
 // ExportAlertsWithGrafana exports alerts with additional information from Grafana IRM
+// Concurrent exports (the reconciliation loop and /export) run one after the other
+// Alerts that fail to export don't stop the others; their errors are joined into the returned error
 func (e *Exporter) ExportAlertsWithGrafana(ctx context.Context, alerts []*models.GettableAlert, grafanaAlertGroups []grafana.AlertGroup, grafanaClient *grafana.Client, amClient *alertmanager.Client) error {
+	e.exportMutex.Lock()
+	defer e.exportMutex.Unlock()
+
 	e.alertExportTotal.Inc()
 	e.lastAlertExportTime.SetToCurrentTime()
 
 	// Reset previous metrics to avoid stale data
 	e.alertStateGauge.Reset()
+	e.alertsByReceiver.Reset()
+	e.alertUpdatedTime.Reset()
+	e.alertSilenceCount.Reset()
+	e.resolvedAlertGauge.Reset()
+
+	// Index alert names by fingerprint to resolve inhibiting alerts, including filtered out ones
+	alertnames := e.alertnamesByFingerprint(alerts)
+
+	alerts = e.filterAlerts(alerts)
+	e.exportReceiverCounts(alerts)
+
+	// Fetch every silence referenced by the alerts at once instead of one request per silence
+	if amClient != nil {
+		amClient.PrewarmSilences(ctx, silenceIDs(alerts))
+	}
+
+	var exportErrs []error
+	now := time.Now()
+	returned := make(map[string]bool, len(alerts))
+	firingAlerts := make(map[string]string, len(alerts))
+
+	// Active alerts counted per matched Grafana alert group, for the optional alert group rollup
+	groupActiveAlerts := make(map[*grafana.AlertGroup]int)
 
 	for _, alert := range alerts {
+		if alert == nil {
+			logging.Println(ctx, "Skipping nil alert in Alertmanager response")
+			continue
+		}
+		if alert.Fingerprint != nil && *alert.Fingerprint != "" {
+			returned[*alert.Fingerprint] = true
+			if !isResolved(alert, alertState(alert), now) {
+				firingAlerts[*alert.Fingerprint] = sanitizeLabelValue(alert.Labels[e.primaryLabel], e.maxLabelValueLength)
+			}
+		}
+
 		var grafanaGroup *grafana.AlertGroup
-		
+
 		// Find the matching Grafana alert group by searching through all groups
 		if alert.Fingerprint != nil {
 			alertFingerprint := *alert.Fingerprint
@@ -249,41 +956,153 @@ func (e *Exporter) ExportAlertsWithGrafana(ctx context.Context, alerts []*models
 			}
 		}
 
-		if err := e.exportAlert(ctx, alert, grafanaGroup, grafanaClient, amClient); err != nil {
-			log.Printf("Error exporting alert %s: %v", alert.Labels["alertname"], err)
+		if grafanaGroup != nil {
+			active := 0
+			if alertState(alert) == alertStateActive {
+				active = 1
+			}
+			groupActiveAlerts[grafanaGroup] += active
+		}
+
+		if err := e.exportAlert(ctx, alert, alertnames, grafanaGroup, grafanaClient, amClient); err != nil {
+			logging.Printf(ctx, "Error exporting alert %s: %v", alert.Labels[e.primaryLabel], err)
+			exportErrs = append(exportErrs, fmt.Errorf("exporting alert %s: %w", alert.Labels[e.primaryLabel], err))
 			// Continue with other alerts even if one fails
 		}
 	}
 
+	// Resolved alerts are usually dropped from Alertmanager's response right away, so alerts
+	// that were firing at the previous export and are now gone count as resolved in between
+	// (alerts still returned once ended were exported with their end time above)
+	for fingerprint, name := range e.firingAlerts {
+		if !returned[fingerprint] {
+			e.resolvedAlertGauge.WithLabelValues(name, fingerprint).Set(float64(now.Unix()))
+		}
+	}
+	e.firingAlerts = firingAlerts
+
+	e.exportAlertGroupStates(groupActiveAlerts)
+
+	if len(exportErrs) > 0 {
+		return fmt.Errorf("%d of %d alerts failed to export: %w", len(exportErrs), len(alerts), errors.Join(exportErrs...))
+	}
+
 	return nil
 }
 
+// exportAlertGroupStates sets the number of active alerts in each Grafana IRM alert group, when enabled
+// Groups whose alerts are all suppressed are exported with 0
+func (e *Exporter) exportAlertGroupStates(groupActiveAlerts map[*grafana.AlertGroup]int) {
+	if e.alertGroupStateGauge == nil {
+		return
+	}
+
+	e.alertGroupStateGauge.Reset()
+	for group, count := range groupActiveAlerts {
+		e.alertGroupStateGauge.WithLabelValues(group.ID, sanitizeLabelValue(group.LastAlert.Payload.GroupKey, e.maxLabelValueLength), group.State).
+			Set(float64(count))
+	}
+}
+
+// exportReceiverCounts sets the number of alerts per receiver
+// An alert routed to several receivers is counted once for each of them
+func (e *Exporter) exportReceiverCounts(alerts []*models.GettableAlert) {
+	counts := make(map[string]int)
+	for _, alert := range alerts {
+		if alert == nil {
+			continue
+		}
+		for _, receiver := range alert.Receivers {
+			if receiver != nil && receiver.Name != nil {
+				counts[*receiver.Name]++
+			}
+		}
+	}
+
+	for receiver, count := range counts {
+		e.alertsByReceiver.WithLabelValues(receiver).Set(float64(count))
+	}
+}
+
+// alertnamesByFingerprint builds a fingerprint to primary label value map from the fetched alerts
+func (e *Exporter) alertnamesByFingerprint(alerts []*models.GettableAlert) map[string]string {
+	alertnames := make(map[string]string, len(alerts))
+	for _, alert := range alerts {
+		if alert != nil && alert.Fingerprint != nil {
+			alertnames[*alert.Fingerprint] = alert.Labels[e.primaryLabel]
+		}
+	}
+	return alertnames
+}
+
 // exportAlert exports a single alert as a Prometheus metric
-func (e *Exporter) exportAlert(ctx context.Context, alert *models.GettableAlert, grafanaGroup *grafana.AlertGroup, grafanaClient *grafana.Client, amClient *alertmanager.Client) error {
+// alertnames maps fingerprints to alert names and is used to name the inhibiting alert
+func (e *Exporter) exportAlert(ctx context.Context, alert *models.GettableAlert, alertnames map[string]string, grafanaGroup *grafana.AlertGroup, grafanaClient *grafana.Client, amClient *alertmanager.Client) error {
 	// Extract alert fingerprint
 	fingerprint := ""
 	if alert.Fingerprint != nil {
 		fingerprint = *alert.Fingerprint
+	} else {
+		logging.Printf(ctx, "Alert %s has no fingerprint, exporting it with an empty fingerprint label", alert.Labels[e.primaryLabel])
+	}
+
+	state := alertState(alert)
+
+	// Resolved alerts linger in Alertmanager until garbage collected; export them apart from active ones
+	if isResolved(alert, state, time.Now()) {
+		e.resolvedAlertGauge.WithLabelValues(sanitizeLabelValue(alert.Labels[e.primaryLabel], e.maxLabelValueLength), fingerprint).
+			Set(float64(time.Time(*alert.EndsAt).Unix()))
+		return nil
+	}
+
+	// Alerts without an update time or a fingerprint are left out of the updated timestamp metric
+	if alert.UpdatedAt != nil && fingerprint != "" {
+		e.alertUpdatedTime.WithLabelValues(fingerprint).Set(float64(time.Time(*alert.UpdatedAt).Unix()))
+	}
+
+	// A missing status is treated as an alert without silences or inhibitions
+	status := alert.Status
+	if status == nil {
+		logging.Printf(ctx, "Alert %s (%s) has no status, exporting it with state %s", alert.Labels[e.primaryLabel], fingerprint, state)
+		status = &models.AlertStatus{}
 	}
 
 	// Determine if alert is suppressed (silenced)
 	suppressed := "false"
 	silencedBy := ""
+	silenceComment := ""
+
+	// Failed lookups leave their label empty; the alert is still exported and the errors returned
+	var lookupErrs []error
 
-	if len(alert.Status.SilencedBy) > 0 {
+	if fingerprint != "" {
+		e.alertSilenceCount.WithLabelValues(fingerprint).Set(float64(len(status.SilencedBy)))
+	}
+
+	if len(status.SilencedBy) > 0 {
 		suppressed = "true"
 
-		// Get the author of the first silence (with caching)
+		// Get the authors of the silences and the comment of the first one (with caching)
 		if amClient != nil {
-			silencedBy = amClient.GetSilenceAuthor(ctx, alert.Status.SilencedBy[0])
+			authors, err := silenceAuthors(ctx, amClient, status.SilencedBy)
+			if err != nil {
+				lookupErrs = append(lookupErrs, err)
+			} else if e.silenceComment {
+				// The silence is cached by the author lookup, so this makes no extra request
+				silenceComment = truncate(amClient.GetSilenceComment(ctx, status.SilencedBy[0]), e.silenceCommentMaxLength)
+			}
+			silencedBy = authors
 		}
 	}
 
-	// Extract inhibited_by (fingerprint of inhibiting alert)
+	// Extract inhibited_by (fingerprint of inhibiting alert) and its alertname
+	// The alertname stays empty when the inhibitor is not part of the current alert set
 	inhibitedBy := ""
-	if len(alert.Status.InhibitedBy) > 0 {
+	inhibitedByAlertname := ""
+	if len(status.InhibitedBy) > 0 {
 		// Use the first inhibiting alert's fingerprint
-		inhibitedBy = alert.Status.InhibitedBy[0]
+		inhibitedBy = status.InhibitedBy[0]
+		inhibitedByAlertname = alertnames[inhibitedBy]
 	}
 
 	// Extract acknowledged_by, resolved_by, alert_group_id and timestamps from Grafana
@@ -296,7 +1115,7 @@ func (e *Exporter) exportAlert(ctx context.Context, alert *models.GettableAlert,
 
 	if grafanaGroup != nil {
 		alertGroupID = grafanaGroup.ID
-		
+
 		// Format timestamps as Unix timestamps (seconds since epoch, empty if not valid)
 		if grafanaGroup.AcknowledgedAt.Valid {
 			acknowledgedAt = fmt.Sprintf("%d", grafanaGroup.AcknowledgedAt.Time.Unix())
@@ -307,31 +1126,40 @@ func (e *Exporter) exportAlert(ctx context.Context, alert *models.GettableAlert,
 		if grafanaGroup.ResolvedAt.Valid {
 			resolvedAt = fmt.Sprintf("%d", grafanaGroup.ResolvedAt.Time.Unix())
 		}
-		
+
 		if grafanaClient != nil {
 			// Fetch user emails from user IDs (with caching)
-			if grafanaGroup.AcknowledgedBy != "" {
-				acknowledgedBy = grafanaClient.GetUserEmail(grafanaGroup.AcknowledgedBy)
+			var err error
+			if acknowledgedBy, err = userEmail(ctx, grafanaClient, grafanaGroup.AcknowledgedBy); err != nil {
+				lookupErrs = append(lookupErrs, err)
 			}
-			if grafanaGroup.ResolvedBy != "" {
-				resolvedBy = grafanaClient.GetUserEmail(grafanaGroup.ResolvedBy)
+			if resolvedBy, err = userEmail(ctx, grafanaClient, grafanaGroup.ResolvedBy); err != nil {
+				lookupErrs = append(lookupErrs, err)
 			}
 		}
 	}
 
 	// Build metric labels
 	metricLabels := prometheus.Labels{
-		"alertname":       alert.Labels["alertname"],
-		"fingerprint":     fingerprint,
-		"suppressed":      suppressed,
-		"acknowledged_by": acknowledgedBy,
-		"resolved_by":     resolvedBy,
-		"silenced_by":     silencedBy,
-		"inhibited_by":    inhibitedBy,
-		"alert_group_id":  alertGroupID,
-		"acknowledged_at": acknowledgedAt,
-		"created_at":      createdAt,
-		"resolved_at":     resolvedAt,
+		e.primaryLabel:           alert.Labels[e.primaryLabel],
+		"fingerprint":            fingerprint,
+		"state":                  state,
+		"suppressed":             suppressed,
+		"acknowledged_by":        acknowledgedBy,
+		"resolved_by":            resolvedBy,
+		"silenced_by":            silencedBy,
+		"inhibited_by":           inhibitedBy,
+		"inhibited_by_alertname": inhibitedByAlertname,
+		"alert_group_id":         alertGroupID,
+		"acknowledged_at":        acknowledgedAt,
+		"created_at":             createdAt,
+		"resolved_at":            resolvedAt,
+	}
+	if e.silenceComment {
+		metricLabels[config.SilenceCommentLabelName] = silenceComment
+	}
+	for _, label := range e.disabledDefaultLabels {
+		delete(metricLabels, label)
 	}
 
 	// Add extra labels from alert labels
@@ -345,25 +1173,169 @@ func (e *Exporter) exportAlert(ctx context.Context, alert *models.GettableAlert,
 
 	// Add extra labels from alert annotations
 	for _, annotation := range e.alertAnnotations {
+		labelName := e.annotationLabels[annotation]
 		if val, ok := alert.Annotations[annotation]; ok {
-			metricLabels[annotation] = val
+			metricLabels[labelName] = val
 		} else {
-			metricLabels[annotation] = ""
+			metricLabels[labelName] = ""
 		}
 	}
+	// Add fields from the first of their sources holding a value
+	for _, field := range e.fieldLabels {
+		metricLabels[field] = fieldValue(alert, e.fields[field])
+	}
+
+	// Annotations such as descriptions can hold multiline text or large blobs
+	for label, value := range metricLabels {
+		metricLabels[label] = sanitizeLabelValue(value, e.maxLabelValueLength)
+	}
+
 	var alertStateNumber float64
 	alertStateNumber = 0.0
 	// Set the gauge value to 1 (alert firing)
-	if *alert.Status.State == "active" {
+	if state == alertStateActive {
 		alertStateNumber = 1
 	}
 	// Set the gauge value to 1 (alert exists)
-	e.alertStateGauge.With(metricLabels).Set(alertStateNumber)
+	gauge, err := e.alertStateGauge.GetMetricWith(metricLabels)
+	if err != nil {
+		return errors.Join(append(lookupErrs, fmt.Errorf("building alert state series: %w", err))...)
+	}
+	gauge.Set(alertStateNumber)
 
-	return nil
+	return errors.Join(lookupErrs...)
+}
+
+// silenceAuthor returns the creator of a silence, or an empty string if it has none
+func silenceAuthor(ctx context.Context, amClient *alertmanager.Client, silenceID string) (string, error) {
+	silence, err := amClient.GetSilence(ctx, silenceID)
+	if err != nil {
+		return "", fmt.Errorf("fetching silence %s: %w", silenceID, err)
+	}
+	if silence == nil || silence.CreatedBy == nil {
+		return "", nil
+	}
+	return *silence.CreatedBy, nil
+}
+
+// userEmail returns the email of a Grafana IRM user, or an empty string when no user is set
+func userEmail(ctx context.Context, grafanaClient *grafana.Client, userID string) (string, error) {
+	user, err := grafanaClient.GetUser(ctx, userID)
+	if err != nil {
+		return "", fmt.Errorf("fetching user %s: %w", userID, err)
+	}
+	if user == nil {
+		return "", nil
+	}
+	return user.Email, nil
+}
+
+// maxSilenceAuthors caps the number of authors listed in the silenced_by label
+const maxSilenceAuthors = 3
+
+// silenceIDs returns the distinct IDs of the silences muting the given alerts
+func silenceIDs(alerts []*models.GettableAlert) []string {
+	seen := make(map[string]bool)
+	var ids []string
+	for _, alert := range alerts {
+		if alert == nil || alert.Status == nil {
+			continue
+		}
+		for _, silenceID := range alert.Status.SilencedBy {
+			if !seen[silenceID] {
+				seen[silenceID] = true
+				ids = append(ids, silenceID)
+			}
+		}
+	}
+	return ids
+}
+
+// silenceAuthors returns the distinct authors of the given silences, comma-joined
+// Only the first maxSilenceAuthors authors are listed to bound the label's cardinality
+func silenceAuthors(ctx context.Context, amClient *alertmanager.Client, silenceIDs []string) (string, error) {
+	authors := make([]string, 0, len(silenceIDs))
+	var errs []error
+	for _, silenceID := range silenceIDs {
+		author, err := silenceAuthor(ctx, amClient, silenceID)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if author == "" || slices.Contains(authors, author) {
+			continue
+		}
+		authors = append(authors, author)
+		if len(authors) == maxSilenceAuthors {
+			break
+		}
+	}
+	return strings.Join(authors, ","), errors.Join(errs...)
+}
+
+// sanitizeLabelValue makes value safe to export as a label value: invalid UTF-8 is dropped,
+// control characters (such as newlines) become spaces and the result is truncated to maxLength characters
+func sanitizeLabelValue(value string, maxLength int) string {
+	value = strings.ToValidUTF8(value, "")
+	value = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, value)
+	return truncate(value, maxLength)
+}
+
+// truncate shortens value to at most maxLength characters, marking the cut with an ellipsis
+// The ellipsis counts towards maxLength; a maxLength of 1 keeps the first character without it
+// A maxLength of 0 or less leaves the value unchanged
+func truncate(value string, maxLength int) string {
+	runes := []rune(value)
+	if maxLength <= 0 || len(runes) <= maxLength {
+		return value
+	}
+	if maxLength == 1 {
+		return string(runes[:1])
+	}
+	return string(runes[:maxLength-1]) + "…"
+}
+
+// alertState returns the Alertmanager state of an alert, or unknown when it has none
+func alertState(alert *models.GettableAlert) string {
+	if alert.Status == nil || alert.Status.State == nil {
+		return alertStateUnknown
+	}
+
+	switch state := *alert.Status.State; state {
+	case alertStateActive, alertStateSuppressed, alertStateUnprocessed:
+		return state
+	default:
+		return alertStateUnknown
+	}
+}
+
+// isResolved reports whether an alert has ended and is no longer firing
+// Alertmanager's own state wins over EndsAt: an active or suppressed alert whose EndsAt is already past
+// (clock skew, a late re-send) is still firing and must not be dropped from the active metrics
+func isResolved(alert *models.GettableAlert, state string, now time.Time) bool {
+	if alert.EndsAt == nil || !time.Time(*alert.EndsAt).Before(now) {
+		return false
+	}
+	return state != alertStateActive && state != alertStateSuppressed
 }
 
 // RecordAlertExportFailure increments the alert export failure counter
 func (e *Exporter) RecordAlertExportFailure() {
 	e.alertExportFailuresTotal.Inc()
 }
+
+// RecordWebhookEvent records a received webhook event with its type and outcome
+// (ignored, silenced, unsilenced or error)
+func (e *Exporter) RecordWebhookEvent(eventType, outcome string) {
+	e.webhookEventsTotal.WithLabelValues(eventType, outcome).Inc()
+}
+
+// RecordWebhookCaller records a webhook request by the basic auth user that sent it
+func (e *Exporter) RecordWebhookCaller(caller string) {
+	e.webhookCallersTotal.WithLabelValues(caller).Inc()
+}
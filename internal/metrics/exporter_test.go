@@ -0,0 +1,1024 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/alertmanager"
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/config"
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/grafana"
+	"github.com/go-openapi/strfmt"
+	"github.com/prometheus/alertmanager/api/v2/models"
+)
+
+func TestExportInhibitedByAlertname(t *testing.T) {
+	alerts := []*models.GettableAlert{
+		testAlert("fp-inhibitor", "DatacenterDown", "active"),
+		testAlert("fp-inhibited", "HighLatency", "suppressed", "fp-inhibitor"),
+		testAlert("fp-orphan", "DiskFull", "suppressed", "fp-gone"),
+	}
+
+	if err := testExporter().ExportAlertsWithGrafana(context.Background(), alerts, nil, nil, nil); err != nil {
+		t.Fatalf("ExportAlertsWithGrafana() error = %v", err)
+	}
+	series := alertStateSeries(t)
+
+	tests := []struct {
+		fingerprint   string
+		wantInhibitor string
+		wantAlertname string
+	}{
+		{fingerprint: "fp-inhibitor"},
+		{fingerprint: "fp-inhibited", wantInhibitor: "fp-inhibitor", wantAlertname: "DatacenterDown"},
+		{fingerprint: "fp-orphan", wantInhibitor: "fp-gone"},
+	}
+	for _, tt := range tests {
+		labels, exists := series[tt.fingerprint]
+		if !exists {
+			t.Errorf("no alert_state series exported for %s", tt.fingerprint)
+			continue
+		}
+		if labels["inhibited_by"] != tt.wantInhibitor || labels["inhibited_by_alertname"] != tt.wantAlertname {
+			t.Errorf("%s: inhibited_by=%q inhibited_by_alertname=%q, want %q and %q", tt.fingerprint,
+				labels["inhibited_by"], labels["inhibited_by_alertname"], tt.wantInhibitor, tt.wantAlertname)
+		}
+	}
+}
+
+func TestExportAlertsByReceiver(t *testing.T) {
+	alerts := []*models.GettableAlert{
+		withReceivers(testAlert("fp1", "DiskFull", "active"), "oncall"),
+		withReceivers(testAlert("fp2", "HighLatency", "active"), "oncall", "slack"),
+		withReceivers(testAlert("fp3", "HighLatency", "suppressed"), "slack"),
+		withReceivers(testAlert("fp4", "Watchdog", "active"), "slack"),
+	}
+
+	if err := testExporter().ExportAlertsWithGrafana(context.Background(), alerts, nil, nil, nil); err != nil {
+		t.Fatalf("ExportAlertsWithGrafana() error = %v", err)
+	}
+
+	got := gaugeValues(t, "alertmanager_sync_alerts_by_receiver", "receiver")
+	want := map[string]float64{"oncall": 2, "slack": 3}
+	if !maps.Equal(got, want) {
+		t.Errorf("alertmanager_sync_alerts_by_receiver = %v, want %v", got, want)
+	}
+}
+
+func TestExportAlertsPartialFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path != "/api/v2/silence/s1" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `"silence not found"`)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"id":        "s1",
+			"comment":   "maintenance",
+			"createdBy": "oncall@example.com",
+			"startsAt":  "2024-01-01T00:00:00Z",
+			"endsAt":    "2024-01-01T01:00:00Z",
+			"updatedAt": "2024-01-01T00:00:00Z",
+			"matchers":  []map[string]any{{"name": "alertname", "value": "DiskFull", "isRegex": false, "isEqual": true}},
+			"status":    map[string]string{"state": "active"},
+		})
+	}))
+	defer srv.Close()
+	amClient := alertmanager.NewClient(config.AlertmanagerConfig{Host: strings.TrimPrefix(srv.URL, "http://")})
+
+	silenced := testAlert("fp-silenced", "DiskFull", "suppressed")
+	silenced.Status.SilencedBy = []string{"s1"}
+	broken := testAlert("fp-broken", "HighLatency", "suppressed")
+	broken.Status.SilencedBy = []string{"s-missing"}
+	alerts := []*models.GettableAlert{silenced, broken, testAlert("fp-active", "Watchdog", "active")}
+
+	err := testExporter().ExportAlerts(context.Background(), alerts, amClient)
+	if err == nil {
+		t.Fatal("ExportAlerts() error = nil, want the failed silence lookup")
+	}
+	if !strings.Contains(err.Error(), "1 of 3 alerts failed to export") || !strings.Contains(err.Error(), "s-missing") {
+		t.Errorf("ExportAlerts() error = %v, want it to report the failed alert", err)
+	}
+
+	series := alertStateSeries(t)
+	for _, fingerprint := range []string{"fp-silenced", "fp-broken", "fp-active"} {
+		if _, exists := series[fingerprint]; !exists {
+			t.Errorf("no alert_state series exported for %s", fingerprint)
+		}
+	}
+	if got := series["fp-silenced"]["silenced_by"]; got != "oncall@example.com" {
+		t.Errorf("fp-silenced silenced_by = %q, want oncall@example.com", got)
+	}
+}
+
+func TestExportAlertMultipleSilences(t *testing.T) {
+	authors := map[string]string{"s1": "oncall@example.com", "s2": "dba@example.com", "s3": "oncall@example.com"}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/api/v2/silence/")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"id":        id,
+			"comment":   "maintenance",
+			"createdBy": authors[id],
+			"startsAt":  "2024-01-01T00:00:00Z",
+			"endsAt":    "2024-01-01T01:00:00Z",
+			"updatedAt": "2024-01-01T00:00:00Z",
+			"matchers":  []map[string]any{{"name": "alertname", "value": "DiskFull", "isRegex": false, "isEqual": true}},
+			"status":    map[string]string{"state": "active"},
+		})
+	}))
+	defer srv.Close()
+	amClient := alertmanager.NewClient(config.AlertmanagerConfig{Host: strings.TrimPrefix(srv.URL, "http://")})
+
+	twice := testAlert("fp-twice", "DiskFull", "suppressed")
+	twice.Status.SilencedBy = []string{"s1", "s2"}
+	sameAuthor := testAlert("fp-same-author", "HighLatency", "suppressed")
+	sameAuthor.Status.SilencedBy = []string{"s1", "s3"}
+	alerts := []*models.GettableAlert{twice, sameAuthor, testAlert("fp-active", "Watchdog", "active")}
+
+	if err := testExporter().ExportAlerts(context.Background(), alerts, amClient); err != nil {
+		t.Fatalf("ExportAlerts() error = %v", err)
+	}
+
+	counts := gaugeValues(t, "alertmanager_sync_alert_silence_count", "fingerprint")
+	if want := map[string]float64{"fp-twice": 2, "fp-same-author": 2, "fp-active": 0}; !maps.Equal(counts, want) {
+		t.Errorf("alertmanager_sync_alert_silence_count = %v, want %v", counts, want)
+	}
+	series := alertStateSeries(t)
+	if got := series["fp-twice"]["silenced_by"]; got != "oncall@example.com,dba@example.com" {
+		t.Errorf("fp-twice silenced_by = %q, want both authors", got)
+	}
+	if got := series["fp-same-author"]["silenced_by"]; got != "oncall@example.com" {
+		t.Errorf("fp-same-author silenced_by = %q, want the author listed once", got)
+	}
+}
+
+func TestExportAlertsFetchesEachSilenceOnce(t *testing.T) {
+	silence := func(id string) map[string]any {
+		return map[string]any{
+			"id":        id,
+			"comment":   "maintenance",
+			"createdBy": id + "@example.com",
+			"startsAt":  "2024-01-01T00:00:00Z",
+			"endsAt":    "2024-01-01T01:00:00Z",
+			"updatedAt": "2024-01-01T00:00:00Z",
+			"matchers":  []map[string]any{{"name": "alertname", "value": "DiskFull", "isRegex": false, "isEqual": true}},
+			"status":    map[string]string{"state": "active"},
+		}
+	}
+	var mutex sync.Mutex
+	requests := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		requests[r.URL.Path]++
+		mutex.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/api/v2/silences" {
+			// s3 was created after the list was served, so it's fetched on its own
+			json.NewEncoder(w).Encode([]map[string]any{silence("s1"), silence("s2"), silence("unrelated")})
+			return
+		}
+		json.NewEncoder(w).Encode(silence(strings.TrimPrefix(r.URL.Path, "/api/v2/silence/")))
+	}))
+	defer srv.Close()
+	amClient := alertmanager.NewClient(config.AlertmanagerConfig{Host: strings.TrimPrefix(srv.URL, "http://")})
+
+	var alerts []*models.GettableAlert
+	for i, silenceIDs := range [][]string{{"s1"}, {"s1"}, {"s1", "s2"}, {"s2"}, {"s3"}, {"s3", "s1"}} {
+		alert := testAlert(fmt.Sprintf("fp%d", i), "DiskFull", "suppressed")
+		alert.Status.SilencedBy = silenceIDs
+		alerts = append(alerts, alert)
+	}
+
+	if err := testExporter().ExportAlerts(context.Background(), alerts, amClient); err != nil {
+		t.Fatalf("ExportAlerts() error = %v", err)
+	}
+
+	want := map[string]int{"/api/v2/silences": 1, "/api/v2/silence/s3": 1}
+	if !maps.Equal(requests, want) {
+		t.Errorf("Alertmanager requests = %v, want %v", requests, want)
+	}
+	if got := alertStateSeries(t)["fp5"]["silenced_by"]; got != "s3@example.com,s1@example.com" {
+		t.Errorf("fp5 silenced_by = %q, want both authors", got)
+	}
+}
+
+func TestMetricPrefix(t *testing.T) {
+	e, registry := isolatedExporter(t, config.MetricsConfig{MetricPrefix: "team_sync"})
+	e.RecordReconciliationSuccess(0)
+	if err := e.ExportAlerts(context.Background(), []*models.GettableAlert{testAlert("fp1", "DiskFull", "active")}, nil); err != nil {
+		t.Fatalf("ExportAlerts() error = %v", err)
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("gathering metrics: %v", err)
+	}
+	names := make([]string, 0, len(families))
+	for _, family := range families {
+		if !strings.HasPrefix(family.GetName(), "team_sync_") {
+			t.Errorf("metric %s does not start with the team_sync_ prefix", family.GetName())
+		}
+		names = append(names, family.GetName())
+	}
+	for _, want := range []string{"team_sync_reconciliation_total", "team_sync_alert_state"} {
+		if !slices.Contains(names, want) {
+			t.Errorf("metrics %v do not include %s", names, want)
+		}
+	}
+}
+
+func TestRecordLastSuccessTimestamp(t *testing.T) {
+	e := testExporter()
+	const name = "alertmanager_sync_last_success_timestamp_seconds"
+
+	before := float64(time.Now().Unix())
+	e.RecordReconciliationSuccess(0)
+	success := metricValue(t, name)
+	if success < before {
+		t.Fatalf("%s = %v after a success, want at least %v", name, success, before)
+	}
+
+	e.RecordReconciliationFailure()
+	if got := metricValue(t, name); got != success {
+		t.Errorf("%s = %v after a failure, want it unchanged at %v", name, got, success)
+	}
+}
+
+func TestRecordGrafanaEnabled(t *testing.T) {
+	e := testExporter()
+	const name = "alertmanager_sync_grafana_enabled"
+
+	e.RecordGrafanaEnabled(true)
+	if got := metricValue(t, name); got != 1 {
+		t.Errorf("%s = %v with the integration active, want 1", name, got)
+	}
+	e.RecordGrafanaEnabled(false)
+	if got := metricValue(t, name); got != 0 {
+		t.Errorf("%s = %v with the integration disabled, want 0", name, got)
+	}
+}
+
+func TestExportAlertState(t *testing.T) {
+	nilState := testAlert("fp-state-nil", "DiskFull", "")
+	nilState.Status.State = nil
+	alerts := []*models.GettableAlert{
+		testAlert("fp-state-active", "DiskFull", "active"),
+		testAlert("fp-state-suppressed", "DiskFull", "suppressed"),
+		testAlert("fp-state-unprocessed", "DiskFull", "unprocessed"),
+		testAlert("fp-state-resolved", "DiskFull", "resolved"),
+		nilState,
+	}
+
+	if err := testExporter().ExportAlertsWithGrafana(context.Background(), alerts, nil, nil, nil); err != nil {
+		t.Fatalf("ExportAlertsWithGrafana() error = %v", err)
+	}
+	series := alertStateSeries(t)
+
+	tests := []struct {
+		fingerprint string
+		want        string
+	}{
+		{fingerprint: "fp-state-active", want: "active"},
+		{fingerprint: "fp-state-suppressed", want: "suppressed"},
+		{fingerprint: "fp-state-unprocessed", want: "unprocessed"},
+		{fingerprint: "fp-state-resolved", want: "unknown"},
+		{fingerprint: "fp-state-nil", want: "unknown"},
+	}
+	for _, tt := range tests {
+		labels, exists := series[tt.fingerprint]
+		if !exists {
+			t.Errorf("no alert_state series exported for %s", tt.fingerprint)
+			continue
+		}
+		if labels["state"] != tt.want {
+			t.Errorf("%s: state=%q, want %q", tt.fingerprint, labels["state"], tt.want)
+		}
+	}
+}
+
+func TestExportAlertsWithNilFields(t *testing.T) {
+	noStatus := testAlert("fp-no-status", "NoStatus", "active")
+	noStatus.Status = nil
+	noFingerprint := testAlert("", "NoFingerprint", "active")
+	noFingerprint.Fingerprint = nil
+	alerts := []*models.GettableAlert{nil, noStatus, noFingerprint}
+
+	if err := testExporter().ExportAlertsWithGrafana(context.Background(), alerts, nil, nil, nil); err != nil {
+		t.Fatalf("ExportAlertsWithGrafana() error = %v", err)
+	}
+	series := alertStateSeries(t)
+
+	if labels, exists := series["fp-no-status"]; !exists {
+		t.Error("no alert_state series exported for the alert without a status")
+	} else if labels["state"] != "unknown" || labels["suppressed"] != "false" {
+		t.Errorf("alert without a status: state=%q suppressed=%q, want unknown and false", labels["state"], labels["suppressed"])
+	}
+	if labels, exists := series[""]; !exists || labels["alertname"] != "NoFingerprint" {
+		t.Errorf("alert without a fingerprint exported as %v, want it with an empty fingerprint label", labels)
+	}
+}
+
+func TestExportAlertPrimaryLabel(t *testing.T) {
+	e, registry := isolatedExporter(t, config.MetricsConfig{PrimaryLabel: "service"})
+
+	inhibitor := testAlert("fp-checkout", "HighLatency", "active")
+	inhibitor.Labels["service"] = "checkout"
+	inhibited := testAlert("fp-payments", "HighLatency", "suppressed", "fp-checkout")
+	inhibited.Labels["service"] = "payments"
+	alerts := []*models.GettableAlert{inhibitor, inhibited}
+
+	alertnames := e.alertnamesByFingerprint(alerts)
+	if err := e.exportAlert(context.Background(), inhibited, alertnames, nil, nil, nil); err != nil {
+		t.Fatalf("exportAlert() error = %v", err)
+	}
+
+	got := singleSeriesLabels(t, registry)
+	if got["service"] != "payments" || got["inhibited_by_alertname"] != "checkout" {
+		t.Errorf("series labels service=%q inhibited_by_alertname=%q, want payments and checkout", got["service"], got["inhibited_by_alertname"])
+	}
+	if _, exists := got["alertname"]; exists {
+		t.Errorf("series has an alertname label with primary label service: %v", got)
+	}
+}
+
+func TestWithoutLabel(t *testing.T) {
+	got := withoutLabel([]string{"team", "service", "env", "service"}, "service")
+	if want := []string{"team", "env"}; !slices.Equal(got, want) {
+		t.Errorf("withoutLabel() = %v, want %v", got, want)
+	}
+}
+
+func TestRecordInconsistenciesByReason(t *testing.T) {
+	e := testExporter()
+	const name = "alertmanager_sync_inconsistencies_by_reason"
+
+	e.RecordInconsistenciesByReason(map[string]int{"silenced_firing": 3, "cleared_firing": 1, "stale": 2})
+	e.RecordInconsistenciesByReason(map[string]int{"silenced_firing": 2, "cleared_firing": 4})
+
+	got := gaugeValues(t, name, "reason")
+	want := map[string]float64{"silenced_firing": 2, "cleared_firing": 4}
+	if !maps.Equal(got, want) {
+		t.Errorf("%s = %v, want %v", name, got, want)
+	}
+}
+
+func TestAPIRequestObserver(t *testing.T) {
+	e := testExporter()
+	observe := e.APIRequestObserver("grafana")
+
+	observe(http.MethodGet, "200")
+	observe(http.MethodGet, "200")
+	observe(http.MethodPost, "500")
+	e.APIRequestObserver("alertmanager")(http.MethodGet, "error")
+
+	tests := []struct {
+		backend, method, code string
+		want                  float64
+	}{
+		{backend: "grafana", method: "GET", code: "200", want: 2},
+		{backend: "grafana", method: "POST", code: "500", want: 1},
+		{backend: "alertmanager", method: "GET", code: "error", want: 1},
+		{backend: "alertmanager", method: "GET", code: "200", want: 0},
+	}
+	for _, tt := range tests {
+		labels := map[string]string{"backend": tt.backend, "method": tt.method, "code": tt.code}
+		if got := labeledMetricValue(t, "alertmanager_sync_api_requests_total", labels); got != tt.want {
+			t.Errorf("alertmanager_sync_api_requests_total%v = %v, want %v", labels, got, tt.want)
+		}
+	}
+}
+
+func TestAlertTruncationObserver(t *testing.T) {
+	const name = "alertmanager_sync_alertmanager_alerts_dropped_total"
+	before := metricValue(t, name)
+
+	observe := testExporter().AlertTruncationObserver()
+	observe(3)
+	observe(7)
+
+	if got := metricValue(t, name) - before; got != 10 {
+		t.Errorf("%s increased by %v, want 10", name, got)
+	}
+}
+
+func TestSilenceObserver(t *testing.T) {
+	const created, expired = "alertmanager_sync_silences_created_total", "alertmanager_sync_silences_expired_total"
+	createdBefore, expiredBefore := metricValue(t, created), metricValue(t, expired)
+
+	observe := testExporter().SilenceObserver()
+	observe(alertmanager.SilenceCreated)
+	observe(alertmanager.SilenceCreated)
+	observe(alertmanager.SilenceExpired)
+
+	if got := metricValue(t, created) - createdBefore; got != 2 {
+		t.Errorf("%s increased by %v, want 2", created, got)
+	}
+	if got := metricValue(t, expired) - expiredBefore; got != 1 {
+		t.Errorf("%s increased by %v, want 1", expired, got)
+	}
+}
+
+func TestResolvedCounterCountsEachResolutionOnce(t *testing.T) {
+	e := testExporter()
+	const name = "alertmanager_sync_inconsistencies_resolved_total"
+	before := metricValue(t, name)
+
+	for i := 0; i < 3; i++ {
+		e.RecordInconsistencyResolved()
+	}
+	e.RecordReconciliationSuccess(5)
+
+	if got := metricValue(t, name) - before; got != 3 {
+		t.Errorf("%s increased by %v after 3 resolutions, want 3", name, got)
+	}
+	if got := metricValue(t, "alertmanager_sync_inconsistencies_found"); got != 5 {
+		t.Errorf("alertmanager_sync_inconsistencies_found = %v, want 5", got)
+	}
+}
+
+func TestNewAlertLabelSet(t *testing.T) {
+	defaults := []string{"alertname", "fingerprint", "state"}
+	tests := []struct {
+		name             string
+		labels           []string
+		annotations      []string
+		fields           []string
+		wantAll          []string
+		wantLabels       []string
+		wantFields       []string
+		wantAnnotations  map[string]string
+		wantAnnotationsN int
+	}{
+		{
+			name:            "no collisions",
+			labels:          []string{"severity"},
+			annotations:     []string{"summary"},
+			wantAll:         []string{"alertname", "fingerprint", "state", "severity", "summary"},
+			wantLabels:      []string{"severity"},
+			wantAnnotations: map[string]string{"summary": "summary"},
+		},
+		{
+			name:            "annotation sharing a name with an alert label",
+			labels:          []string{"severity"},
+			annotations:     []string{"severity"},
+			wantAll:         []string{"alertname", "fingerprint", "state", "severity", "annotation_severity"},
+			wantLabels:      []string{"severity"},
+			wantAnnotations: map[string]string{"severity": "annotation_severity"},
+		},
+		{
+			name:            "annotation sharing a name with a default label",
+			annotations:     []string{"state"},
+			wantAll:         []string{"alertname", "fingerprint", "state", "annotation_state"},
+			wantLabels:      []string{},
+			wantAnnotations: map[string]string{"state": "annotation_state"},
+		},
+		{
+			name:            "alert label colliding with a default label is dropped",
+			labels:          []string{"state", "team"},
+			wantAll:         []string{"alertname", "fingerprint", "state", "team"},
+			wantLabels:      []string{"team"},
+			wantAnnotations: map[string]string{},
+		},
+		{
+			name:            "prefixed name colliding too is dropped",
+			labels:          []string{"team", "annotation_team"},
+			annotations:     []string{"team", "team"},
+			wantAll:         []string{"alertname", "fingerprint", "state", "team", "annotation_team"},
+			wantLabels:      []string{"team", "annotation_team"},
+			wantAnnotations: map[string]string{},
+		},
+		{
+			name:            "field colliding with another label is dropped",
+			labels:          []string{"team"},
+			annotations:     []string{"summary"},
+			fields:          []string{"service", "state", "summary", "team"},
+			wantAll:         []string{"alertname", "fingerprint", "state", "team", "summary", "service"},
+			wantLabels:      []string{"team"},
+			wantAnnotations: map[string]string{"summary": "summary"},
+			wantFields:      []string{"service"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := newAlertLabelSet(defaults, tt.labels, tt.annotations, tt.fields)
+			if !slices.Equal(set.all, tt.wantAll) {
+				t.Errorf("all labels = %v, want %v", set.all, tt.wantAll)
+			}
+			if !slices.Equal(set.labels, tt.wantLabels) {
+				t.Errorf("alert labels = %v, want %v", set.labels, tt.wantLabels)
+			}
+			if !slices.Equal(set.fields, tt.wantFields) {
+				t.Errorf("fields = %v, want %v", set.fields, tt.wantFields)
+			}
+			if !maps.Equal(set.annotationLabels, tt.wantAnnotations) {
+				t.Errorf("annotation labels = %v, want %v", set.annotationLabels, tt.wantAnnotations)
+			}
+			if len(set.annotations) != len(tt.wantAnnotations) {
+				t.Errorf("annotations = %v, want one per annotation label in %v", set.annotations, tt.wantAnnotations)
+			}
+		})
+	}
+}
+
+func TestExportAlertAnnotationCollision(t *testing.T) {
+	e, registry := isolatedExporter(t, config.MetricsConfig{AlertLabels: []string{"severity"}, AlertAnnotations: []string{"severity"}})
+
+	alert := testAlert("fp1", "DiskFull", "active")
+	alert.Labels["severity"] = "critical"
+	alert.Annotations = models.LabelSet{"severity": "page the database team"}
+	if err := e.exportAlert(context.Background(), alert, nil, nil, nil, nil); err != nil {
+		t.Fatalf("exportAlert() error = %v", err)
+	}
+
+	got := singleSeriesLabels(t, registry)
+	if got["severity"] != "critical" || got["annotation_severity"] != "page the database team" {
+		t.Errorf("severity=%q annotation_severity=%q, want the label and the annotation kept apart", got["severity"], got["annotation_severity"])
+	}
+}
+
+func TestExportAlertSilenceComment(t *testing.T) {
+	comment := "database failover, see the maintenance calendar"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"id":        "s1",
+			"comment":   comment,
+			"createdBy": "oncall@example.com",
+			"startsAt":  "2024-01-01T00:00:00Z",
+			"endsAt":    "2024-01-01T01:00:00Z",
+			"updatedAt": "2024-01-01T00:00:00Z",
+			"matchers":  []map[string]any{{"name": "alertname", "value": "DiskFull", "isRegex": false, "isEqual": true}},
+			"status":    map[string]string{"state": "active"},
+		})
+	}))
+	defer srv.Close()
+	amClient := alertmanager.NewClient(config.AlertmanagerConfig{Host: strings.TrimPrefix(srv.URL, "http://")})
+
+	tests := []struct {
+		name      string
+		maxLength int
+		want      string
+	}{
+		{name: "short comment", maxLength: 100, want: comment},
+		{name: "truncated comment", maxLength: 17, want: "database failove…"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, registry := isolatedExporter(t, config.MetricsConfig{SilenceCommentLabel: true, SilenceCommentMaxLength: tt.maxLength})
+
+			alert := testAlert("fp1", "DiskFull", "suppressed")
+			alert.Status.SilencedBy = []string{"s1"}
+			if err := e.exportAlert(context.Background(), alert, nil, nil, nil, amClient); err != nil {
+				t.Fatalf("exportAlert() error = %v", err)
+			}
+
+			got := singleSeriesLabels(t, registry)
+			if got["silence_comment"] != tt.want {
+				t.Errorf("silence_comment = %q, want %q", got["silence_comment"], tt.want)
+			}
+			if got["silenced_by"] != "oncall@example.com" {
+				t.Errorf("silenced_by = %q, want oncall@example.com", got["silenced_by"])
+			}
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		maxLength int
+		want      string
+	}{
+		{name: "no limit", value: "disk full", maxLength: 0, want: "disk full"},
+		{name: "negative limit", value: "disk full", maxLength: -1, want: "disk full"},
+		{name: "shorter than limit", value: "disk", maxLength: 10, want: "disk"},
+		{name: "exactly the limit", value: "disk full", maxLength: 9, want: "disk full"},
+		{name: "cut with ellipsis", value: "disk full", maxLength: 5, want: "disk…"},
+		{name: "limit of two", value: "disk full", maxLength: 2, want: "d…"},
+		{name: "limit of one", value: "disk full", maxLength: 1, want: "d"},
+		{name: "multibyte runes", value: "ディスク容量不足", maxLength: 4, want: "ディス…"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncate(tt.value, tt.maxLength)
+			if got != tt.want {
+				t.Errorf("truncate(%q, %d) = %q, want %q", tt.value, tt.maxLength, got, tt.want)
+			}
+			if tt.maxLength > 0 && len([]rune(got)) > tt.maxLength {
+				t.Errorf("truncate(%q, %d) returned %d characters, more than the limit", tt.value, tt.maxLength, len([]rune(got)))
+			}
+		})
+	}
+}
+
+func TestSanitizeLabelValue(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		maxLength int
+		want      string
+	}{
+		{name: "plain value", value: "disk full", maxLength: 100, want: "disk full"},
+		{name: "multiline value", value: "disk full\non /var\r\n\tcheck it", maxLength: 100, want: "disk full on /var   check it"},
+		{name: "invalid utf-8", value: "disk\xff full", maxLength: 100, want: "disk full"},
+		{name: "oversized value", value: strings.Repeat("x", 5000), maxLength: 10, want: strings.Repeat("x", 9) + "…"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sanitizeLabelValue(tt.value, tt.maxLength); got != tt.want {
+				t.Errorf("sanitizeLabelValue(%q, %d) = %q, want %q", tt.value, tt.maxLength, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExportAlertSanitizesLabelValues(t *testing.T) {
+	e, registry := isolatedExporter(t, config.MetricsConfig{AlertAnnotations: []string{"description"}, MaxLabelValueLength: 20})
+
+	alert := testAlert("fp1", "DiskFull", "active")
+	alert.Annotations = models.LabelSet{"description": "The disk is full.\nRunbook: " + strings.Repeat("https://runbooks.example.com/", 100)}
+	if err := e.exportAlert(context.Background(), alert, nil, nil, nil, nil); err != nil {
+		t.Fatalf("exportAlert() error = %v", err)
+	}
+
+	got := singleSeriesLabels(t, registry)
+	if want := "The disk is full. R…"; got["description"] != want {
+		t.Errorf("description = %q, want %q", got["description"], want)
+	}
+	if got["alertname"] != "DiskFull" {
+		t.Errorf("alertname = %q, want the short value unchanged", got["alertname"])
+	}
+}
+
+func TestIsResolved(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	past := strfmt.DateTime(now.Add(-time.Minute))
+	future := strfmt.DateTime(now.Add(time.Minute))
+
+	tests := []struct {
+		name   string
+		endsAt *strfmt.DateTime
+		state  string
+		want   bool
+	}{
+		{name: "no end time", endsAt: nil, state: alertStateUnknown, want: false},
+		{name: "ends in the future", endsAt: &future, state: alertStateActive, want: false},
+		{name: "ended without a state", endsAt: &past, state: alertStateUnknown, want: true},
+		{name: "ended while unprocessed", endsAt: &past, state: alertStateUnprocessed, want: true},
+		{name: "ended but still active", endsAt: &past, state: alertStateActive, want: false},
+		{name: "ended but still suppressed", endsAt: &past, state: alertStateSuppressed, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alert := &models.GettableAlert{Alert: models.Alert{Labels: models.LabelSet{"alertname": "DiskFull"}}, EndsAt: tt.endsAt}
+			if got := isResolved(alert, tt.state, now); got != tt.want {
+				t.Errorf("isResolved() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExportAlertsResolvedAlerts(t *testing.T) {
+	const resolvedMetric = "alertmanager_sync_resolved_alert"
+	e, registry := isolatedExporter(t, config.MetricsConfig{})
+	ctx := context.Background()
+	endedAt := time.Now().Add(-time.Minute).Truncate(time.Second)
+	ended := strfmt.DateTime(endedAt)
+
+	// First export: two firing alerts and one Alertmanager still returns after it ended
+	stale := testAlert("fp-ended", "Watchdog", alertStateUnprocessed)
+	stale.EndsAt = &ended
+	first := []*models.GettableAlert{testAlert("fp-disk", "DiskFull", "active"), testAlert("fp-latency", "HighLatency", "suppressed"), stale}
+	if err := e.ExportAlertsWithGrafana(ctx, first, nil, nil, nil); err != nil {
+		t.Fatalf("first ExportAlertsWithGrafana() error = %v", err)
+	}
+	resolved := gatheredGaugeValues(t, registry, resolvedMetric, "fingerprint")
+	if want := map[string]float64{"fp-ended": float64(endedAt.Unix())}; !maps.Equal(resolved, want) {
+		t.Errorf("after the first export %s = %v, want %v", resolvedMetric, resolved, want)
+	}
+	if states := seriesLabels(t, registry, "alertmanager_sync_alert_state"); len(states) != 2 {
+		t.Errorf("after the first export alert_state series = %v, want the two firing alerts", states)
+	}
+
+	// Second export: fp-disk resolved and disappeared from Alertmanager
+	before := time.Now().Unix()
+	if err := e.ExportAlertsWithGrafana(ctx, []*models.GettableAlert{testAlert("fp-latency", "HighLatency", "suppressed")}, nil, nil, nil); err != nil {
+		t.Fatalf("second ExportAlertsWithGrafana() error = %v", err)
+	}
+	resolved = gatheredGaugeValues(t, registry, resolvedMetric, "fingerprint")
+	if len(resolved) != 1 || resolved["fp-disk"] < float64(before) {
+		t.Errorf("after the second export %s = %v, want only fp-disk, resolved during the export", resolvedMetric, resolved)
+	}
+	if got := seriesLabels(t, registry, resolvedMetric); len(got) != 1 || got[0]["alertname"] != "DiskFull" {
+		t.Errorf("resolved alert series = %v, want it labelled alertname=DiskFull", got)
+	}
+
+	// Third export: nothing changed, so nothing is reported resolved any more
+	if err := e.ExportAlertsWithGrafana(ctx, []*models.GettableAlert{testAlert("fp-latency", "HighLatency", "suppressed")}, nil, nil, nil); err != nil {
+		t.Fatalf("third ExportAlertsWithGrafana() error = %v", err)
+	}
+	if resolved := gatheredGaugeValues(t, registry, resolvedMetric, "fingerprint"); len(resolved) != 0 {
+		t.Errorf("after the third export %s = %v, want no series", resolvedMetric, resolved)
+	}
+}
+
+func TestExportAlertGroupState(t *testing.T) {
+	const metric = "alertmanager_sync_alert_group_state"
+	e, registry := isolatedExporter(t, config.MetricsConfig{AlertGroupState: true})
+
+	group := func(id, state, groupKey string, fingerprints ...string) grafana.AlertGroup {
+		g := grafana.AlertGroup{ID: id, State: state}
+		g.LastAlert.Payload.GroupKey = groupKey
+		for _, fingerprint := range fingerprints {
+			g.LastAlert.Payload.Alerts = append(g.LastAlert.Payload.Alerts, grafana.Alert{Fingerprint: fingerprint})
+		}
+		return g
+	}
+	groups := []grafana.AlertGroup{
+		group("IG1", "new", `{}:{alertname="HighLatency"}`, "fp1", "fp2", "fp3"),
+		group("IG2", "silenced", `{}:{alertname="DiskFull"}`, "fp4"),
+	}
+	alerts := []*models.GettableAlert{
+		testAlert("fp1", "HighLatency", "active"),
+		testAlert("fp2", "HighLatency", "active"),
+		testAlert("fp3", "HighLatency", "suppressed"),
+		testAlert("fp4", "DiskFull", "suppressed"),
+		testAlert("fp5", "NodeDown", "active"),
+	}
+	if err := e.ExportAlertsWithGrafana(context.Background(), alerts, groups, nil, nil); err != nil {
+		t.Fatalf("ExportAlertsWithGrafana() error = %v", err)
+	}
+
+	got := gatheredGaugeValues(t, registry, metric, "alert_group_id")
+	if want := map[string]float64{"IG1": 2, "IG2": 0}; !maps.Equal(got, want) {
+		t.Errorf("%s by alert group = %v, want %v", metric, got, want)
+	}
+	for _, labels := range seriesLabels(t, registry, metric) {
+		if labels["alert_group_id"] == "IG1" && (labels["group_key"] != `{}:{alertname="HighLatency"}` || labels["state"] != "new") {
+			t.Errorf("IG1 series labels = %v, want its group key and IRM state", labels)
+		}
+	}
+}
+
+func TestExportAlertGroupStateDisabled(t *testing.T) {
+	e, registry := isolatedExporter(t, config.MetricsConfig{})
+	groups := []grafana.AlertGroup{{ID: "IG1", State: "new"}}
+	groups[0].LastAlert.Payload.Alerts = []grafana.Alert{{Fingerprint: "fp1"}}
+	if err := e.ExportAlertsWithGrafana(context.Background(), []*models.GettableAlert{testAlert("fp1", "HighLatency", "active")}, groups, nil, nil); err != nil {
+		t.Fatalf("ExportAlertsWithGrafana() error = %v", err)
+	}
+	if series := seriesLabels(t, registry, "alertmanager_sync_alert_group_state"); len(series) != 0 {
+		t.Errorf("alert_group_state series = %v, want none when disabled", series)
+	}
+}
+
+func TestFieldValue(t *testing.T) {
+	sources := parseFieldSources([]string{"label:service", "annotation:service_name", "bogus"})
+
+	tests := []struct {
+		name        string
+		labels      models.LabelSet
+		annotations models.LabelSet
+		want        string
+	}{
+		{
+			name:        "label present",
+			labels:      models.LabelSet{"service": "checkout"},
+			annotations: models.LabelSet{"service_name": "checkout-annotation"},
+			want:        "checkout",
+		},
+		{
+			name:        "annotation fallback",
+			labels:      models.LabelSet{"alertname": "DiskFull"},
+			annotations: models.LabelSet{"service_name": "payments"},
+			want:        "payments",
+		},
+		{
+			name:        "empty label falls back",
+			labels:      models.LabelSet{"service": ""},
+			annotations: models.LabelSet{"service_name": "payments"},
+			want:        "payments",
+		},
+		{
+			name:   "neither set",
+			labels: models.LabelSet{"alertname": "DiskFull"},
+			want:   "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alert := &models.GettableAlert{Alert: models.Alert{Labels: tt.labels}, Annotations: tt.annotations}
+			if got := fieldValue(alert, sources); got != tt.want {
+				t.Errorf("fieldValue() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExportAlertFields(t *testing.T) {
+	e, registry := isolatedExporter(t, config.MetricsConfig{
+		Fields: map[string][]string{"service": {"label:service", "annotation:service_name"}},
+	})
+
+	labelled := testAlert("fp-label", "DiskFull", "active")
+	labelled.Labels["service"] = "checkout"
+	annotated := testAlert("fp-annotation", "HighLatency", "active")
+	annotated.Annotations = models.LabelSet{"service_name": "payments"}
+	neither := testAlert("fp-neither", "NodeDown", "active")
+
+	alerts := []*models.GettableAlert{labelled, annotated, neither}
+	if err := e.ExportAlertsWithGrafana(context.Background(), alerts, nil, nil, nil); err != nil {
+		t.Fatalf("ExportAlertsWithGrafana() error = %v", err)
+	}
+
+	got := make(map[string]string)
+	for _, labels := range seriesLabels(t, registry, "alertmanager_sync_alert_state") {
+		got[labels["fingerprint"]] = labels["service"]
+	}
+	want := map[string]string{"fp-label": "checkout", "fp-annotation": "payments", "fp-neither": ""}
+	if !maps.Equal(got, want) {
+		t.Errorf("service label by fingerprint = %v, want %v", got, want)
+	}
+}
+
+func TestExportFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter string
+		want   []string
+	}{
+		{name: "no filter", want: []string{"fp-critical", "fp-info", "fp-warning"}},
+		{name: "includes matching alerts", filter: `{severity=~"critical|warning"}`, want: []string{"fp-critical", "fp-warning"}},
+		{name: "excludes matching alerts", filter: `severity!="info"`, want: []string{"fp-critical", "fp-warning"}},
+		{name: "several matchers", filter: `{severity="critical",team="sre"}`, want: []string{"fp-critical"}},
+		{name: "nothing matches", filter: `team="payments"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, registry := isolatedExporter(t, config.MetricsConfig{ExportFilter: tt.filter})
+
+			alerts := make([]*models.GettableAlert, 0, 3)
+			for _, severity := range []string{"critical", "warning", "info"} {
+				alert := testAlert("fp-"+severity, "DiskFull", "active")
+				alert.Labels["severity"] = severity
+				alert.Labels["team"] = "sre"
+				alerts = append(alerts, alert)
+			}
+			if err := e.ExportAlertsWithGrafana(context.Background(), alerts, nil, nil, nil); err != nil {
+				t.Fatalf("ExportAlertsWithGrafana() error = %v", err)
+			}
+
+			var got []string
+			for _, labels := range seriesLabels(t, registry, "alertmanager_sync_alert_state") {
+				got = append(got, labels["fingerprint"])
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("exported alerts = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExportTenant(t *testing.T) {
+	tests := []struct {
+		name   string
+		tenant config.TenantConfig
+		filter string
+		want   []string
+	}{
+		{name: "no tenant", want: []string{"fp-no-tenant", "fp-payments", "fp-search"}},
+		{name: "matching tenant", tenant: config.TenantConfig{Label: "tenant", Value: "payments"}, want: []string{"fp-payments"}},
+		{name: "combined with the export filter", tenant: config.TenantConfig{Label: "tenant", Value: "payments"}, filter: `severity="info"`},
+		{name: "no alert of the tenant", tenant: config.TenantConfig{Label: "tenant", Value: "billing"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, registry := isolatedTenantExporter(t, config.MetricsConfig{ExportFilter: tt.filter}, tt.tenant)
+
+			payments := testAlert("fp-payments", "DiskFull", "active")
+			payments.Labels["tenant"] = "payments"
+			payments.Labels["severity"] = "critical"
+			search := testAlert("fp-search", "DiskFull", "active")
+			search.Labels["tenant"] = "search"
+			alerts := []*models.GettableAlert{payments, search, testAlert("fp-no-tenant", "DiskFull", "active")}
+			if err := e.ExportAlertsWithGrafana(context.Background(), alerts, nil, nil, nil); err != nil {
+				t.Fatalf("ExportAlertsWithGrafana() error = %v", err)
+			}
+
+			var got []string
+			for _, labels := range seriesLabels(t, registry, "alertmanager_sync_alert_state") {
+				got = append(got, labels["fingerprint"])
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("exported alerts = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectDefaultLabels(t *testing.T) {
+	tests := []struct {
+		name         string
+		selection    []string
+		wantEnabled  []string
+		wantDisabled []string
+	}{
+		{name: "no selection keeps every default label", wantEnabled: config.DefaultAlertLabels},
+		{
+			name:         "reduced selection",
+			selection:    []string{"state", "suppressed"},
+			wantEnabled:  []string{"state", "suppressed"},
+			wantDisabled: []string{"fingerprint", "acknowledged_by", "resolved_by", "silenced_by", "inhibited_by", "inhibited_by_alertname", "alert_group_id", "acknowledged_at", "created_at", "resolved_at"},
+		},
+		{
+			name:         "unknown labels ignored",
+			selection:    []string{"severity", "state", "state"},
+			wantEnabled:  []string{"state"},
+			wantDisabled: []string{"fingerprint", "suppressed", "acknowledged_by", "resolved_by", "silenced_by", "inhibited_by", "inhibited_by_alertname", "alert_group_id", "acknowledged_at", "created_at", "resolved_at"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enabled, disabled := selectDefaultLabels(tt.selection)
+			if !slices.Equal(enabled, tt.wantEnabled) || !slices.Equal(disabled, tt.wantDisabled) {
+				t.Errorf("selectDefaultLabels(%v) = %v, %v, want %v, %v", tt.selection, enabled, disabled, tt.wantEnabled, tt.wantDisabled)
+			}
+		})
+	}
+}
+
+func TestExportAlertsReducedDefaultLabels(t *testing.T) {
+	e, registry := isolatedExporter(t, config.MetricsConfig{
+		DefaultLabels: []string{"state", "silenced_by"},
+		AlertLabels:   []string{"severity"},
+	})
+
+	alert := testAlert("fp1", "DiskFull", "active")
+	alert.Labels["severity"] = "critical"
+	if err := e.ExportAlerts(context.Background(), []*models.GettableAlert{alert}, nil); err != nil {
+		t.Fatalf("ExportAlerts() error = %v", err)
+	}
+
+	series := seriesLabels(t, registry, "alertmanager_sync_alert_state")
+	want := map[string]string{"alertname": "DiskFull", "state": "active", "silenced_by": "", "severity": "critical"}
+	if len(series) != 1 || !maps.Equal(series[0], want) {
+		t.Errorf("alert state series = %v, want a single series labelled %v", series, want)
+	}
+}
+
+func TestExportAlertUpdatedTimestamp(t *testing.T) {
+	updatedAt := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	updated := testAlert("fp-updated", "DiskFull", "active")
+	updated.UpdatedAt = (*strfmt.DateTime)(&updatedAt)
+	alerts := []*models.GettableAlert{updated, testAlert("fp-no-update", "Watchdog", "active")}
+
+	if err := testExporter().ExportAlerts(context.Background(), alerts, nil); err != nil {
+		t.Fatalf("ExportAlerts() error = %v", err)
+	}
+
+	want := map[string]float64{"fp-updated": float64(updatedAt.Unix())}
+	if got := gaugeValues(t, "alertmanager_sync_alert_updated_timestamp_seconds", "fingerprint"); !maps.Equal(got, want) {
+		t.Errorf("alertmanager_sync_alert_updated_timestamp_seconds = %v, want %v", got, want)
+	}
+}
+
+func TestRecordGrafanaGroupSizes(t *testing.T) {
+	const name = "alertmanager_sync_grafana_group_alert_count"
+	before := histogramBuckets(t, name)
+
+	testExporter().RecordGrafanaGroupSizes([]grafana.AlertGroup{
+		{ID: "IG1", AlertsCount: 1},
+		{ID: "IG2", AlertsCount: 3},
+		{ID: "IG3", AlertsCount: 3},
+		{ID: "IG4", AlertsCount: 600},
+	})
+
+	after := histogramBuckets(t, name)
+	for upperBound, want := range map[float64]uint64{1: 1, 2: 1, 4: 3, 512: 3, 1024: 4} {
+		if got := after[upperBound] - before[upperBound]; got != want {
+			t.Errorf("bucket le=%g grew by %d, want %d", upperBound, got, want)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package metrics
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/config"
+	"github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	exporterOnce sync.Once
+	exporter     *Exporter
+)
+
+// testExporter returns the exporter shared by the package tests, as its metrics can only be registered once
+func testExporter() *Exporter {
+	exporterOnce.Do(func() {
+		exporter = NewExporter(config.MetricsConfig{}, config.TenantConfig{})
+	})
+	return exporter
+}
+
+// testAlert builds an Alertmanager alert in the given state, inhibited by the given fingerprints
+func testAlert(fingerprint, alertname, state string, inhibitedBy ...string) *models.GettableAlert {
+	return &models.GettableAlert{
+		Alert:       models.Alert{Labels: models.LabelSet{"alertname": alertname}},
+		Fingerprint: &fingerprint,
+		Status: &models.AlertStatus{
+			State:       &state,
+			SilencedBy:  []string{},
+			InhibitedBy: append([]string{}, inhibitedBy...),
+		},
+	}
+}
+
+// alertStateSeries returns the labels of every exported alert_state series, keyed by fingerprint
+func alertStateSeries(t *testing.T) map[string]map[string]string {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("gathering metrics: %v", err)
+	}
+
+	series := make(map[string]map[string]string)
+	for _, family := range families {
+		if family.GetName() != "alertmanager_sync_alert_state" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := make(map[string]string, len(metric.GetLabel()))
+			for _, pair := range metric.GetLabel() {
+				labels[pair.GetName()] = pair.GetValue()
+			}
+			series[labels["fingerprint"]] = labels
+		}
+	}
+	return series
+}
+
+// metricValue returns the sum of every series of a registered counter or gauge
+func metricValue(t *testing.T, name string) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("gathering metrics: %v", err)
+	}
+
+	total := 0.0
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			total += metric.GetCounter().GetValue() + metric.GetGauge().GetValue()
+		}
+	}
+	return total
+}
+
+// labeledMetricValue returns the value of the series of a registered metric matching all the given labels
+func labeledMetricValue(t *testing.T, name string, labels map[string]string) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("gathering metrics: %v", err)
+	}
+
+	total := 0.0
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	series:
+		for _, metric := range family.GetMetric() {
+			matched := 0
+			for _, pair := range metric.GetLabel() {
+				want, ok := labels[pair.GetName()]
+				if !ok {
+					continue
+				}
+				if pair.GetValue() != want {
+					continue series
+				}
+				matched++
+			}
+			if matched == len(labels) {
+				total += metric.GetCounter().GetValue() + metric.GetGauge().GetValue()
+			}
+		}
+	}
+	return total
+}
+
+// gaugeValues returns the values of every series of a registered gauge, keyed by the given label
+func gaugeValues(t *testing.T, name, label string) map[string]float64 {
+	t.Helper()
+	return gatheredGaugeValues(t, prometheus.DefaultGatherer, name, label)
+}
+
+// gatheredGaugeValues returns the values of every series of a gauge gathered from gatherer, keyed by the given label
+func gatheredGaugeValues(t *testing.T, gatherer prometheus.Gatherer, name, label string) map[string]float64 {
+	t.Helper()
+	families, err := gatherer.Gather()
+	if err != nil {
+		t.Fatalf("gathering metrics: %v", err)
+	}
+
+	values := make(map[string]float64)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, pair := range metric.GetLabel() {
+				if pair.GetName() == label {
+					values[pair.GetValue()] = metric.GetGauge().GetValue()
+				}
+			}
+		}
+	}
+	return values
+}
+
+// withReceivers sets the receivers the alert is routed to
+func withReceivers(alert *models.GettableAlert, names ...string) *models.GettableAlert {
+	for _, name := range names {
+		alert.Receivers = append(alert.Receivers, &models.Receiver{Name: &name})
+	}
+	return alert
+}
+
+// singleSeriesLabels returns the labels of the only alert_state series gathered from registry
+func singleSeriesLabels(t *testing.T, registry *prometheus.Registry) map[string]string {
+	t.Helper()
+	series := seriesLabels(t, registry, "alertmanager_sync_alert_state")
+	if len(series) != 1 {
+		t.Fatalf("gathered alert_state series %v, want a single series", series)
+	}
+	return series[0]
+}
+
+// isolatedExporter builds an exporter for cfg whose metrics are registered on a fresh registry
+// rather than the default one, so tests can use label configurations other than testExporter's
+func isolatedExporter(t *testing.T, cfg config.MetricsConfig) (*Exporter, *prometheus.Registry) {
+	t.Helper()
+	return isolatedTenantExporter(t, cfg, config.TenantConfig{})
+}
+
+// isolatedTenantExporter is isolatedExporter scoped to the alerts of tenant
+func isolatedTenantExporter(t *testing.T, cfg config.MetricsConfig, tenant config.TenantConfig) (*Exporter, *prometheus.Registry) {
+	t.Helper()
+	registry := prometheus.NewRegistry()
+	defaultRegisterer := prometheus.DefaultRegisterer
+	prometheus.DefaultRegisterer = registry
+	defer func() { prometheus.DefaultRegisterer = defaultRegisterer }()
+	return NewExporter(cfg, tenant), registry
+}
+
+// seriesLabels returns the labels of every series of the named metric gathered from registry
+func seriesLabels(t *testing.T, registry *prometheus.Registry, name string) []map[string]string {
+	t.Helper()
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("gathering metrics: %v", err)
+	}
+	var series []map[string]string
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := make(map[string]string, len(metric.GetLabel()))
+			for _, pair := range metric.GetLabel() {
+				labels[pair.GetName()] = pair.GetValue()
+			}
+			series = append(series, labels)
+		}
+	}
+	return series
+}
+
+// histogramBuckets returns the cumulative count of each bucket of a registered histogram without labels, keyed by upper bound
+func histogramBuckets(t *testing.T, name string) map[float64]uint64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("gathering metrics: %v", err)
+	}
+
+	buckets := make(map[float64]uint64)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, bucket := range metric.GetHistogram().GetBucket() {
+				buckets[bucket.GetUpperBound()] = bucket.GetCumulativeCount()
+			}
+		}
+	}
+	return buckets
+}
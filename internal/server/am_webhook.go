@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/logging"
+)
+
+// amWebhookRefreshTimeout bounds the reconciliation cycle triggered by an Alertmanager webhook
+const amWebhookRefreshTimeout = 2 * time.Minute
+
+// AlertmanagerWebhookPayload is the payload of an Alertmanager webhook notification (version 4)
+type AlertmanagerWebhookPayload struct {
+	Version           string            `json:"version"`
+	GroupKey          string            `json:"groupKey"`
+	TruncatedAlerts   int               `json:"truncatedAlerts"`
+	Status            string            `json:"status"`
+	Receiver          string            `json:"receiver"`
+	GroupLabels       map[string]string `json:"groupLabels"`
+	CommonLabels      map[string]string `json:"commonLabels"`
+	CommonAnnotations map[string]string `json:"commonAnnotations"`
+	ExternalURL       string            `json:"externalURL"`
+	Alerts            []struct {
+		Status       string            `json:"status"`
+		Labels       map[string]string `json:"labels"`
+		Annotations  map[string]string `json:"annotations"`
+		StartsAt     string            `json:"startsAt"`
+		EndsAt       string            `json:"endsAt"`
+		GeneratorURL string            `json:"generatorURL"`
+		Fingerprint  string            `json:"fingerprint"`
+	} `json:"alerts"`
+}
+
+// SetRefresher registers the function run when an Alertmanager webhook is received,
+// typically the reconciler's ReconcileAndResolve
+func (h *WebhookHandler) SetRefresher(refresh func(ctx context.Context) error) {
+	h.refresh = refresh
+}
+
+// HandleAlertmanagerWebhook processes Alertmanager webhook notifications
+// Each notification triggers an immediate reconciliation instead of waiting for the next interval
+func (h *WebhookHandler) HandleAlertmanagerWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Tag every log line of this request with its correlation ID, shared with the access log
+	ctx := logging.EnsureID(r.Context())
+
+	// Limit the body size so oversized payloads can't exhaust memory
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxBodyBytes)
+
+	var payload AlertmanagerWebhookPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			logging.Printf(ctx, "Alertmanager webhook payload exceeds %d bytes", maxBytesErr.Limit)
+			http.Error(w, "Payload too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		logging.Printf(ctx, "Failed to decode Alertmanager webhook payload: %v", err)
+		http.Error(w, "Invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	logging.Printf(ctx, "Received Alertmanager webhook from receiver %s (status: %s, %d alerts)",
+		payload.Receiver, payload.Status, len(payload.Alerts))
+	for _, alert := range payload.Alerts {
+		logging.Printf(ctx, "Affected alert %s (fingerprint: %s, status: %s)",
+			alert.Labels["alertname"], alert.Fingerprint, alert.Status)
+	}
+
+	status := h.triggerRefresh(ctx)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"status": status})
+}
+
+// triggerRefresh starts a background reconciliation unless one triggered by a webhook is already running
+// It returns the status reported to the caller: refresh_started, refresh_in_progress or ignored
+func (h *WebhookHandler) triggerRefresh(ctx context.Context) string {
+	if h.refresh == nil {
+		logging.Println(ctx, "No reconciler configured, ignoring Alertmanager webhook")
+		return "ignored"
+	}
+
+	if !h.refreshing.CompareAndSwap(false, true) {
+		logging.Println(ctx, "Refresh already in progress, coalescing Alertmanager webhook")
+		return "refresh_in_progress"
+	}
+
+	// The refresh outlives the request, so it only keeps the correlation ID
+	refreshCtx, cancel := context.WithTimeout(logging.WithID(context.Background(), logging.ID(ctx)), amWebhookRefreshTimeout)
+	h.refreshes.Add(1)
+	go func() {
+		defer h.refreshes.Done()
+		defer cancel()
+		defer h.refreshing.Store(false)
+
+		logging.Println(refreshCtx, "Running reconciliation triggered by Alertmanager webhook...")
+		if err := h.refresh(refreshCtx); err != nil {
+			logging.Printf(refreshCtx, "Reconciliation triggered by Alertmanager webhook failed: %v", err)
+			return
+		}
+		logging.Println(refreshCtx, "Reconciliation triggered by Alertmanager webhook completed")
+	}()
+
+	return "refresh_started"
+}
+
+// RefreshesDone returns a channel closed once no triggered refresh is running anymore
+// Shutdown waits on it so a reconciliation started by a webhook isn't cut short
+func (h *WebhookHandler) RefreshesDone() <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		h.refreshes.Wait()
+		close(done)
+	}()
+	return done
+}
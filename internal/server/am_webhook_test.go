@@ -0,0 +1,181 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// amWebhookPayload is a sample Alertmanager webhook notification
+const amWebhookPayload = `{
+	"version": "4",
+	"groupKey": "{}:{alertname=\"DiskFull\"}",
+	"status": "firing",
+	"receiver": "alert-sync",
+	"groupLabels": {"alertname": "DiskFull"},
+	"commonLabels": {"alertname": "DiskFull", "severity": "critical"},
+	"commonAnnotations": {},
+	"externalURL": "http://alertmanager:9093",
+	"alerts": [{
+		"status": "firing",
+		"labels": {"alertname": "DiskFull", "instance": "db-1"},
+		"annotations": {"summary": "Disk is full"},
+		"startsAt": "2024-01-01T00:00:00Z",
+		"endsAt": "0001-01-01T00:00:00Z",
+		"generatorURL": "http://prometheus:9090/graph",
+		"fingerprint": "fp1"
+	}]
+}`
+
+// postAMWebhook posts an Alertmanager webhook through the registered routes and returns the response
+func postAMWebhook(t *testing.T, h *WebhookHandler, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+
+	req := httptest.NewRequest(http.MethodPost, "/am-webhook", strings.NewReader(body))
+	req.SetBasicAuth("irm", "secret")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+// responseStatus decodes the status field of a JSON response
+func responseStatus(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	var response map[string]string
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	return response["status"]
+}
+
+func TestHandleAlertmanagerWebhook(t *testing.T) {
+	h := NewWebhookHandler(nil, nil, nil, testWebhookConfig())
+	started := make(chan struct{})
+	release := make(chan struct{})
+	h.SetRefresher(func(ctx context.Context) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	})
+
+	rec := postAMWebhook(t, h, amWebhookPayload)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusAccepted)
+	}
+	if got := responseStatus(t, rec); got != "refresh_started" {
+		t.Errorf("response status = %q, want refresh_started", got)
+	}
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("refresh was not run")
+	}
+
+	// Webhooks received while the refresh runs are coalesced into it
+	if got := responseStatus(t, postAMWebhook(t, h, amWebhookPayload)); got != "refresh_in_progress" {
+		t.Errorf("response status during a refresh = %q, want refresh_in_progress", got)
+	}
+	close(release)
+}
+
+func TestHandleAlertmanagerWebhookErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		refresher  bool
+		noAuth     bool
+		wantCode   int
+		wantStatus string
+	}{
+		{name: "no reconciler", body: amWebhookPayload, wantCode: http.StatusAccepted, wantStatus: "ignored"},
+		{name: "invalid payload", body: `{"alerts": [`, refresher: true, wantCode: http.StatusBadRequest},
+		{name: "missing credentials", body: amWebhookPayload, refresher: true, noAuth: true, wantCode: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewWebhookHandler(nil, nil, nil, testWebhookConfig())
+			refreshed := false
+			if tt.refresher {
+				h.SetRefresher(func(ctx context.Context) error {
+					refreshed = true
+					return nil
+				})
+			}
+
+			var rec *httptest.ResponseRecorder
+			if tt.noAuth {
+				mux := http.NewServeMux()
+				h.RegisterRoutes(mux)
+				rec = httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/am-webhook", strings.NewReader(tt.body)))
+			} else {
+				rec = postAMWebhook(t, h, tt.body)
+			}
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if tt.wantStatus != "" {
+				if got := responseStatus(t, rec); got != tt.wantStatus {
+					t.Errorf("response status = %q, want %q", got, tt.wantStatus)
+				}
+			}
+			if refreshed {
+				t.Error("refresh ran for a rejected webhook")
+			}
+		})
+	}
+}
+
+func TestRefreshesDoneWaitsForTriggeredRefresh(t *testing.T) {
+	release := make(chan struct{})
+	finished := make(chan struct{})
+	h := &WebhookHandler{}
+	h.SetRefresher(func(ctx context.Context) error {
+		<-release
+		close(finished)
+		return nil
+	})
+
+	if status := h.triggerRefresh(context.Background()); status != "refresh_started" {
+		t.Fatalf("triggerRefresh() = %q, want refresh_started", status)
+	}
+	if status := h.triggerRefresh(context.Background()); status != "refresh_in_progress" {
+		t.Fatalf("second triggerRefresh() = %q, want refresh_in_progress", status)
+	}
+
+	done := h.RefreshesDone()
+	select {
+	case <-done:
+		t.Fatal("RefreshesDone() closed while a refresh was still running")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("RefreshesDone() not closed after the refresh completed")
+	}
+	select {
+	case <-finished:
+	default:
+		t.Error("RefreshesDone() closed before the refresh finished")
+	}
+}
+
+func TestRefreshesDoneWithoutRefresh(t *testing.T) {
+	h := &WebhookHandler{}
+	select {
+	case <-h.RefreshesDone():
+	case <-time.After(time.Second):
+		t.Fatal("RefreshesDone() not closed without any refresh running")
+	}
+}
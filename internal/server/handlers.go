@@ -1,13 +1,21 @@
 package server
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
+	"time"
 
 	"github.com/gabrielpetry/alertmanager-alert-sync/internal/alertmanager"
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/audit"
 	"github.com/gabrielpetry/alertmanager-alert-sync/internal/grafana"
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/logging"
 	"github.com/gabrielpetry/alertmanager-alert-sync/internal/metrics"
 	"github.com/gabrielpetry/alertmanager-alert-sync/internal/sync"
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/version"
+	"github.com/prometheus/alertmanager/api/v2/models"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
@@ -17,6 +25,12 @@ type Server struct {
 	grafanaClient *grafana.Client
 	exporter      *metrics.Exporter
 	reconciler    *sync.Reconciler
+
+	// awaitFirstReconcile holds readiness until the first cycle completes; only set when the loop runs
+	awaitFirstReconcile bool
+
+	// health caches backend connectivity checks between probes
+	health healthCache
 }
 
 // NewServer creates a new server with all dependencies
@@ -39,28 +53,281 @@ func (s *Server) MetricsHandler(w http.ResponseWriter, r *http.Request) {
 	promhttp.Handler().ServeHTTP(w, r)
 }
 
+// ExportHandler fetches the current alerts from Alertmanager, exports them as metrics
+// and serves the resulting Prometheus metrics. It works without Grafana IRM configured.
+// When Grafana IRM is configured its alert groups are fetched too, so the export carries the same
+// Grafana labels as the reconciliation loop's instead of wiping them until the next cycle
+func (s *Server) ExportHandler(w http.ResponseWriter, r *http.Request) {
+	alerts, err := s.amClient.GetAllAlerts(r.Context())
+	if err != nil {
+		log.Printf("Failed to fetch alerts for export: %v", err)
+		s.exporter.RecordAlertExportFailure()
+		http.Error(w, fmt.Sprintf("Failed to fetch alerts: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	var groups []grafana.AlertGroup
+	if s.grafanaClient != nil {
+		groups, err = s.grafanaClient.GetAllAlertGroups(r.Context())
+		if err != nil {
+			log.Printf("Failed to fetch alert groups for export: %v", err)
+			s.exporter.RecordAlertExportFailure()
+			http.Error(w, fmt.Sprintf("Failed to fetch alert groups: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := s.exporter.ExportAlertsWithGrafana(r.Context(), alerts, groups, s.grafanaClient, s.amClient); err != nil {
+		log.Printf("Failed to export alerts: %v", err)
+		s.exporter.RecordAlertExportFailure()
+		http.Error(w, fmt.Sprintf("Failed to export alerts: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	promhttp.Handler().ServeHTTP(w, r)
+}
+
+// healthCheckTimeout bounds the dependency pings performed by the health endpoints
+const healthCheckTimeout = 5 * time.Second
+
+// HealthResponse is the JSON body returned by the health endpoints
+type HealthResponse struct {
+	Status        string `json:"status"`
+	Alertmanager  string `json:"alertmanager"`
+	Grafana       string `json:"grafana"`
+	LastReconcile string `json:"last_reconcile"`
+	Reason        string `json:"reason,omitempty"`
+}
+
+// checkHealth builds the health response from the cached backend connectivity result
+// It returns false when any dependency is down
+func (s *Server) checkHealth(ctx context.Context) (HealthResponse, bool) {
+	backends := s.cachedBackendHealth(ctx)
+
+	response := HealthResponse{
+		Status:       "ok",
+		Alertmanager: backends.alertmanager,
+		Grafana:      backends.grafana,
+	}
+	healthy := backends.healthy
+
+	if s.reconciler != nil {
+		if lastReconcile := s.reconciler.LastReconcileTime(); !lastReconcile.IsZero() {
+			response.LastReconcile = lastReconcile.UTC().Format(time.RFC3339)
+		}
+	}
+
+	if !healthy {
+		response.Status = "degraded"
+	}
+
+	return response, healthy
+}
+
+// writeHealth writes the health response as JSON with the given status code
+func writeHealth(w http.ResponseWriter, statusCode int, response HealthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(response)
+}
+
 // HealthzHandler provides a Kubernetes-style liveness probe endpoint
 // Returns 200 OK if the service is running and ready to accept traffic
 func (s *Server) HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	response, _ := s.checkHealth(r.Context())
+
 	// Check if reconciler is initialized (requires Grafana client)
 	if s.reconciler == nil {
-		http.Error(w, "Not ready: reconciler not initialized", http.StatusServiceUnavailable)
+		response.Status = "unavailable"
+		response.Reason = "reconciler not initialized"
+		writeHealth(w, http.StatusServiceUnavailable, response)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, "OK\n")
+	writeHealth(w, http.StatusOK, response)
+}
+
+// SetReconcileLoopEnabled tells the readiness probe whether a background reconciliation loop runs
+// Readiness only waits for the first reconciliation when it does, since nothing else would ever complete one
+func (s *Server) SetReconcileLoopEnabled(enabled bool) {
+	s.awaitFirstReconcile = enabled
 }
 
 // ReadyzHandler provides a Kubernetes-style readiness probe endpoint
 // Returns 200 OK if the service is ready to accept traffic
 func (s *Server) ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	response, healthy := s.checkHealth(r.Context())
+
 	// Check if reconciler is initialized (requires Grafana client)
 	if s.reconciler == nil {
-		http.Error(w, "Not ready: reconciler not initialized", http.StatusServiceUnavailable)
+		response.Status = "unavailable"
+		response.Reason = "reconciler not initialized"
+		writeHealth(w, http.StatusServiceUnavailable, response)
+		return
+	}
+
+	// Wait for the first successful reconciliation so metrics are populated
+	if s.awaitFirstReconcile && !s.reconciler.FirstReconcileDone() {
+		response.Status = "unavailable"
+		response.Reason = "first reconciliation not completed"
+		writeHealth(w, http.StatusServiceUnavailable, response)
+		return
+	}
+
+	if !healthy {
+		response.Reason = "dependency unavailable"
+		writeHealth(w, http.StatusServiceUnavailable, response)
+		return
+	}
+
+	writeHealth(w, http.StatusOK, response)
+}
+
+// VersionHandler returns the build information of the running binary as JSON
+func (s *Server) VersionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(version.Get())
+}
+
+// InconsistencyResponse describes an inconsistency returned by the inconsistencies endpoint
+type InconsistencyResponse struct {
+	Fingerprint   string `json:"fingerprint"`
+	Alertname     string `json:"alertname"`
+	Reason        string `json:"reason"`
+	AlertGroupID  string `json:"alert_group_id"`
+	IntegrationID string `json:"integration_id"`
+	RouteID       string `json:"route_id"`
+}
+
+// InconsistenciesHandler lists the current inconsistencies without resolving them
+func (s *Server) InconsistenciesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if s.reconciler == nil {
+		http.Error(w, "Reconciler not initialized", http.StatusServiceUnavailable)
+		return
+	}
+
+	inconsistencies, err := s.reconciler.ReconcileAlerts(r.Context())
+	if err != nil {
+		log.Printf("Failed to compute inconsistencies: %v", err)
+		http.Error(w, fmt.Sprintf("Failed to compute inconsistencies: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]InconsistencyResponse, 0, len(inconsistencies))
+	for _, inconsistency := range inconsistencies {
+		response = append(response, InconsistencyResponse{
+			Fingerprint:   inconsistency.Fingerprint,
+			Alertname:     inconsistency.Alertname,
+			Reason:        inconsistency.Reason,
+			AlertGroupID:  inconsistency.GrafanaAlertGroupID,
+			IntegrationID: inconsistency.GrafanaIntegrationID,
+			RouteID:       inconsistency.GrafanaRouteID,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// ReconcileResponse is the JSON body returned by the reconcile endpoint
+type ReconcileResponse struct {
+	*sync.ReconcileResult
+	Error string `json:"error,omitempty"`
+}
+
+// ReconcileHandler runs a reconciliation cycle on demand and returns its summary
+// A failed cycle is reported with a 500 status, along with the counts gathered before it failed
+func (s *Server) ReconcileHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, "Ready\n")
+	if s.reconciler == nil {
+		http.Error(w, "Reconciler not initialized", http.StatusServiceUnavailable)
+		return
+	}
+
+	result, err := s.reconciler.ReconcileAndResolveOptimized(r.Context())
+	response := ReconcileResponse{ReconcileResult: result}
+	status := http.StatusOK
+	if err != nil {
+		log.Printf("On-demand reconciliation failed: %v", err)
+		response.Error = err.Error()
+		status = http.StatusInternalServerError
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// ExpireSilencesResponse is the JSON body returned by the silence expiry endpoint
+type ExpireSilencesResponse struct {
+	Found   int `json:"found"`
+	Expired int `json:"expired"`
+	Failed  int `json:"failed"`
+}
+
+// ExpireToolSilencesHandler expires every active silence created by the webhook
+// The request must carry confirm=true so a stray POST can't clear the silences
+func (s *Server) ExpireToolSilencesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.URL.Query().Get("confirm") != "true" {
+		http.Error(w, "Expiring every silence created by this tool requires confirm=true", http.StatusBadRequest)
+		return
+	}
+
+	ctx := logging.WithID(r.Context(), logging.NewID())
+	actor, _, _ := r.BasicAuth()
+
+	silences, err := s.amClient.FindSilencesByComment(ctx, alertmanager.ToolSilenceCommentPrefix)
+	if err != nil {
+		logging.Printf(ctx, "Failed to find silences to expire: %v", err)
+		http.Error(w, fmt.Sprintf("Failed to find silences: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	response := expireSilences(ctx, s.amClient, silences, audit.Event{
+		Actor:  actor,
+		Reason: "tool silences expired on request",
+	})
+	logging.Printf(ctx, "Expired %d of %d silences created by this tool (%d failed)", response.Expired, response.Found, response.Failed)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// expireSilences expires the active and pending silences among the given ones, auditing each attempt
+// with the actor, reason and alert group of the given event
+func expireSilences(ctx context.Context, amClient *alertmanager.Client, silences []*models.GettableSilence, event audit.Event) ExpireSilencesResponse {
+	var response ExpireSilencesResponse
+	for _, silence := range silences {
+		// Expired silences are still listed by Alertmanager, only active and pending ones are expired
+		if silence.ID == nil || silence.Status == nil || silence.Status.State == nil || *silence.Status.State == models.SilenceStatusStateExpired {
+			continue
+		}
+		response.Found++
+
+		err := amClient.ExpireSilence(ctx, *silence.ID)
+		event.Action = audit.ActionExpireSilence
+		event.SilenceID = *silence.ID
+		event.Err = err
+		audit.Record(ctx, event)
+		if err != nil {
+			logging.Printf(ctx, "Failed to expire silence %s: %v", *silence.ID, err)
+			response.Failed++
+			continue
+		}
+		response.Expired++
+	}
+	return response
 }
@@ -0,0 +1,417 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"slices"
+	"strings"
+	gosync "sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/alertmanager"
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/config"
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/sync"
+)
+
+func TestExportHandler(t *testing.T) {
+	tests := []struct {
+		name         string
+		alertmanager http.HandlerFunc
+		wantStatus   int
+		wantBody     string
+		wantFailures float64
+	}{
+		{
+			name:         "exports the fetched alerts",
+			alertmanager: alertmanagerAPI(testAlert("fp1", "DiskFull")),
+			wantStatus:   http.StatusOK,
+			wantBody:     `alertname="DiskFull"`,
+		},
+		{
+			name:         "fails when an alert can't be exported",
+			alertmanager: alertmanagerAPI(testAlert("fp1", "DiskFull"), testAlert("fp2", "HighLatency", "missing-silence")),
+			wantStatus:   http.StatusInternalServerError,
+			wantBody:     "Failed to export alerts",
+			wantFailures: 1,
+		},
+		{
+			name:         "fails when Alertmanager is unavailable",
+			alertmanager: unavailable,
+			wantStatus:   http.StatusInternalServerError,
+			wantBody:     "Failed to fetch alerts",
+			wantFailures: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := NewServer(newAlertmanagerStub(t, tt.alertmanager), nil, testExporter(), nil)
+			failures := metricValue(t, "alertmanager_sync_alert_export_failures_total")
+
+			rec := httptest.NewRecorder()
+			srv.ExportHandler(rec, httptest.NewRequest(http.MethodGet, "/export", nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("body does not contain %q:\n%s", tt.wantBody, rec.Body.String())
+			}
+			if got := metricValue(t, "alertmanager_sync_alert_export_failures_total") - failures; got != tt.wantFailures {
+				t.Errorf("alert export failures increased by %v, want %v", got, tt.wantFailures)
+			}
+		})
+	}
+}
+
+func TestHealthHandlers(t *testing.T) {
+	tests := []struct {
+		name         string
+		alertmanager http.HandlerFunc
+		grafana      http.HandlerFunc
+		noReconciler bool
+		loopEnabled  bool
+		reconcile    bool
+
+		wantHealthz int
+		wantReadyz  int
+		want        HealthResponse
+	}{
+		{
+			name:         "all up",
+			alertmanager: alertmanagerAPI(),
+			grafana:      jsonResponse(map[string]any{"results": []any{}}),
+			wantHealthz:  http.StatusOK,
+			wantReadyz:   http.StatusOK,
+			want:         HealthResponse{Status: "ok", Alertmanager: "up", Grafana: "up"},
+		},
+		{
+			name:         "alertmanager down",
+			alertmanager: unavailable,
+			grafana:      jsonResponse(map[string]any{"results": []any{}}),
+			wantHealthz:  http.StatusOK,
+			wantReadyz:   http.StatusServiceUnavailable,
+			want:         HealthResponse{Status: "degraded", Alertmanager: "down", Grafana: "up", Reason: "dependency unavailable"},
+		},
+		{
+			name:         "grafana down",
+			alertmanager: alertmanagerAPI(),
+			grafana:      unavailable,
+			wantHealthz:  http.StatusOK,
+			wantReadyz:   http.StatusServiceUnavailable,
+			want:         HealthResponse{Status: "degraded", Alertmanager: "up", Grafana: "down", Reason: "dependency unavailable"},
+		},
+		{
+			name:         "waiting for the first reconciliation",
+			alertmanager: alertmanagerAPI(),
+			grafana:      jsonResponse(map[string]any{"results": []any{}}),
+			loopEnabled:  true,
+			wantHealthz:  http.StatusOK,
+			wantReadyz:   http.StatusServiceUnavailable,
+			want:         HealthResponse{Status: "unavailable", Alertmanager: "up", Grafana: "up", Reason: "first reconciliation not completed"},
+		},
+		{
+			name:         "ready after the first reconciliation",
+			alertmanager: alertmanagerAPI(),
+			grafana:      jsonResponse(map[string]any{"results": []any{}}),
+			loopEnabled:  true,
+			reconcile:    true,
+			wantHealthz:  http.StatusOK,
+			wantReadyz:   http.StatusOK,
+			want:         HealthResponse{Status: "ok", Alertmanager: "up", Grafana: "up"},
+		},
+		{
+			name:         "no reconciler",
+			alertmanager: alertmanagerAPI(),
+			grafana:      jsonResponse(map[string]any{"results": []any{}}),
+			noReconciler: true,
+			wantHealthz:  http.StatusServiceUnavailable,
+			wantReadyz:   http.StatusServiceUnavailable,
+			want:         HealthResponse{Status: "unavailable", Alertmanager: "up", Grafana: "up", Reason: "reconciler not initialized"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			amClient := newAlertmanagerStub(t, tt.alertmanager)
+			grafanaClient := newGrafanaStub(t, tt.grafana)
+			var reconciler *sync.Reconciler
+			if !tt.noReconciler {
+				reconciler = sync.NewReconciler(amClient, grafanaClient, testExporter(), config.ReconcileConfig{}, config.TenantConfig{})
+			}
+			srv := NewServer(amClient, grafanaClient, testExporter(), reconciler)
+			srv.SetReconcileLoopEnabled(tt.loopEnabled)
+
+			if tt.reconcile {
+				if _, err := reconciler.ReconcileAndResolveOptimized(context.Background()); err != nil {
+					t.Fatalf("ReconcileAndResolveOptimized() error = %v", err)
+				}
+			}
+
+			rec := httptest.NewRecorder()
+			srv.HealthzHandler(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+			if rec.Code != tt.wantHealthz {
+				t.Errorf("/healthz status = %d, want %d (body: %s)", rec.Code, tt.wantHealthz, rec.Body.String())
+			}
+
+			rec = httptest.NewRecorder()
+			srv.ReadyzHandler(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if rec.Code != tt.wantReadyz {
+				t.Errorf("/readyz status = %d, want %d (body: %s)", rec.Code, tt.wantReadyz, rec.Body.String())
+			}
+
+			var got HealthResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("decoding /readyz response %q: %v", rec.Body.String(), err)
+			}
+			if tt.reconcile && got.LastReconcile == "" {
+				t.Error("last_reconcile is empty after a reconciliation")
+			}
+			got.LastReconcile = ""
+			if got != tt.want {
+				t.Errorf("/readyz response = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadyzCachesBackendChecks(t *testing.T) {
+	var amDown atomic.Bool
+	var amCalls, grafanaCalls atomic.Int32
+	healthyAlertmanager := alertmanagerAPI()
+	amClient := newAlertmanagerStub(t, func(w http.ResponseWriter, r *http.Request) {
+		amCalls.Add(1)
+		if amDown.Load() {
+			unavailable(w, r)
+			return
+		}
+		healthyAlertmanager(w, r)
+	})
+	grafanaClient := newGrafanaStub(t, func(w http.ResponseWriter, r *http.Request) {
+		grafanaCalls.Add(1)
+		jsonResponse(map[string]any{"results": []any{}})(w, r)
+	})
+	srv := NewServer(amClient, grafanaClient, testExporter(), sync.NewReconciler(amClient, grafanaClient, testExporter(), config.ReconcileConfig{}, config.TenantConfig{}))
+
+	readyz := func() int {
+		rec := httptest.NewRecorder()
+		srv.ReadyzHandler(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return rec.Code
+	}
+
+	for i := range 5 {
+		if code := readyz(); code != http.StatusOK {
+			t.Fatalf("probe %d: /readyz status = %d, want %d", i+1, code, http.StatusOK)
+		}
+	}
+	if am, gf := amCalls.Load(), grafanaCalls.Load(); am != 1 || gf != 1 {
+		t.Fatalf("5 probes within the TTL called Alertmanager %d and Grafana IRM %d times, want once each", am, gf)
+	}
+
+	// Once the result is stale, it's still served while a background refresh picks up the outage
+	amDown.Store(true)
+	srv.health.mu.Lock()
+	srv.health.checkedAt = time.Now().Add(-healthCacheTTL)
+	srv.health.mu.Unlock()
+	if code := readyz(); code != http.StatusOK {
+		t.Errorf("/readyz status = %d with a stale result, want the cached %d", code, http.StatusOK)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for readyz() != http.StatusServiceUnavailable {
+		if time.Now().After(deadline) {
+			t.Fatal("/readyz never reported the Alertmanager outage after the cache expired")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if am := amCalls.Load(); am != 2 {
+		t.Errorf("Alertmanager called %d times after a single refresh, want 2", am)
+	}
+}
+
+func TestVersionHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewServer(nil, nil, nil, nil).VersionHandler(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+	var info map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &info); err != nil {
+		t.Fatalf("decoding response %q: %v", rec.Body.String(), err)
+	}
+	for _, field := range []string{"version", "commit", "build_date", "go_version"} {
+		if info[field] == "" {
+			t.Errorf("field %q is missing or empty in %v", field, info)
+		}
+	}
+	if info["go_version"] != runtime.Version() {
+		t.Errorf("go_version = %q, want %q", info["go_version"], runtime.Version())
+	}
+}
+
+func TestInconsistenciesHandler(t *testing.T) {
+	group := func(id, state, fingerprint string) map[string]any {
+		return map[string]any{
+			"id":    id,
+			"state": state,
+			"last_alert": map[string]any{
+				"payload": map[string]any{"alerts": []map[string]any{{"fingerprint": fingerprint}}},
+			},
+		}
+	}
+	amClient := newAlertmanagerStub(t, alertmanagerAPI(
+		testAlert("fp1", "DiskFull", "s1"),
+		testAlert("fp2", "HighLatency", "s2"),
+		testAlert("fp3", "Watchdog"),
+	))
+	listGroups := jsonResponse(map[string]any{"results": []any{
+		group("IG1", "new", "fp1"),
+		group("IG2", "resolved", "fp2"),
+		group("IG3", "new", "fp3"),
+	}})
+	grafanaClient := newGrafanaStub(t, func(w http.ResponseWriter, r *http.Request) {
+		// Listing inconsistencies must never resolve them
+		if r.Method != http.MethodGet {
+			t.Errorf("unexpected %s %s while listing inconsistencies", r.Method, r.URL.Path)
+		}
+		listGroups(w, r)
+	})
+	reconciler := sync.NewReconciler(amClient, grafanaClient, testExporter(), config.ReconcileConfig{}, config.TenantConfig{})
+
+	tests := []struct {
+		name       string
+		method     string
+		reconciler *sync.Reconciler
+		wantStatus int
+		want       []InconsistencyResponse
+	}{
+		{
+			name:       "lists the silenced alerts of firing groups",
+			method:     http.MethodGet,
+			reconciler: reconciler,
+			wantStatus: http.StatusOK,
+			want:       []InconsistencyResponse{{Fingerprint: "fp1", Alertname: "DiskFull", Reason: sync.ReasonSilencedFiring, AlertGroupID: "IG1"}},
+		},
+		{name: "rejects other methods", method: http.MethodPost, reconciler: reconciler, wantStatus: http.StatusMethodNotAllowed},
+		{name: "no reconciler", method: http.MethodGet, wantStatus: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := NewServer(amClient, grafanaClient, testExporter(), tt.reconciler)
+			rec := httptest.NewRecorder()
+			srv.InconsistenciesHandler(rec, httptest.NewRequest(tt.method, "/inconsistencies", nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body: %s)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var got []InconsistencyResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("decoding response %q: %v", rec.Body.String(), err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("inconsistencies = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpireToolSilencesHandler(t *testing.T) {
+	silence := func(id, state, comment string) map[string]any {
+		return map[string]any{
+			"id":        id,
+			"status":    map[string]string{"state": state},
+			"comment":   comment,
+			"createdBy": "oncall@example.com",
+			"startsAt":  "2024-01-01T00:00:00Z",
+			"endsAt":    "2024-01-01T01:00:00Z",
+			"updatedAt": "2024-01-01T00:00:00Z",
+			"matchers":  []map[string]any{{"name": "alertname", "value": "DiskFull", "isRegex": false, "isEqual": true}},
+		}
+	}
+	toolComment := alertmanager.ToolSilenceCommentPrefix + " DiskFull - https://grafana.example.com (ID: IG1)"
+	silences := []map[string]any{
+		silence("s-active", "active", toolComment),
+		silence("s-pending", "pending", toolComment),
+		silence("s-expired", "expired", toolComment),
+		silence("s-manual", "active", "maintenance window"),
+		silence("s-failing", "active", toolComment),
+	}
+
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		wantStatus  int
+		want        ExpireSilencesResponse
+		wantExpired []string
+	}{
+		{
+			name:        "expires the active and pending tool silences",
+			method:      http.MethodPost,
+			target:      "/silences/expire?confirm=true",
+			wantStatus:  http.StatusOK,
+			want:        ExpireSilencesResponse{Found: 3, Expired: 2, Failed: 1},
+			wantExpired: []string{"s-active", "s-failing", "s-pending"},
+		},
+		{name: "requires confirmation", method: http.MethodPost, target: "/silences/expire", wantStatus: http.StatusBadRequest},
+		{name: "rejects other methods", method: http.MethodGet, target: "/silences/expire?confirm=true", wantStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mutex gosync.Mutex
+			var expired []string
+			amClient := newAlertmanagerStub(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				switch {
+				case r.Method == http.MethodGet && r.URL.Path == "/api/v2/silences":
+					json.NewEncoder(w).Encode(silences)
+				case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/api/v2/silence/"):
+					id := strings.TrimPrefix(r.URL.Path, "/api/v2/silence/")
+					mutex.Lock()
+					expired = append(expired, id)
+					mutex.Unlock()
+					if id == "s-failing" {
+						w.WriteHeader(http.StatusInternalServerError)
+						fmt.Fprint(w, `"boom"`)
+					}
+				default:
+					http.NotFound(w, r)
+				}
+			})
+			srv := NewServer(amClient, nil, testExporter(), nil)
+
+			rec := httptest.NewRecorder()
+			srv.ExpireToolSilencesHandler(rec, httptest.NewRequest(tt.method, tt.target, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body: %s)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			slices.Sort(expired)
+			if !slices.Equal(expired, tt.wantExpired) {
+				t.Errorf("expired silences = %v, want %v", expired, tt.wantExpired)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var got ExpireSilencesResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("response = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
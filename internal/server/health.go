@@ -0,0 +1,85 @@
+package server
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// healthCacheTTL is how long backend connectivity results are served before being refreshed,
+// so frequent probes don't turn into a steady stream of requests to Alertmanager and Grafana IRM
+const healthCacheTTL = 10 * time.Second
+
+// backendHealth is the result of a connectivity check of both backends
+type backendHealth struct {
+	alertmanager string
+	grafana      string
+	healthy      bool
+}
+
+// healthCache holds the last backend connectivity result
+type healthCache struct {
+	mu        sync.Mutex
+	result    backendHealth
+	checkedAt time.Time
+	// refreshing is set while a background refresh is running
+	refreshing atomic.Bool
+}
+
+// cachedBackendHealth returns the last backend connectivity result
+// The first call checks the backends directly; afterwards a result older than healthCacheTTL is
+// still served while a single background refresh replaces it
+func (s *Server) cachedBackendHealth(ctx context.Context) backendHealth {
+	s.health.mu.Lock()
+	result, checkedAt := s.health.result, s.health.checkedAt
+	s.health.mu.Unlock()
+
+	if checkedAt.IsZero() {
+		return s.refreshBackendHealth(ctx)
+	}
+
+	if time.Since(checkedAt) >= healthCacheTTL && s.health.refreshing.CompareAndSwap(false, true) {
+		go func() {
+			defer s.health.refreshing.Store(false)
+			s.refreshBackendHealth(context.Background())
+		}()
+	}
+
+	return result
+}
+
+// refreshBackendHealth pings the backends and caches the result
+func (s *Server) refreshBackendHealth(ctx context.Context) backendHealth {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	result := backendHealth{
+		alertmanager: "up",
+		grafana:      "disabled",
+		healthy:      true,
+	}
+
+	if err := s.amClient.Ping(ctx); err != nil {
+		log.Printf("Alertmanager health check failed: %v", err)
+		result.alertmanager = "down"
+		result.healthy = false
+	}
+
+	if s.grafanaClient != nil {
+		result.grafana = "up"
+		if err := s.grafanaClient.Ping(ctx); err != nil {
+			log.Printf("Grafana IRM health check failed: %v", err)
+			result.grafana = "down"
+			result.healthy = false
+		}
+	}
+
+	s.health.mu.Lock()
+	s.health.result = result
+	s.health.checkedAt = time.Now()
+	s.health.mu.Unlock()
+
+	return result
+}
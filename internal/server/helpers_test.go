@@ -0,0 +1,158 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/alertmanager"
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/config"
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/grafana"
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	exporterOnce sync.Once
+	exporter     *metrics.Exporter
+)
+
+// testExporter returns the exporter shared by the package tests, as its metrics can only be registered once
+func testExporter() *metrics.Exporter {
+	exporterOnce.Do(func() {
+		exporter = metrics.NewExporter(config.MetricsConfig{}, config.TenantConfig{})
+	})
+	return exporter
+}
+
+// metricValue returns the sum of the values of every series of a registered metric
+func metricValue(t *testing.T, name string) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("gathering metrics: %v", err)
+	}
+
+	total := 0.0
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			total += metric.GetCounter().GetValue() + metric.GetGauge().GetValue()
+		}
+	}
+	return total
+}
+
+// labeledMetricValue returns the value of the series of a registered metric matching all the given labels
+func labeledMetricValue(t *testing.T, name string, labels map[string]string) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("gathering metrics: %v", err)
+	}
+
+	total := 0.0
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	series:
+		for _, metric := range family.GetMetric() {
+			matched := 0
+			for _, pair := range metric.GetLabel() {
+				want, ok := labels[pair.GetName()]
+				if !ok {
+					continue
+				}
+				if pair.GetValue() != want {
+					continue series
+				}
+				matched++
+			}
+			if matched == len(labels) {
+				total += metric.GetCounter().GetValue() + metric.GetGauge().GetValue()
+			}
+		}
+	}
+	return total
+}
+
+// newAlertmanagerStub starts a fake Alertmanager API and returns a client pointed at it
+func newAlertmanagerStub(t *testing.T, handler http.HandlerFunc) *alertmanager.Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	return alertmanager.NewClient(config.AlertmanagerConfig{Host: strings.TrimPrefix(srv.URL, "http://")})
+}
+
+// newGrafanaStub starts a fake Grafana IRM API and returns a client pointed at it
+func newGrafanaStub(t *testing.T, handler http.HandlerFunc) *grafana.Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	client, err := grafana.NewClient(config.GrafanaConfig{URL: srv.URL, Token: "glsa_test"})
+	if err != nil {
+		t.Fatalf("creating grafana client: %v", err)
+	}
+	return client
+}
+
+// jsonResponse returns a handler answering every request with the JSON encoding of body
+func jsonResponse(body any) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(body)
+	}
+}
+
+// alertmanagerAPI returns a handler emulating the Alertmanager API serving the given alerts
+func alertmanagerAPI(alerts ...map[string]any) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/v2/alerts":
+			json.NewEncoder(w).Encode(append([]map[string]any{}, alerts...))
+		case "/api/v2/status":
+			fmt.Fprint(w, `{"cluster":{"status":"ready"},"config":{"original":""},"uptime":"2024-01-01T00:00:00Z","versionInfo":{}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}
+}
+
+// unavailable answers every request with a 503
+func unavailable(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusServiceUnavailable)
+}
+
+// testAlert builds an Alertmanager API alert, silenced by the given silences when there are any
+func testAlert(fingerprint, alertname string, silencedBy ...string) map[string]any {
+	state := "active"
+	if len(silencedBy) > 0 {
+		state = "suppressed"
+	}
+	now := time.Now().UTC()
+	return map[string]any{
+		"labels":      map[string]string{"alertname": alertname},
+		"annotations": map[string]string{},
+		"fingerprint": fingerprint,
+		"receivers":   []map[string]string{{"name": "default"}},
+		"startsAt":    now.Add(-time.Hour).Format(time.RFC3339),
+		"endsAt":      now.Add(time.Hour).Format(time.RFC3339),
+		"updatedAt":   now.Format(time.RFC3339),
+		"status": map[string]any{
+			"state":       state,
+			"silencedBy":  append([]string{}, silencedBy...),
+			"inhibitedBy": []string{},
+		},
+	}
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/logging"
+)
+
+func TestLoggingMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		wantStatus int
+	}{
+		{
+			name:       "implicit 200",
+			handler:    func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) },
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "not found",
+			handler:    http.NotFound,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "server error",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "boom", http.StatusInternalServerError)
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			previous := slog.Default()
+			slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+			defer slog.SetDefault(previous)
+
+			var handlerID string
+			handler := LoggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				handlerID = logging.ID(r.Context())
+				tt.handler(w, r)
+			}))
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/webhook", nil))
+
+			var entry struct {
+				Method    string `json:"method"`
+				Path      string `json:"path"`
+				Status    int    `json:"status"`
+				RequestID string `json:"request_id"`
+			}
+			if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+				t.Fatalf("decoding access log %q: %v", logs.String(), err)
+			}
+			if entry.Status != tt.wantStatus || rec.Code != tt.wantStatus {
+				t.Errorf("logged status %d, response status %d, want %d", entry.Status, rec.Code, tt.wantStatus)
+			}
+			if entry.Method != http.MethodGet || entry.Path != "/webhook" {
+				t.Errorf("logged %s %s, want GET /webhook", entry.Method, entry.Path)
+			}
+			if entry.RequestID == "" || entry.RequestID != handlerID {
+				t.Errorf("logged request_id %q, handler saw %q", entry.RequestID, handlerID)
+			}
+		})
+	}
+}
+
+func TestBearerTokenMiddleware(t *testing.T) {
+	tests := []struct {
+		name          string
+		token         string
+		authorization string
+		wantStatus    int
+	}{
+		{name: "open without a token", wantStatus: http.StatusOK},
+		{name: "authorized scrape", token: "s3cr3t", authorization: "Bearer s3cr3t", wantStatus: http.StatusOK},
+		{name: "missing token", token: "s3cr3t", wantStatus: http.StatusUnauthorized},
+		{name: "wrong token", token: "s3cr3t", authorization: "Bearer guess", wantStatus: http.StatusUnauthorized},
+		{name: "basic auth", token: "s3cr3t", authorization: "Basic czNjcjN0", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := BearerTokenMiddleware(tt.token, func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("# metrics"))
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if challenge := rec.Header().Get("WWW-Authenticate"); (tt.wantStatus == http.StatusUnauthorized) != (challenge != "") {
+				t.Errorf("WWW-Authenticate = %q for status %d", challenge, rec.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/config"
+)
+
+// RegisterPprof registers the net/http/pprof profiling handlers under /debug/pprof/
+// Nothing is registered unless profiling is explicitly enabled in the server configuration
+func RegisterPprof(mux *http.ServeMux, cfg config.ServerConfig) {
+	if !cfg.EnablePprof {
+		return
+	}
+
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	log.Println("Warning: pprof profiling endpoints enabled at /debug/pprof/")
+}
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/config"
+)
+
+func TestRegisterPprof(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled bool
+		want    int
+	}{
+		{name: "disabled by default", want: http.StatusNotFound},
+		{name: "enabled", enabled: true, want: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			RegisterPprof(mux, config.ServerConfig{EnablePprof: tt.enabled})
+
+			for _, path := range []string{"/debug/pprof/", "/debug/pprof/cmdline", "/debug/pprof/goroutine"} {
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+				if rec.Code != tt.want {
+					t.Errorf("GET %s = %d, want %d", path, rec.Code, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -1,17 +1,29 @@
 package server
 
 import (
+	"bufio"
 	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
 	"time"
 
 	"github.com/gabrielpetry/alertmanager-alert-sync/internal/alertmanager"
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/audit"
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/config"
 	"github.com/gabrielpetry/alertmanager-alert-sync/internal/grafana"
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/logging"
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/metrics"
 	"github.com/go-openapi/strfmt"
 	"github.com/prometheus/alertmanager/api/v2/models"
 )
@@ -86,57 +98,402 @@ type WebhookEvent struct {
 	AlertGroupID string `json:"alert_group_id"`
 }
 
+// Webhook event outcomes reported in metrics
+const (
+	outcomeIgnored    = "ignored"
+	outcomeSilenced   = "silenced"
+	outcomeUnsilenced = "unsilenced"
+	outcomeExpired    = "expired"
+	outcomeError      = "error"
+)
+
+// Silence creation modes for allowlisted silence events
+const (
+	silenceModePerAlert = "per_alert"
+	silenceModeGrouped  = "grouped"
+)
+
+// errMatcherConflict is returned when a WEBHOOK_EXTRA_MATCHERS entry names a label the alert carries
+// with another value; the silence would never match the alert, so it is not created
+var errMatcherConflict = errors.New("extra matcher conflicts with an alert label")
+
 // WebhookHandler handles incoming webhook requests from Grafana IRM
 type WebhookHandler struct {
 	amClient      *alertmanager.Client
 	grafanaClient *grafana.Client
-	username      string
-	password      string
-	allowlist     map[string]bool
+	exporter      *metrics.Exporter
+	silenceMode   string
+
+	// credentials holds the accepted basic auth credentials
+	credentials []webhookCredential
+
+	// defaultSilenceDuration is used when a silence event has no until time
+	defaultSilenceDuration time.Duration
+	// minSilenceDuration extends silences that would end sooner than this
+	minSilenceDuration time.Duration
+
+	// maxBodyBytes limits the size of decoded request bodies
+	maxBodyBytes int64
+
+	// extraMatchers are added as equality matchers to every created silence
+	extraMatchers map[string]string
+
+	// authorTemplate renders the author of created silences (nil uses the user's email)
+	authorTemplate *template.Template
+
+	// expireOnResolve expires the silences created for an alert group when a resolve event is received
+	expireOnResolve bool
+
+	// regexLabels maps labels matched by regex to their pattern (empty for an auto-generated prefix pattern)
+	regexLabels map[string]string
+
+	// Configured allowlist entries, combined with the allowlist file on reload
+	emailEntries   []string
+	domainEntries  []string
+	allowlistFile  string
+	reloadInterval time.Duration
+	fileModTime    time.Time
+	fileSize       int64
+
+	allowlistMutex sync.RWMutex
+	allowlist      map[string]bool
+	domains        map[string]bool
+
+	// refresh runs a reconciliation cycle when an Alertmanager webhook is received
+	// refreshing is set while a triggered refresh is running, so bursts of webhooks coalesce
+	// refreshes tracks the triggered refreshes still running, so shutdown can wait for them
+	refresh    func(ctx context.Context) error
+	refreshing atomic.Bool
+	refreshes  sync.WaitGroup
 }
 
 // NewWebhookHandler creates a new webhook handler
-func NewWebhookHandler(amClient *alertmanager.Client, grafanaClient *grafana.Client) *WebhookHandler {
-	username := os.Getenv("WEBHOOK_USERNAME")
-	password := os.Getenv("WEBHOOK_PASSWORD")
-	allowlistEnv := os.Getenv("WEBHOOK_EMAIL_ALLOWLIST")
+func NewWebhookHandler(amClient *alertmanager.Client, grafanaClient *grafana.Client, exporter *metrics.Exporter, cfg config.WebhookConfig) *WebhookHandler {
+	credentials := parseCredentials(cfg)
+	if len(credentials) == 0 {
+		log.Fatal("WEBHOOK_USERNAME and WEBHOOK_PASSWORD or WEBHOOK_CREDENTIALS must be set")
+	}
+	log.Printf("Webhook accepts %d basic auth credentials", len(credentials))
+
+	// Unset limits fall back to 1MB so bodies are never read unbounded
+	maxBodyBytes := int64(cfg.MaxBodyBytes)
+	if maxBodyBytes <= 0 {
+		maxBodyBytes = 1 << 20
+	}
+
+	silenceMode := cfg.SilenceMode
+	switch silenceMode {
+	case silenceModePerAlert, silenceModeGrouped:
+	case "":
+		silenceMode = silenceModePerAlert
+	default:
+		log.Printf("Invalid WEBHOOK_SILENCE_MODE value '%s', using '%s'", silenceMode, silenceModePerAlert)
+		silenceMode = silenceModePerAlert
+	}
+	log.Printf("Webhook silence mode: %s", silenceMode)
+
+	regexLabels := parseRegexLabels(cfg.RegexMatchLabels)
+	extraMatchers := parseExtraMatchers(cfg.ExtraMatchers)
+
+	var authorTemplate *template.Template
+	if cfg.AuthorTemplate != "" {
+		tmpl, err := template.New("author").Parse(cfg.AuthorTemplate)
+		if err != nil {
+			log.Printf("Invalid WEBHOOK_AUTHOR_TEMPLATE, using the user's email as silence author: %v", err)
+		} else {
+			authorTemplate = tmpl
+		}
+	}
+
+	h := &WebhookHandler{
+		amClient:               amClient,
+		grafanaClient:          grafanaClient,
+		exporter:               exporter,
+		credentials:            credentials,
+		silenceMode:            silenceMode,
+		defaultSilenceDuration: cfg.DefaultSilenceDuration,
+		minSilenceDuration:     cfg.MinSilenceDuration,
+		regexLabels:            regexLabels,
+		extraMatchers:          extraMatchers,
+		authorTemplate:         authorTemplate,
+		expireOnResolve:        cfg.ExpireOnResolve,
+		maxBodyBytes:           maxBodyBytes,
+		emailEntries:           cfg.EmailAllowlist,
+		domainEntries:          cfg.DomainAllowlist,
+		allowlistFile:          cfg.AllowlistFile,
+		reloadInterval:         time.Duration(cfg.AllowlistReloadInterval) * time.Second,
+	}
+
+	if h.allowlistFile != "" {
+		if info, err := os.Stat(h.allowlistFile); err == nil {
+			h.fileModTime, h.fileSize = info.ModTime(), info.Size()
+		}
+	}
+	if err := h.reloadAllowlist(); err != nil {
+		log.Printf("Failed to load webhook allowlist file %s: %v", h.allowlistFile, err)
+	}
+
+	return h
+}
+
+// webhookCredential is a basic auth username and password accepted by the webhook
+type webhookCredential struct {
+	username string
+	password string
+}
+
+// parseCredentials collects the WEBHOOK_USERNAME/WEBHOOK_PASSWORD pair and the WEBHOOK_CREDENTIALS
+// user:pass entries; entries without a username or password are skipped
+func parseCredentials(cfg config.WebhookConfig) []webhookCredential {
+	var credentials []webhookCredential
+	if cfg.Username != "" && cfg.Password != "" {
+		credentials = append(credentials, webhookCredential{username: cfg.Username, password: cfg.Password})
+	}
+	for _, entry := range cfg.Credentials {
+		username, password, found := strings.Cut(entry, ":")
+		if !found || username == "" || password == "" {
+			log.Println("Invalid WEBHOOK_CREDENTIALS entry, must be user:pass; ignoring it")
+			continue
+		}
+		credentials = append(credentials, webhookCredential{username: username, password: password})
+	}
+	return credentials
+}
+
+// parseRegexLabels parses name=pattern (or name) entries into a label to pattern map
+// Entries with a pattern that does not compile are skipped
+func parseRegexLabels(entries []string) map[string]string {
+	regexLabels := make(map[string]string)
+	for _, entry := range entries {
+		name, pattern, _ := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if pattern != "" {
+			if _, err := regexp.Compile(pattern); err != nil {
+				log.Printf("Invalid regex pattern for label %s in WEBHOOK_REGEX_MATCH_LABELS, ignoring: %v", name, err)
+				continue
+			}
+		}
+		regexLabels[name] = pattern
+	}
+	if len(regexLabels) > 0 {
+		log.Printf("Webhook silences will use regex matchers for labels: %v", regexLabels)
+	}
+	return regexLabels
+}
+
+// parseExtraMatchers parses name=value entries into a label to value map
+// Entries without a name are skipped
+func parseExtraMatchers(entries []string) map[string]string {
+	extraMatchers := make(map[string]string)
+	for _, entry := range entries {
+		name, value, found := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if !found || name == "" {
+			log.Printf("Invalid WEBHOOK_EXTRA_MATCHERS entry '%s', must be in the form name=value", entry)
+			continue
+		}
+		extraMatchers[name] = strings.TrimSpace(value)
+	}
+	if len(extraMatchers) > 0 {
+		log.Printf("Webhook silences will include extra matchers: %v", extraMatchers)
+	}
+	return extraMatchers
+}
+
+// prefixPattern builds a regex matching the value up to its last dash-separated segment
+// (e.g. api-7d9f-x2k becomes api-7d9f-.*), or the exact value when it has no dash
+func prefixPattern(value string) string {
+	idx := strings.LastIndex(value, "-")
+	if idx < 0 {
+		return regexp.QuoteMeta(value)
+	}
+	return regexp.QuoteMeta(value[:idx+1]) + ".*"
+}
+
+// reloadAllowlist rebuilds the in-memory allowlist from the configured entries and the allowlist file
+func (h *WebhookHandler) reloadAllowlist() error {
+	emails := h.emailEntries
+	var fileErr error
+	if h.allowlistFile != "" {
+		fileEntries, err := readAllowlistFile(h.allowlistFile)
+		if err != nil {
+			fileErr = err
+		} else {
+			emails = append(append([]string{}, h.emailEntries...), fileEntries...)
+		}
+	}
+
+	allowlist, domains := buildAllowlist(emails, h.domainEntries)
+
+	h.allowlistMutex.Lock()
+	h.allowlist = allowlist
+	h.domains = domains
+	h.allowlistMutex.Unlock()
+
+	log.Printf("Webhook allowlist loaded with %d allowed emails and %d allowed domains", len(allowlist), len(domains))
+	return fileErr
+}
+
+// readAllowlistFile reads allowlist entries from a file, one per line
+// Empty lines and lines starting with # are ignored
+func readAllowlistFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entries = append(entries, line)
+	}
+
+	return entries, scanner.Err()
+}
+
+// WatchAllowlistFile polls the allowlist file every reload interval and reloads it whenever its
+// modification time or size changes, until ctx is cancelled
+// It returns immediately when no allowlist file is configured
+func (h *WebhookHandler) WatchAllowlistFile(ctx context.Context) {
+	if h.allowlistFile == "" || h.reloadInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(h.reloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(h.allowlistFile)
+		if err != nil {
+			log.Printf("Failed to stat webhook allowlist file %s: %v", h.allowlistFile, err)
+			continue
+		}
+		if info.ModTime().Equal(h.fileModTime) && info.Size() == h.fileSize {
+			continue
+		}
+		h.fileModTime, h.fileSize = info.ModTime(), info.Size()
 
-	if username == "" || password == "" {
-		log.Fatal("WEBHOOK_USERNAME and WEBHOOK_PASSWORD environment variables must be set")
+		log.Printf("Webhook allowlist file %s changed, reloading", h.allowlistFile)
+		if err := h.reloadAllowlist(); err != nil {
+			log.Printf("Failed to reload webhook allowlist file %s: %v", h.allowlistFile, err)
+		}
 	}
+}
 
+// buildAllowlist builds the lowercased email and domain allowlists
+// Email entries of the form *@domain are treated as domain entries
+func buildAllowlist(emails, domainList []string) (map[string]bool, map[string]bool) {
 	allowlist := make(map[string]bool)
-	if allowlistEnv != "" {
-		emails := strings.Split(allowlistEnv, ",")
-		for _, email := range emails {
-			allowlist[strings.TrimSpace(email)] = true
+	domains := make(map[string]bool)
+
+	for _, email := range emails {
+		email = strings.ToLower(strings.TrimSpace(email))
+		if email == "" {
+			continue
 		}
+		if domain, found := strings.CutPrefix(email, "*@"); found {
+			domains[domain] = true
+			continue
+		}
+		allowlist[email] = true
 	}
 
-	log.Printf("Webhook handler initialized with %d allowed emails", len(allowlist))
+	for _, domain := range domainList {
+		domain = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domain), "@"))
+		if domain != "" {
+			domains[domain] = true
+		}
+	}
+
+	return allowlist, domains
+}
+
+// isAllowed checks whether an email matches the allowlist, either exactly or by domain (case-insensitive)
+func (h *WebhookHandler) isAllowed(email string) bool {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return false
+	}
+
+	h.allowlistMutex.RLock()
+	defer h.allowlistMutex.RUnlock()
+
+	if h.allowlist[email] {
+		return true
+	}
 
-	return &WebhookHandler{
-		amClient:      amClient,
-		grafanaClient: grafanaClient,
-		username:      username,
-		password:      password,
-		allowlist:     allowlist,
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
 	}
+	return h.domains[email[at+1:]]
 }
 
 // basicAuth validates the basic authentication credentials
+// Credentials are compared in constant time to avoid leaking information through timing
+// The authenticated caller is logged and counted so senders can be told apart
 func (h *WebhookHandler) basicAuth(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		username, password, ok := r.BasicAuth()
-		if !ok || username != h.username || password != h.password {
-			w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		if !ok || !h.validCredentials(username, password) {
+			h.recordCaller(callerUnauthorized)
+			unauthorized(w)
 			return
 		}
+		log.Printf("Webhook request to %s from %s", r.URL.Path, username)
+		h.recordCaller(username)
 		next(w, r)
 	}
 }
 
+// RequireAuth protects another handler with the webhook basic auth credentials
+func (h *WebhookHandler) RequireAuth(next http.HandlerFunc) http.HandlerFunc {
+	return h.basicAuth(next)
+}
+
+// validCredentials compares the provided credentials with every configured pair in constant time
+// Every pair is compared, so the time taken doesn't reveal which one matched
+func (h *WebhookHandler) validCredentials(username, password string) bool {
+	valid := 0
+	for _, credential := range h.credentials {
+		usernameMatch := subtle.ConstantTimeCompare([]byte(username), []byte(credential.username))
+		passwordMatch := subtle.ConstantTimeCompare([]byte(password), []byte(credential.password))
+		valid |= usernameMatch & passwordMatch
+	}
+	return valid == 1
+}
+
+// callerUnauthorized is the caller recorded for requests that failed authentication
+const callerUnauthorized = "unauthorized"
+
+// recordCaller counts a webhook request by authenticated caller
+func (h *WebhookHandler) recordCaller(caller string) {
+	if h.exporter == nil {
+		return
+	}
+	h.exporter.RecordWebhookCaller(caller)
+}
+
+// unauthorized writes a 401 response with the basic auth challenge header
+func unauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+}
+
 // HandleWebhook processes incoming webhook events
 func (h *WebhookHandler) HandleWebhook(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -144,93 +501,228 @@ func (h *WebhookHandler) HandleWebhook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := r.Context()
+	// Tag every log line of this request with its correlation ID, shared with the access log
+	ctx := logging.EnsureID(r.Context())
+
+	// Limit the body size so oversized payloads can't exhaust memory
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxBodyBytes)
 
 	var event WebhookEvent
 	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
-		log.Printf("Failed to decode webhook payload: %v", err)
+		h.recordEvent("", outcomeError)
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			logging.Printf(ctx, "Webhook payload exceeds %d bytes", maxBytesErr.Limit)
+			http.Error(w, "Payload too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		logging.Printf(ctx, "Failed to decode webhook payload: %v", err)
 		http.Error(w, "Invalid payload", http.StatusBadRequest)
 		return
 	}
 
 	// Ignore if event.type does not exist or is empty
 	if event.Event.Type == "" {
-		log.Println("Ignoring webhook event: event.type is empty")
+		logging.Println(ctx, "Ignoring webhook event: event.type is empty")
+		h.recordEvent("", outcomeIgnored)
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(map[string]string{"status": "ignored", "reason": "no event type"})
 		return
 	}
 
+	// Resolve events expire the silences created for the alert group when enabled
+	if event.Event.Type == "resolve" && h.expireOnResolve {
+		h.handleResolve(ctx, w, event)
+		return
+	}
+
 	// Only process silence events
 	if event.Event.Type != "silence" {
-		log.Printf("Ignoring webhook event: type is %s (not silence)", event.Event.Type)
+		logging.Printf(ctx, "Ignoring webhook event: type is %s (not silence)", event.Event.Type)
+		h.recordEvent(event.Event.Type, outcomeIgnored)
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(map[string]string{"status": "ignored", "reason": "not a silence event"})
 		return
 	}
 
-	log.Printf("Processing silence event for alert group %s by user %s", event.AlertGroup.ID, event.User.Email)
+	logging.Printf(ctx, "Processing silence event for alert group %s by user %s", event.AlertGroup.ID, event.User.Email)
 
 	// Check if user email is in allowlist
-	isAllowed := h.allowlist[event.User.Email]
+	isAllowed := h.isAllowed(event.User.Email)
 
 	if !isAllowed {
 		// User NOT in allowlist - unsilence the alert in Grafana
-		log.Printf("User %s not in allowlist, unsilencing alert group %s in Grafana", event.User.Email, event.AlertGroup.ID)
-		if err := h.grafanaClient.UnsilenceAlertGroup(event.AlertGroup.ID); err != nil {
-			log.Printf("Failed to unsilence alert group %s: %v", event.AlertGroup.ID, err)
+		logging.Printf(ctx, "User %s not in allowlist, unsilencing alert group %s in Grafana", event.User.Email, event.AlertGroup.ID)
+		err := h.grafanaClient.UnsilenceAlertGroup(ctx, event.AlertGroup.ID)
+		audit.Record(ctx, audit.Event{
+			Action:       audit.ActionUnsilenceAlertGroup,
+			Actor:        event.User.Email,
+			Reason:       "silencing user not in allowlist",
+			AlertGroupID: event.AlertGroup.ID,
+			Err:          err,
+		})
+		if err != nil {
+			logging.Printf(ctx, "Failed to unsilence alert group %s: %v", event.AlertGroup.ID, err)
+			h.recordEvent(event.Event.Type, outcomeError)
 			http.Error(w, fmt.Sprintf("Failed to unsilence alert: %v", err), http.StatusInternalServerError)
 			return
 		}
-		log.Printf("Successfully unsilenced alert group %s", event.AlertGroup.ID)
+		logging.Printf(ctx, "Successfully unsilenced alert group %s", event.AlertGroup.ID)
+		h.recordEvent(event.Event.Type, outcomeUnsilenced)
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(map[string]string{"status": "unsilenced", "alert_group_id": event.AlertGroup.ID})
 		return
 	}
 
-	// User IS in allowlist and has event.until - create silence in Alertmanager
+	// User IS in allowlist - create silence in Alertmanager until event.until or the default duration
+	var untilTime time.Time
 	if event.Event.Until == "" {
-		log.Printf("User %s in allowlist but no until time specified, ignoring", event.User.Email)
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]string{"status": "ignored", "reason": "no until time"})
-		return
+		if h.defaultSilenceDuration <= 0 {
+			logging.Printf(ctx, "User %s in allowlist but no until time specified, ignoring", event.User.Email)
+			h.recordEvent(event.Event.Type, outcomeIgnored)
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(map[string]string{"status": "ignored", "reason": "no until time"})
+			return
+		}
+
+		untilTime = time.Now().Add(h.defaultSilenceDuration)
+		logging.Printf(ctx, "No until time specified, using default silence duration of %v", h.defaultSilenceDuration)
+	} else {
+		// Parse until time
+		parsed, err := time.Parse(time.RFC3339, event.Event.Until)
+		if err != nil {
+			logging.Printf(ctx, "Failed to parse until time %s: %v", event.Event.Until, err)
+			h.recordEvent(event.Event.Type, outcomeError)
+			http.Error(w, fmt.Sprintf("Invalid until time: %v", err), http.StatusBadRequest)
+			return
+		}
+		untilTime = parsed
 	}
 
-	// Parse until time
-	untilTime, err := time.Parse(time.RFC3339, event.Event.Until)
-	if err != nil {
-		log.Printf("Failed to parse until time %s: %v", event.Event.Until, err)
-		http.Error(w, fmt.Sprintf("Invalid until time: %v", err), http.StatusBadRequest)
-		return
+	// Extend silences that would expire almost immediately and let the alert re-fire
+	if minUntil := time.Now().Add(h.minSilenceDuration); h.minSilenceDuration > 0 && untilTime.Before(minUntil) {
+		logging.Printf(ctx, "Until time %s is less than %v away, extending silence to %s",
+			untilTime.Format(time.RFC3339), h.minSilenceDuration, minUntil.Format(time.RFC3339))
+		untilTime = minUntil
 	}
 
-	// Create silence in Alertmanager for each alert in the group
+	// In grouped mode, create a single silence from the labels shared by the group
 	silencesCreated := 0
-	for _, alert := range event.AlertGroup.LastAlert.Payload.Alerts {
+	var createErr error
+	if h.silenceMode == silenceModeGrouped {
+		groupLabels := groupedSilenceLabels(event)
+		if len(groupLabels) == 0 {
+			logging.Printf(ctx, "No common or group labels for alert group %s, falling back to per-alert silences", event.AlertGroup.ID)
+		} else {
+			silenceID, err := h.createSilence(ctx, groupLabels, event, untilTime)
+			if err != nil {
+				logging.Printf(ctx, "Failed to create grouped silence for alert group %s: %v", event.AlertGroup.ID, err)
+				createErr = err
+			} else {
+				logging.Printf(ctx, "Created grouped silence %s for alert group %s", silenceID, event.AlertGroup.ID)
+				silencesCreated++
+			}
+			h.writeSilenceResult(ctx, w, event, silencesCreated, 0, createErr)
+			return
+		}
+	}
+
+	// Create silence in Alertmanager for each alert in the group
+	// Alerts often share the same labels; only one silence is created per distinct matcher set
+	alerts := event.AlertGroup.LastAlert.Payload.Alerts
+	silenced := make(map[string]bool, len(alerts))
+	silencesDeduplicated := 0
+	for i, alert := range alerts {
+		// Stop creating silences once the client has gone away
+		if err := ctx.Err(); err != nil {
+			logging.Printf(ctx, "Webhook request cancelled after creating %d silences, skipping %d remaining alerts: %v",
+				silencesCreated, len(alerts)-i, err)
+			break
+		}
+		matchers, err := h.silenceMatchers(alert.Labels)
+		if err != nil {
+			logging.Printf(ctx, "Not creating silence for alert %s: %v", alert.Fingerprint, err)
+			if createErr == nil {
+				createErr = err
+			}
+			continue
+		}
+		key := matchersKey(matchers)
+		if silenced[key] {
+			logging.Printf(ctx, "Skipping silence for alert %s: identical to a silence already created for this alert group", alert.Fingerprint)
+			silencesDeduplicated++
+			continue
+		}
 		silenceID, err := h.createSilenceForAlert(ctx, alert, event, untilTime)
 		if err != nil {
-			log.Printf("Failed to create silence for alert %s: %v", alert.Fingerprint, err)
+			logging.Printf(ctx, "Failed to create silence for alert %s: %v", alert.Fingerprint, err)
+			// Keep a transient error over a permanent one, so the request fails as retriable if any failure was
+			if createErr == nil || isPermanentSilenceError(createErr) {
+				createErr = err
+			}
 			// Continue with other alerts
 			continue
 		}
-		log.Printf("Created silence %s for alert %s", silenceID, alert.Fingerprint)
+		logging.Printf(ctx, "Created silence %s for alert %s", silenceID, alert.Fingerprint)
+		silenced[key] = true
 		silencesCreated++
 	}
 
+	h.writeSilenceResult(ctx, w, event, silencesCreated, silencesDeduplicated, createErr)
+}
+
+// writeSilenceResult writes the webhook response after silences were created
+// silencesDeduplicated counts the alerts skipped because an identical silence was already created
+// When no silence was created, a silence rejected by Alertmanager or conflicting with an extra matcher
+// is reported as a 400 since retrying can't help; any other failure is a retriable 500
+func (h *WebhookHandler) writeSilenceResult(ctx context.Context, w http.ResponseWriter, event WebhookEvent, silencesCreated, silencesDeduplicated int, createErr error) {
 	if silencesCreated == 0 {
+		h.recordEvent(event.Event.Type, outcomeError)
+		if isPermanentSilenceError(createErr) {
+			http.Error(w, fmt.Sprintf("Failed to create any silences: %v", createErr), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, "Failed to create any silences", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("Successfully created %d silences in Alertmanager for alert group %s", silencesCreated, event.AlertGroup.ID)
+	logging.Printf(ctx, "Successfully created %d silences in Alertmanager for alert group %s", silencesCreated, event.AlertGroup.ID)
+	h.recordEvent(event.Event.Type, outcomeSilenced)
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
-		"status":           "silenced",
-		"alert_group_id":   event.AlertGroup.ID,
-		"silences_created": fmt.Sprintf("%d", silencesCreated),
+		"status":                "silenced",
+		"alert_group_id":        event.AlertGroup.ID,
+		"silences_created":      fmt.Sprintf("%d", silencesCreated),
+		"silences_deduplicated": fmt.Sprintf("%d", silencesDeduplicated),
 	})
 }
 
+// isPermanentSilenceError reports whether creating a silence failed in a way retrying can't fix
+func isPermanentSilenceError(err error) bool {
+	return errors.Is(err, alertmanager.ErrInvalidSilence) || errors.Is(err, errMatcherConflict)
+}
+
+// recordEvent records a webhook event outcome in metrics, using "unknown" for a missing event type
+func (h *WebhookHandler) recordEvent(eventType, outcome string) {
+	if h.exporter == nil {
+		return
+	}
+	if eventType == "" {
+		eventType = "unknown"
+	}
+	h.exporter.RecordWebhookEvent(eventType, outcome)
+}
+
+// groupedSilenceLabels returns the labels used for a grouped silence:
+// the group's common labels, or its group labels when there are no common labels
+func groupedSilenceLabels(event WebhookEvent) map[string]string {
+	payload := event.AlertGroup.LastAlert.Payload
+	if len(payload.CommonLabels) > 0 {
+		return payload.CommonLabels
+	}
+	return payload.GroupLabels
+}
+
 // createSilenceForAlert creates a silence in Alertmanager for a single alert
 func (h *WebhookHandler) createSilenceForAlert(ctx context.Context, alert struct {
 	EndsAt       string            `json:"endsAt"`
@@ -241,24 +733,65 @@ func (h *WebhookHandler) createSilenceForAlert(ctx context.Context, alert struct
 	Fingerprint  string            `json:"fingerprint"`
 	GeneratorURL string            `json:"generatorURL"`
 }, event WebhookEvent, untilTime time.Time) (string, error) {
+	logging.Printf(ctx, "Creating silence in Alertmanager for alert %s (fingerprint: %s) until %s",
+		alert.Labels["alertname"], alert.Fingerprint, untilTime.Format(time.RFC3339))
 
-	// Build matchers from alert labels
-	matchers := make(models.Matchers, 0, len(alert.Labels))
-	for key, value := range alert.Labels {
-		isEqual := true
-		isRegex := false
-		name := key
-		val := value
-		matchers = append(matchers, &models.Matcher{
-			IsEqual: &isEqual,
-			IsRegex: &isRegex,
-			Name:    &name,
-			Value:   &val,
-		})
+	return h.createSilence(ctx, alert.Labels, event, untilTime)
+}
+
+// handleResolve expires the silences this tool created for a resolved alert group,
+// so Alertmanager isn't left with silences for an incident that is over
+func (h *WebhookHandler) handleResolve(ctx context.Context, w http.ResponseWriter, event WebhookEvent) {
+	logging.Printf(ctx, "Processing resolve event for alert group %s by user %s", event.AlertGroup.ID, event.User.Email)
+
+	// Silence comments end with the alert group ID, see createSilence
+	silences, err := h.amClient.FindSilencesByComment(ctx, alertmanager.ToolSilenceCommentPrefix)
+	if err != nil {
+		logging.Printf(ctx, "Failed to find silences of alert group %s: %v", event.AlertGroup.ID, err)
+		h.recordEvent(event.Event.Type, outcomeError)
+		http.Error(w, fmt.Sprintf("Failed to find silences: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	owned := make([]*models.GettableSilence, 0, len(silences))
+	for _, silence := range silences {
+		if id, ok := alertmanager.ToolSilenceAlertGroupID(*silence.Comment); ok && id == event.AlertGroup.ID {
+			owned = append(owned, silence)
+		}
+	}
+
+	result := expireSilences(ctx, h.amClient, owned, audit.Event{
+		Actor:        event.User.Email,
+		Reason:       "alert group resolved in Grafana IRM",
+		AlertGroupID: event.AlertGroup.ID,
+	})
+	logging.Printf(ctx, "Expired %d of %d silences of alert group %s (%d failed)",
+		result.Expired, result.Found, event.AlertGroup.ID, result.Failed)
+
+	if result.Failed > 0 {
+		h.recordEvent(event.Event.Type, outcomeError)
+		http.Error(w, fmt.Sprintf("Failed to expire %d of %d silences", result.Failed, result.Found), http.StatusInternalServerError)
+		return
+	}
+
+	h.recordEvent(event.Event.Type, outcomeExpired)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":           "expired",
+		"alert_group_id":   event.AlertGroup.ID,
+		"silences_expired": fmt.Sprintf("%d", result.Expired),
+	})
+}
+
+// createSilence creates a silence in Alertmanager matching the given labels (see silenceMatchers)
+func (h *WebhookHandler) createSilence(ctx context.Context, labels map[string]string, event WebhookEvent, untilTime time.Time) (string, error) {
+	matchers, err := h.silenceMatchers(labels)
+	if err != nil {
+		return "", err
 	}
 
 	// Create comment with alert group details
-	comment := fmt.Sprintf("Automated silence for Grafana IRM Alert Group: %s - %s (ID: %s)",
+	comment := fmt.Sprintf(alertmanager.ToolSilenceCommentPrefix+" %s - %s (ID: %s)",
 		event.AlertGroup.Title,
 		event.AlertGroup.Permalinks.Web,
 		event.AlertGroup.ID,
@@ -267,7 +800,7 @@ func (h *WebhookHandler) createSilenceForAlert(ctx context.Context, alert struct
 	// Create silence
 	startsAt := strfmt.DateTime(time.Now())
 	endsAt := strfmt.DateTime(untilTime)
-	createdBy := event.User.Email
+	createdBy := h.silenceAuthor(ctx, event)
 
 	silence := &models.PostableSilence{
 		Silence: models.Silence{
@@ -279,13 +812,104 @@ func (h *WebhookHandler) createSilenceForAlert(ctx context.Context, alert struct
 		},
 	}
 
-	log.Printf("Creating silence in Alertmanager for alert %s (fingerprint: %s) until %s",
-		alert.Labels["alertname"], alert.Fingerprint, untilTime.Format(time.RFC3339))
+	silenceID, err := h.amClient.CreateSilence(ctx, silence)
+	audit.Record(ctx, audit.Event{
+		Action:       audit.ActionCreateSilence,
+		Actor:        event.User.Email,
+		Reason:       "alert group silenced in Grafana IRM",
+		AlertGroupID: event.AlertGroup.ID,
+		SilenceID:    silenceID,
+		Err:          err,
+	})
+	return silenceID, err
+}
+
+// silenceMatchers builds the matchers of a silence for the given labels
+// Labels configured in WEBHOOK_REGEX_MATCH_LABELS are matched by regex, all others exactly
+// Matchers from WEBHOOK_EXTRA_MATCHERS are added; an extra matcher on a label the alert carries with
+// another value would make the silence never match, so it returns an error matching errMatcherConflict
+func (h *WebhookHandler) silenceMatchers(labels map[string]string) (models.Matchers, error) {
+	// Build matchers from labels
+	matchers := make(models.Matchers, 0, len(labels)+len(h.extraMatchers))
+	for key, value := range labels {
+		if extra, exists := h.extraMatchers[key]; exists {
+			if extra != value {
+				return nil, fmt.Errorf("%w: %s=%q, alert has %s=%q", errMatcherConflict, key, extra, key, value)
+			}
+			// The extra matcher already matches this label exactly
+			continue
+		}
+		isEqual := true
+		isRegex := false
+		name := key
+		val := value
+		if pattern, ok := h.regexLabels[key]; ok {
+			isRegex = true
+			val = pattern
+			if val == "" {
+				val = prefixPattern(value)
+			}
+		}
+		matchers = append(matchers, &models.Matcher{
+			IsEqual: &isEqual,
+			IsRegex: &isRegex,
+			Name:    &name,
+			Value:   &val,
+		})
+	}
 
-	return h.amClient.CreateSilence(ctx, silence)
+	for key, value := range h.extraMatchers {
+		isEqual := true
+		isRegex := false
+		name := key
+		val := value
+		matchers = append(matchers, &models.Matcher{
+			IsEqual: &isEqual,
+			IsRegex: &isRegex,
+			Name:    &name,
+			Value:   &val,
+		})
+	}
+
+	return matchers, nil
+}
+
+// silenceAuthor renders the silence author from the webhook user with WEBHOOK_AUTHOR_TEMPLATE
+// It falls back to the user's email when no template is set or it renders an error or an empty author
+func (h *WebhookHandler) silenceAuthor(ctx context.Context, event WebhookEvent) string {
+	if h.authorTemplate == nil {
+		return event.User.Email
+	}
+
+	var author strings.Builder
+	if err := h.authorTemplate.Execute(&author, event.User); err != nil {
+		logging.Printf(ctx, "Failed to render silence author for user %s, using email: %v", event.User.Email, err)
+		return event.User.Email
+	}
+	if strings.TrimSpace(author.String()) == "" {
+		logging.Printf(ctx, "Silence author template rendered empty for user %s, using email", event.User.Email)
+		return event.User.Email
+	}
+	return author.String()
+}
+
+// matchersKey returns a representation of the matchers independent of their order,
+// so silences with identical matchers can be detected
+func matchersKey(matchers models.Matchers) string {
+	keys := make([]string, 0, len(matchers))
+	for _, matcher := range matchers {
+		operator := "="
+		if matcher.IsRegex != nil && *matcher.IsRegex {
+			operator = "=~"
+		}
+		keys = append(keys, *matcher.Name+operator+*matcher.Value)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
 }
 
 // RegisterRoutes registers the webhook routes
 func (h *WebhookHandler) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/webhook", h.basicAuth(h.HandleWebhook))
+	mux.HandleFunc("/am-webhook", h.basicAuth(h.HandleAlertmanagerWebhook))
 }
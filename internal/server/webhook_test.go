@@ -0,0 +1,877 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/alertmanager"
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/config"
+	"github.com/prometheus/alertmanager/api/v2/models"
+)
+
+// webhookPayload builds a Grafana IRM webhook body for an event on alert group "AG1" with a single alert
+func webhookPayload(eventType, email, until string) string {
+	body, _ := json.Marshal(map[string]any{
+		"event": map[string]string{"type": eventType, "until": until},
+		"user":  map[string]string{"email": email},
+		"alert_group": map[string]any{
+			"id":    "AG1",
+			"title": "HighLatency",
+			"last_alert": map[string]any{
+				"payload": map[string]any{
+					"alerts": []map[string]any{
+						{"fingerprint": "fp1", "labels": map[string]string{"alertname": "HighLatency"}},
+					},
+				},
+			},
+		},
+	})
+	return string(body)
+}
+
+// testWebhookConfig returns a webhook configuration with credentials set
+func testWebhookConfig() config.WebhookConfig {
+	return config.WebhookConfig{Username: "irm", Password: "secret"}
+}
+
+func TestIsAllowed(t *testing.T) {
+	cfg := testWebhookConfig()
+	cfg.EmailAllowlist = []string{"Oncall@Example.com", "*@company.com"}
+	cfg.DomainAllowlist = []string{"@corp.io"}
+	h := NewWebhookHandler(nil, nil, nil, cfg)
+
+	tests := []struct {
+		email string
+		want  bool
+	}{
+		{email: "oncall@example.com", want: true},
+		{email: "ONCALL@example.COM", want: true},
+		{email: "someone@company.com", want: true},
+		{email: "Someone@Company.com", want: true},
+		{email: "dev@corp.io", want: true},
+		{email: "other@example.com", want: false},
+		{email: "someone@sub.company.com", want: false},
+		{email: "someone@company.com.evil.io", want: false},
+		{email: "company.com", want: false},
+		{email: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.email, func(t *testing.T) {
+			if got := h.isAllowed(tt.email); got != tt.want {
+				t.Errorf("isAllowed(%q) = %v, want %v", tt.email, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWatchAllowlistFileReloads(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "allowlist")
+	if err := os.WriteFile(path, []byte("a@example.com\n"), 0o600); err != nil {
+		t.Fatalf("write allowlist: %v", err)
+	}
+
+	cfg := testWebhookConfig()
+	cfg.AllowlistFile = path
+	h := NewWebhookHandler(nil, nil, nil, cfg)
+	h.reloadInterval = 10 * time.Millisecond
+
+	if !h.isAllowed("a@example.com") {
+		t.Fatal("a@example.com should be allowed from the initial file")
+	}
+	if h.isAllowed("b@example.com") {
+		t.Fatal("b@example.com should not be allowed before the file changes")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		h.WatchAllowlistFile(ctx)
+		close(done)
+	}()
+
+	if err := os.WriteFile(path, []byte("a@example.com\nb@example.com\n"), 0o600); err != nil {
+		t.Fatalf("rewrite allowlist: %v", err)
+	}
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatalf("touch allowlist: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !h.isAllowed("b@example.com") {
+		if time.Now().After(deadline) {
+			t.Fatal("b@example.com was not accepted after the allowlist file changed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("WatchAllowlistFile did not return after ctx was cancelled")
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	h := NewWebhookHandler(nil, nil, nil, testWebhookConfig())
+	protected := h.basicAuth(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		noAuth   bool
+		want     int
+	}{
+		{name: "valid credentials", username: "irm", password: "secret", want: http.StatusOK},
+		{name: "wrong password", username: "irm", password: "wrong", want: http.StatusUnauthorized},
+		{name: "wrong user", username: "admin", password: "secret", want: http.StatusUnauthorized},
+		{name: "password prefix", username: "irm", password: "secre", want: http.StatusUnauthorized},
+		{name: "missing credentials", noAuth: true, want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/webhook", nil)
+			if !tt.noAuth {
+				req.SetBasicAuth(tt.username, tt.password)
+			}
+			rec := httptest.NewRecorder()
+			protected(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+			header := rec.Header().Get("WWW-Authenticate")
+			if tt.want == http.StatusUnauthorized && header != `Basic realm="Restricted"` {
+				t.Errorf("WWW-Authenticate = %q, want realm header on 401", header)
+			}
+			if tt.want == http.StatusOK && header != "" {
+				t.Errorf("WWW-Authenticate = %q, want none on success", header)
+			}
+		})
+	}
+}
+
+func TestBasicAuthMultipleCredentials(t *testing.T) {
+	const metric = "alertmanager_sync_webhook_requests_by_caller_total"
+	cfg := testWebhookConfig()
+	cfg.Credentials = []string{"alerting:rotated", "legacy:old:secret", "malformed"}
+	h := NewWebhookHandler(nil, nil, testExporter(), cfg)
+	protected := h.basicAuth(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		want     int
+		caller   string
+	}{
+		{name: "username and password pair", username: "irm", password: "secret", want: http.StatusOK, caller: "irm"},
+		{name: "first credential", username: "alerting", password: "rotated", want: http.StatusOK, caller: "alerting"},
+		{name: "password with a colon", username: "legacy", password: "old:secret", want: http.StatusOK, caller: "legacy"},
+		{name: "wrong password", username: "alerting", password: "secret", want: http.StatusUnauthorized, caller: callerUnauthorized},
+		{name: "wrong user", username: "legacy", password: "rotated", want: http.StatusUnauthorized, caller: callerUnauthorized},
+		{name: "unknown user", username: "intruder", password: "rotated", want: http.StatusUnauthorized, caller: callerUnauthorized},
+		{name: "malformed entry", username: "malformed", password: "", want: http.StatusUnauthorized, caller: callerUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels := map[string]string{"caller": tt.caller}
+			before := labeledMetricValue(t, metric, labels)
+
+			req := httptest.NewRequest(http.MethodPost, "/webhook", nil)
+			req.SetBasicAuth(tt.username, tt.password)
+			rec := httptest.NewRecorder()
+			protected(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if got := labeledMetricValue(t, metric, labels) - before; got != 1 {
+				t.Errorf("%s{caller=%q} increased by %v, want 1", metric, tt.caller, got)
+			}
+		})
+	}
+}
+
+func TestHandleWebhookEventsMetric(t *testing.T) {
+	const metric = "alertmanager_sync_webhook_events_total"
+	until := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+
+	am := newAlertmanagerStub(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.URL.Path == "/api/v2/silences" {
+			jsonResponse(map[string]string{"silenceID": "silence-1"})(w, r)
+			return
+		}
+		http.NotFound(w, r)
+	})
+	grafanaOK := newGrafanaStub(t, jsonResponse(map[string]string{}))
+	grafanaDown := newGrafanaStub(t, unavailable)
+
+	tests := []struct {
+		name      string
+		grafana   bool
+		body      string
+		eventType string
+		outcome   string
+		status    int
+	}{
+		{name: "invalid payload", body: "{", eventType: "unknown", outcome: outcomeError, status: http.StatusBadRequest},
+		{name: "missing type", body: webhookPayload("", "", ""), eventType: "unknown", outcome: outcomeIgnored, status: http.StatusOK},
+		{name: "not a silence", body: webhookPayload("acknowledge", "oncall@example.com", ""), eventType: "acknowledge", outcome: outcomeIgnored, status: http.StatusOK},
+		{name: "not allowed", grafana: true, body: webhookPayload("silence", "intruder@example.com", until), eventType: "silence", outcome: outcomeUnsilenced, status: http.StatusOK},
+		{name: "unsilence fails", body: webhookPayload("silence", "intruder@example.com", until), eventType: "silence", outcome: outcomeError, status: http.StatusInternalServerError},
+		{name: "no until", body: webhookPayload("silence", "oncall@example.com", ""), eventType: "silence", outcome: outcomeIgnored, status: http.StatusOK},
+		{name: "invalid until", body: webhookPayload("silence", "oncall@example.com", "tomorrow"), eventType: "silence", outcome: outcomeError, status: http.StatusBadRequest},
+		{name: "silenced", body: webhookPayload("silence", "oncall@example.com", until), eventType: "silence", outcome: outcomeSilenced, status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testWebhookConfig()
+			cfg.EmailAllowlist = []string{"oncall@example.com"}
+			gf := grafanaDown
+			if tt.grafana {
+				gf = grafanaOK
+			}
+			h := NewWebhookHandler(am, gf, testExporter(), cfg)
+
+			labels := map[string]string{"event_type": tt.eventType, "outcome": tt.outcome}
+			before := labeledMetricValue(t, metric, labels)
+
+			rec := httptest.NewRecorder()
+			h.HandleWebhook(rec, httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(tt.body)))
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body.String())
+			}
+			if got := labeledMetricValue(t, metric, labels) - before; got != 1 {
+				t.Errorf("%s{event_type=%q,outcome=%q} increased by %v, want 1", metric, tt.eventType, tt.outcome, got)
+			}
+		})
+	}
+}
+
+// silenceRecorder emulates the Alertmanager silences API, recording the matchers and end time of every created silence
+// Matchers are recorded as label name to value, with regex values prefixed by "=~"
+type silenceRecorder struct {
+	mutex    sync.Mutex
+	silences []map[string]string
+	endsAt   []time.Time
+}
+
+// ServeHTTP implements http.Handler
+func (s *silenceRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != "/api/v2/silences" {
+		http.NotFound(w, r)
+		return
+	}
+	var silence models.PostableSilence
+	if err := json.NewDecoder(r.Body).Decode(&silence); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	matchers := make(map[string]string, len(silence.Matchers))
+	for _, matcher := range silence.Matchers {
+		value := *matcher.Value
+		if *matcher.IsRegex {
+			value = "=~" + value
+		}
+		matchers[*matcher.Name] = value
+	}
+	s.mutex.Lock()
+	s.silences = append(s.silences, matchers)
+	s.endsAt = append(s.endsAt, time.Time(*silence.EndsAt))
+	s.mutex.Unlock()
+
+	jsonResponse(map[string]string{"silenceID": "silence-1"})(w, r)
+}
+
+// created returns the matchers of the silences created so far
+func (s *silenceRecorder) created() []map[string]string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]map[string]string{}, s.silences...)
+}
+
+// silenceEnds returns the end times of the silences created so far
+func (s *silenceRecorder) silenceEnds() []time.Time {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]time.Time{}, s.endsAt...)
+}
+
+// groupSilencePayload builds a silence event for a group of two alerts with the given common labels
+func groupSilencePayload(commonLabels map[string]string) string {
+	body, _ := json.Marshal(map[string]any{
+		"event": map[string]string{"type": "silence", "until": time.Now().Add(time.Hour).UTC().Format(time.RFC3339)},
+		"user":  map[string]string{"email": "oncall@example.com"},
+		"alert_group": map[string]any{
+			"id": "AG1",
+			"last_alert": map[string]any{
+				"payload": map[string]any{
+					"commonLabels": commonLabels,
+					"alerts": []map[string]any{
+						{"fingerprint": "fp-a", "labels": map[string]string{"alertname": "HighLatency", "instance": "a"}},
+						{"fingerprint": "fp-b", "labels": map[string]string{"alertname": "HighLatency", "instance": "b"}},
+					},
+				},
+			},
+		},
+	})
+	return string(body)
+}
+
+func TestHandleWebhookSilenceModes(t *testing.T) {
+	tests := []struct {
+		name         string
+		mode         string
+		commonLabels map[string]string
+		want         []map[string]string
+	}{
+		{
+			name:         "per alert",
+			mode:         silenceModePerAlert,
+			commonLabels: map[string]string{"alertname": "HighLatency"},
+			want: []map[string]string{
+				{"alertname": "HighLatency", "instance": "a"},
+				{"alertname": "HighLatency", "instance": "b"},
+			},
+		},
+		{
+			name:         "grouped",
+			mode:         silenceModeGrouped,
+			commonLabels: map[string]string{"alertname": "HighLatency"},
+			want:         []map[string]string{{"alertname": "HighLatency"}},
+		},
+		{
+			name: "grouped without common labels falls back to per alert",
+			mode: silenceModeGrouped,
+			want: []map[string]string{
+				{"alertname": "HighLatency", "instance": "a"},
+				{"alertname": "HighLatency", "instance": "b"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &silenceRecorder{}
+			cfg := testWebhookConfig()
+			cfg.EmailAllowlist = []string{"oncall@example.com"}
+			cfg.SilenceMode = tt.mode
+			h := NewWebhookHandler(newAlertmanagerStub(t, recorder.ServeHTTP), nil, nil, cfg)
+
+			rec := httptest.NewRecorder()
+			h.HandleWebhook(rec, httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(groupSilencePayload(tt.commonLabels))))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body.String())
+			}
+			got := recorder.created()
+			slices.SortFunc(got, func(a, b map[string]string) int { return strings.Compare(a["instance"], b["instance"]) })
+			if len(got) != len(tt.want) {
+				t.Fatalf("created silences %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if !maps.Equal(got[i], tt.want[i]) {
+					t.Errorf("silence %d matchers = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestHandleWebhookDeduplicatesSilences(t *testing.T) {
+	alert := map[string]any{"labels": map[string]string{"alertname": "HighLatency", "instance": "a"}}
+	body, _ := json.Marshal(map[string]any{
+		"event": map[string]string{"type": "silence", "until": time.Now().Add(time.Hour).UTC().Format(time.RFC3339)},
+		"user":  map[string]string{"email": "oncall@example.com"},
+		"alert_group": map[string]any{"id": "AG1", "last_alert": map[string]any{"payload": map[string]any{
+			"alerts": []map[string]any{alert, alert},
+		}}},
+	})
+
+	recorder := &silenceRecorder{}
+	cfg := testWebhookConfig()
+	cfg.EmailAllowlist = []string{"oncall@example.com"}
+	h := NewWebhookHandler(newAlertmanagerStub(t, recorder.ServeHTTP), nil, nil, cfg)
+
+	rec := httptest.NewRecorder()
+	h.HandleWebhook(rec, httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(body)))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body.String())
+	}
+	if got := recorder.created(); len(got) != 1 {
+		t.Errorf("created %d silences %v, want 1 for alerts with identical labels", len(got), got)
+	}
+	var response map[string]string
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if response["silences_created"] != "1" || response["silences_deduplicated"] != "1" {
+		t.Errorf("response = %v, want 1 silence created and 1 deduplicated", response)
+	}
+}
+
+func TestHandleWebhookStopsWhenCancelled(t *testing.T) {
+	alerts := make([]map[string]any, 5)
+	for i := range alerts {
+		alerts[i] = map[string]any{"fingerprint": fmt.Sprintf("fp%d", i), "labels": map[string]string{"alertname": "HighLatency", "instance": fmt.Sprint(i)}}
+	}
+	body, _ := json.Marshal(map[string]any{
+		"event":       map[string]string{"type": "silence", "until": time.Now().Add(time.Hour).UTC().Format(time.RFC3339)},
+		"user":        map[string]string{"email": "oncall@example.com"},
+		"alert_group": map[string]any{"id": "AG1", "last_alert": map[string]any{"payload": map[string]any{"alerts": alerts}}},
+	})
+
+	// The client goes away while the second silence is being created
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	recorder := &silenceRecorder{}
+	var attempts atomic.Int32
+	amClient := newAlertmanagerStub(t, func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) == 2 {
+			// Hold the response until the client has dropped the request; the body must be
+			// consumed for the server to notice the closed connection
+			io.Copy(io.Discard, r.Body)
+			cancel()
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		recorder.ServeHTTP(w, r)
+	})
+	cfg := testWebhookConfig()
+	cfg.EmailAllowlist = []string{"oncall@example.com"}
+	h := NewWebhookHandler(amClient, nil, nil, cfg)
+
+	rec := httptest.NewRecorder()
+	h.HandleWebhook(rec, httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(body)).WithContext(ctx))
+
+	if got := attempts.Load(); got != 2 {
+		t.Errorf("attempted %d silences, want creation to stop after the cancellation at the second", got)
+	}
+	var response map[string]string
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if rec.Code != http.StatusOK || response["silences_created"] != "1" {
+		t.Errorf("response = %d %v, want 200 reporting the 1 silence created before the cancellation", rec.Code, response)
+	}
+}
+
+func TestHandleWebhookDefaultSilenceDuration(t *testing.T) {
+	tests := []struct {
+		name            string
+		defaultDuration time.Duration
+		wantStatus      string
+	}{
+		{name: "default applied", defaultDuration: 2 * time.Hour, wantStatus: "silenced"},
+		{name: "no default still ignored", wantStatus: "ignored"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &silenceRecorder{}
+			cfg := testWebhookConfig()
+			cfg.EmailAllowlist = []string{"oncall@example.com"}
+			cfg.DefaultSilenceDuration = tt.defaultDuration
+			h := NewWebhookHandler(newAlertmanagerStub(t, recorder.ServeHTTP), nil, nil, cfg)
+
+			start := time.Now()
+			rec := httptest.NewRecorder()
+			h.HandleWebhook(rec, httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(webhookPayload("silence", "oncall@example.com", ""))))
+
+			var response map[string]string
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			if rec.Code != http.StatusOK || response["status"] != tt.wantStatus {
+				t.Fatalf("got %d %v, want 200 with status %q", rec.Code, response, tt.wantStatus)
+			}
+
+			ends := recorder.silenceEnds()
+			if tt.defaultDuration == 0 {
+				if len(ends) != 0 {
+					t.Errorf("created %d silences, want none", len(ends))
+				}
+				return
+			}
+			if len(ends) != 1 {
+				t.Fatalf("created %d silences, want 1", len(ends))
+			}
+			// The silence end time goes through RFC3339 encoding, which drops sub-second precision
+			if earliest, latest := start.Add(tt.defaultDuration).Add(-time.Second), time.Now().Add(tt.defaultDuration); ends[0].Before(earliest) || ends[0].After(latest) {
+				t.Errorf("silence ends at %v, want about %v from now", ends[0], tt.defaultDuration)
+			}
+		})
+	}
+}
+
+func TestHandleWebhookMinSilenceDuration(t *testing.T) {
+	tests := []struct {
+		name      string
+		until     time.Duration
+		wantAfter time.Duration
+	}{
+		{name: "too short silence extended", until: 5 * time.Second, wantAfter: 10 * time.Minute},
+		{name: "longer silence kept", until: time.Hour, wantAfter: time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &silenceRecorder{}
+			cfg := testWebhookConfig()
+			cfg.EmailAllowlist = []string{"oncall@example.com"}
+			cfg.MinSilenceDuration = 10 * time.Minute
+			h := NewWebhookHandler(newAlertmanagerStub(t, recorder.ServeHTTP), nil, nil, cfg)
+
+			start := time.Now()
+			until := start.Add(tt.until).UTC().Format(time.RFC3339)
+			rec := httptest.NewRecorder()
+			h.HandleWebhook(rec, httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(webhookPayload("silence", "oncall@example.com", until))))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body.String())
+			}
+			ends := recorder.silenceEnds()
+			if len(ends) != 1 {
+				t.Fatalf("created %d silences, want 1", len(ends))
+			}
+			// The until time and the silence end time go through RFC3339 encoding, which drops sub-second precision
+			if earliest, latest := start.Add(tt.wantAfter).Add(-time.Second), time.Now().Add(tt.wantAfter); ends[0].Before(earliest) || ends[0].After(latest) {
+				t.Errorf("silence ends at %v, want about %v from now", ends[0], tt.wantAfter)
+			}
+		})
+	}
+}
+
+func TestHandleWebhookRegexMatchers(t *testing.T) {
+	recorder := &silenceRecorder{}
+	cfg := testWebhookConfig()
+	cfg.EmailAllowlist = []string{"oncall@example.com"}
+	cfg.RegexMatchLabels = []string{"instance=db-[0-9]+", "pod", "broken=("}
+	h := NewWebhookHandler(newAlertmanagerStub(t, recorder.ServeHTTP), nil, nil, cfg)
+
+	body, _ := json.Marshal(map[string]any{
+		"event": map[string]string{"type": "silence", "until": time.Now().Add(time.Hour).UTC().Format(time.RFC3339)},
+		"user":  map[string]string{"email": "oncall@example.com"},
+		"alert_group": map[string]any{
+			"id": "AG1",
+			"last_alert": map[string]any{
+				"payload": map[string]any{
+					"alerts": []map[string]any{{
+						"fingerprint": "fp1",
+						"labels": map[string]string{
+							"alertname": "HighLatency",
+							"instance":  "db-1",
+							"pod":       "api-7d9f-x2k",
+							"broken":    "value",
+						},
+					}},
+				},
+			},
+		},
+	})
+	rec := httptest.NewRecorder()
+	h.HandleWebhook(rec, httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(string(body))))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body.String())
+	}
+
+	silences := recorder.created()
+	if len(silences) != 1 {
+		t.Fatalf("created %d silences, want 1", len(silences))
+	}
+	want := map[string]string{
+		"alertname": "HighLatency",
+		"instance":  "=~db-[0-9]+",
+		"pod":       "=~api-7d9f-.*",
+		// A label whose pattern does not compile keeps an exact matcher
+		"broken": "value",
+	}
+	if !maps.Equal(silences[0], want) {
+		t.Errorf("silence matchers = %v, want %v", silences[0], want)
+	}
+}
+
+func TestHandleWebhookExtraMatchers(t *testing.T) {
+	tests := []struct {
+		name       string
+		labels     map[string]string
+		wantStatus int
+		want       []map[string]string
+	}{
+		{
+			name:       "extra matcher added",
+			labels:     map[string]string{"alertname": "DiskFull"},
+			wantStatus: http.StatusOK,
+			want:       []map[string]string{{"alertname": "DiskFull", "source": "grafana-irm"}},
+		},
+		{
+			name:       "extra matcher equal to an alert label",
+			labels:     map[string]string{"alertname": "DiskFull", "source": "grafana-irm"},
+			wantStatus: http.StatusOK,
+			want:       []map[string]string{{"alertname": "DiskFull", "source": "grafana-irm"}},
+		},
+		{
+			name:       "extra matcher conflicting with an alert label",
+			labels:     map[string]string{"alertname": "DiskFull", "source": "prometheus"},
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &silenceRecorder{}
+			cfg := testWebhookConfig()
+			cfg.EmailAllowlist = []string{"oncall@example.com"}
+			cfg.ExtraMatchers = []string{"source=grafana-irm"}
+			h := NewWebhookHandler(newAlertmanagerStub(t, recorder.ServeHTTP), nil, nil, cfg)
+
+			body, _ := json.Marshal(map[string]any{
+				"event": map[string]string{"type": "silence", "until": time.Now().Add(time.Hour).UTC().Format(time.RFC3339)},
+				"user":  map[string]string{"email": "oncall@example.com"},
+				"alert_group": map[string]any{
+					"id": "AG1",
+					"last_alert": map[string]any{
+						"payload": map[string]any{"alerts": []map[string]any{{"fingerprint": "fp1", "labels": tt.labels}}},
+					},
+				},
+			})
+			rec := httptest.NewRecorder()
+			h.HandleWebhook(rec, httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(body)))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			got := recorder.created()
+			if len(got) != len(tt.want) {
+				t.Fatalf("created silences %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if !maps.Equal(got[i], tt.want[i]) {
+					t.Errorf("silence %d matchers = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestHandleWebhookResolveExpiresSilences(t *testing.T) {
+	silence := func(id, state, comment string) map[string]any {
+		return map[string]any{
+			"id":        id,
+			"status":    map[string]string{"state": state},
+			"comment":   comment,
+			"createdBy": "oncall@example.com",
+			"startsAt":  "2024-01-01T00:00:00Z",
+			"endsAt":    "2024-01-01T01:00:00Z",
+			"updatedAt": "2024-01-01T00:00:00Z",
+			"matchers":  []map[string]any{{"name": "alertname", "value": "HighLatency", "isRegex": false, "isEqual": true}},
+		}
+	}
+	silences := []map[string]any{
+		silence("s-group", "active", alertmanager.ToolSilenceCommentPrefix+" HighLatency - https://grafana.example.com (ID: AG1)"),
+		silence("s-expired", "expired", alertmanager.ToolSilenceCommentPrefix+" HighLatency - https://grafana.example.com (ID: AG1)"),
+		silence("s-other-group", "active", alertmanager.ToolSilenceCommentPrefix+" DiskFull - https://grafana.example.com (ID: AG12)"),
+		silence("s-manual", "active", "same incident as (ID: AG1)"),
+	}
+
+	tests := []struct {
+		name            string
+		expireOnResolve bool
+		wantExpired     []string
+	}{
+		{name: "enabled", expireOnResolve: true, wantExpired: []string{"s-group"}},
+		{name: "disabled", expireOnResolve: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mutex sync.Mutex
+			var expired []string
+			am := newAlertmanagerStub(t, func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.Method == http.MethodGet && r.URL.Path == "/api/v2/silences":
+					jsonResponse(silences)(w, r)
+				case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/api/v2/silence/"):
+					mutex.Lock()
+					expired = append(expired, strings.TrimPrefix(r.URL.Path, "/api/v2/silence/"))
+					mutex.Unlock()
+				default:
+					http.NotFound(w, r)
+				}
+			})
+			cfg := testWebhookConfig()
+			cfg.ExpireOnResolve = tt.expireOnResolve
+			h := NewWebhookHandler(am, newGrafanaStub(t, unavailable), testExporter(), cfg)
+
+			rec := httptest.NewRecorder()
+			h.HandleWebhook(rec, httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(webhookPayload("resolve", "oncall@example.com", ""))))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+			}
+			if !slices.Equal(expired, tt.wantExpired) {
+				t.Errorf("expired silences = %v, want %v", expired, tt.wantExpired)
+			}
+		})
+	}
+}
+
+func TestHandleWebhookRejectedSilence(t *testing.T) {
+	until := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	tests := []struct {
+		name       string
+		statuses   []int
+		wantStatus int
+	}{
+		{name: "rejected by alertmanager", statuses: []int{http.StatusBadRequest}, wantStatus: http.StatusBadRequest},
+		{name: "alertmanager failure", statuses: []int{http.StatusInternalServerError}, wantStatus: http.StatusInternalServerError},
+		{name: "rejected and failed", statuses: []int{http.StatusBadRequest, http.StatusInternalServerError}, wantStatus: http.StatusInternalServerError},
+		{name: "failed and rejected", statuses: []int{http.StatusInternalServerError, http.StatusBadRequest}, wantStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			am := newAlertmanagerStub(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost || r.URL.Path != "/api/v2/silences" {
+					http.NotFound(w, r)
+					return
+				}
+				status := tt.statuses[int(requests.Add(1)-1)%len(tt.statuses)]
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(status)
+				fmt.Fprint(w, `"silence invalid: bad matcher"`)
+			})
+			cfg := testWebhookConfig()
+			cfg.EmailAllowlist = []string{"oncall@example.com"}
+			h := NewWebhookHandler(am, nil, testExporter(), cfg)
+
+			// One alert per Alertmanager response, with distinct labels so no silence is deduplicated
+			alerts := make([]map[string]any, len(tt.statuses))
+			for i := range alerts {
+				alerts[i] = map[string]any{"fingerprint": fmt.Sprintf("fp%d", i), "labels": map[string]string{"alertname": fmt.Sprintf("Alert%d", i)}}
+			}
+			body, _ := json.Marshal(map[string]any{
+				"event":       map[string]string{"type": "silence", "until": until},
+				"user":        map[string]string{"email": "oncall@example.com"},
+				"alert_group": map[string]any{"id": "AG1", "last_alert": map[string]any{"payload": map[string]any{"alerts": alerts}}},
+			})
+
+			rec := httptest.NewRecorder()
+			h.HandleWebhook(rec, httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(string(body))))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestSilenceAuthor(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		username string
+		want     string
+	}{
+		{name: "no template uses the email", username: "jdoe", want: "jdoe@example.com"},
+		{name: "template rendered", template: "{{.Username}}@irm", username: "jdoe", want: "jdoe@irm"},
+		{name: "template with every field", template: "{{.ID}}/{{.Username}}/{{.Email}}", username: "jdoe", want: "U1/jdoe/jdoe@example.com"},
+		{name: "invalid template falls back to the email", template: "{{.Username", username: "jdoe", want: "jdoe@example.com"},
+		{name: "failing template falls back to the email", template: "{{.Team}}", username: "jdoe", want: "jdoe@example.com"},
+		{name: "empty rendering falls back to the email", template: "{{.Username}}", want: "jdoe@example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testWebhookConfig()
+			cfg.AuthorTemplate = tt.template
+			h := NewWebhookHandler(nil, nil, nil, cfg)
+
+			var event WebhookEvent
+			event.User.ID = "U1"
+			event.User.Username = tt.username
+			event.User.Email = "jdoe@example.com"
+			if got := h.silenceAuthor(context.Background(), event); got != tt.want {
+				t.Errorf("silenceAuthor() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrefixPattern(t *testing.T) {
+	tests := map[string]string{
+		"api-7d9f-x2k": "api-7d9f-.*",
+		"db.internal":  `db\.internal`,
+		"web-":         "web-.*",
+	}
+	for value, want := range tests {
+		if got := prefixPattern(value); got != want {
+			t.Errorf("prefixPattern(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
+
+func TestHandleWebhookBodyLimit(t *testing.T) {
+	recorder := &silenceRecorder{}
+	cfg := testWebhookConfig()
+	cfg.EmailAllowlist = []string{"oncall@example.com"}
+	h := NewWebhookHandler(newAlertmanagerStub(t, recorder.ServeHTTP), nil, nil, cfg)
+
+	// A valid silence event padded past the default 1MB limit with an oversized title
+	until := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	body, _ := json.Marshal(map[string]any{
+		"event": map[string]string{"type": "silence", "until": until},
+		"user":  map[string]string{"email": "oncall@example.com"},
+		"alert_group": map[string]any{
+			"id":    "AG1",
+			"title": strings.Repeat("x", 1<<20),
+			"last_alert": map[string]any{
+				"payload": map[string]any{
+					"alerts": []map[string]any{{"fingerprint": "fp1", "labels": map[string]string{"alertname": "HighLatency"}}},
+				},
+			},
+		},
+	})
+
+	rec := httptest.NewRecorder()
+	h.HandleWebhook(rec, httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(string(body))))
+
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want 413", rec.Code)
+	}
+	if silences := recorder.created(); len(silences) != 0 {
+		t.Errorf("created %d silences for an oversized payload, want none", len(silences))
+	}
+}
@@ -0,0 +1,62 @@
+package sync
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// errCircuitOpen is returned when a Grafana call is short-circuited by an open circuit breaker
+var errCircuitOpen = errors.New("grafana circuit breaker is open")
+
+// circuitBreaker stops calling Grafana after consecutive failures until a cooldown has elapsed
+// Once the cooldown is over the circuit is half-open: the next call is attempted, a success
+// closes the circuit and a failure opens it again for another cooldown
+type circuitBreaker struct {
+	mutex     sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+	now       func() time.Time
+}
+
+// newCircuitBreaker creates a circuit breaker opening after threshold consecutive failures
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+// Allow reports whether a call may be attempted
+func (cb *circuitBreaker) Allow() bool {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	return !cb.now().Before(cb.openUntil)
+}
+
+// RecordSuccess closes the circuit and resets the failure count
+func (cb *circuitBreaker) RecordSuccess() {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	cb.failures = 0
+	cb.openUntil = time.Time{}
+}
+
+// RecordFailure counts a failed call and reports whether it opened the circuit
+func (cb *circuitBreaker) RecordFailure() bool {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	cb.failures++
+	if cb.failures < cb.threshold {
+		return false
+	}
+
+	cb.openUntil = cb.now().Add(cb.cooldown)
+	return true
+}
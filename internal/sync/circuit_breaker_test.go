@@ -0,0 +1,89 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/config"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cb := newCircuitBreaker(3, time.Minute)
+	cb.now = func() time.Time { return now }
+
+	// Open: the threshold-th consecutive failure opens the circuit
+	for i := 1; i <= 3; i++ {
+		if !cb.Allow() {
+			t.Fatalf("call %d short-circuited before the threshold was reached", i)
+		}
+		if opened := cb.RecordFailure(); opened != (i == 3) {
+			t.Fatalf("RecordFailure() #%d opened = %v, want %v", i, opened, i == 3)
+		}
+	}
+	if cb.Allow() {
+		t.Fatal("circuit should be open after 3 consecutive failures")
+	}
+
+	// Cooldown: calls stay short-circuited until it has elapsed
+	now = now.Add(59 * time.Second)
+	if cb.Allow() {
+		t.Fatal("circuit should stay open during the cooldown")
+	}
+
+	// Half-open: a single failure after the cooldown opens the circuit again
+	now = now.Add(time.Second)
+	if !cb.Allow() {
+		t.Fatal("circuit should be half-open once the cooldown has elapsed")
+	}
+	if !cb.RecordFailure() {
+		t.Fatal("a failed half-open call should reopen the circuit")
+	}
+	if cb.Allow() {
+		t.Fatal("circuit should be open again after a failed half-open call")
+	}
+
+	// Recovery: a successful half-open call closes the circuit and resets the failure count
+	now = now.Add(time.Minute)
+	if !cb.Allow() {
+		t.Fatal("circuit should be half-open after the second cooldown")
+	}
+	cb.RecordSuccess()
+	if cb.RecordFailure() || cb.RecordFailure() {
+		t.Fatal("failures before the success should not count towards the threshold")
+	}
+	if !cb.Allow() {
+		t.Fatal("circuit should be closed after recovering")
+	}
+}
+
+func TestReconcileStopsResolvingWhenCircuitOpens(t *testing.T) {
+	var alerts []fakeAlert
+	fake := &fakeGrafana{failResolve: map[string]bool{}}
+	for i := range 5 {
+		fingerprint, id := fmt.Sprintf("fp%d", i), fmt.Sprintf("IG%d", i)
+		alerts = append(alerts, fakeAlert{
+			fingerprint: fingerprint,
+			labels:      map[string]string{"alertname": fmt.Sprintf("Alert%d", i)},
+			silencedBy:  []string{"s" + fingerprint},
+		})
+		fake.groups = append(fake.groups, alertGroup(id, "new", fingerprint))
+		fake.failResolve[id] = true
+	}
+	r := NewReconciler(newAlertmanagerStub(t, alertmanagerAPI(alerts)), newGrafanaStub(t, fake.ServeHTTP), testExporter(),
+		config.ReconcileConfig{CircuitBreakerThreshold: 2, CircuitBreakerCooldown: 60}, config.TenantConfig{})
+
+	opened := metricValue(t, "alertmanager_sync_grafana_circuit_open_total")
+	if _, err := r.ReconcileAndResolveOptimized(context.Background()); err != nil {
+		t.Fatalf("ReconcileAndResolveOptimized() error = %v", err)
+	}
+
+	if got := fake.resolveAttempts(); got != 2 {
+		t.Errorf("resolve attempts = %d, want 2 before the circuit opens", got)
+	}
+	if got := metricValue(t, "alertmanager_sync_grafana_circuit_open_total") - opened; got != 1 {
+		t.Errorf("alertmanager_sync_grafana_circuit_open_total increased by %v, want 1", got)
+	}
+}
@@ -0,0 +1,135 @@
+package sync
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/config"
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/grafana"
+)
+
+func TestReconcileAndResolveEndToEnd(t *testing.T) {
+	tests := []struct {
+		name        string
+		alerts      []fakeAlert
+		groups      []grafana.AlertGroup
+		failResolve map[string]bool
+
+		wantResolved        []string
+		wantInconsistencies int
+		wantFailed          int
+	}{
+		{
+			name: "silenced alert of a firing group is resolved",
+			alerts: []fakeAlert{
+				{fingerprint: "fp1", labels: map[string]string{"alertname": "DiskFull"}, silencedBy: []string{"s1"}},
+				{fingerprint: "fp2", labels: map[string]string{"alertname": "HighLatency"}},
+			},
+			groups: []grafana.AlertGroup{
+				alertGroup("IG1", "new", "fp1"),
+				alertGroup("IG2", "new", "fp2"),
+			},
+			wantResolved:        []string{"IG1"},
+			wantInconsistencies: 1,
+		},
+		{
+			name: "a group is resolved once for several silenced alerts",
+			alerts: []fakeAlert{
+				{fingerprint: "fp1", labels: map[string]string{"alertname": "DiskFull"}, silencedBy: []string{"s1"}},
+				{fingerprint: "fp2", labels: map[string]string{"alertname": "DiskFull"}, silencedBy: []string{"s1"}},
+			},
+			groups:              []grafana.AlertGroup{alertGroup("IG1", "new", "fp1", "fp2")},
+			wantResolved:        []string{"IG1"},
+			wantInconsistencies: 2,
+		},
+		{
+			name: "silenced alerts without a firing group are left alone",
+			alerts: []fakeAlert{
+				{fingerprint: "fp1", labels: map[string]string{"alertname": "DiskFull"}, silencedBy: []string{"s1"}},
+				{fingerprint: "fp2", labels: map[string]string{"alertname": "HighLatency"}, silencedBy: []string{"s2"}},
+			},
+			groups: []grafana.AlertGroup{alertGroup("IG1", "resolved", "fp1")},
+		},
+		{
+			name: "failed resolutions are counted",
+			alerts: []fakeAlert{
+				{fingerprint: "fp1", labels: map[string]string{"alertname": "DiskFull"}, silencedBy: []string{"s1"}},
+				{fingerprint: "fp2", labels: map[string]string{"alertname": "HighLatency"}, silencedBy: []string{"s2"}},
+			},
+			groups: []grafana.AlertGroup{
+				alertGroup("IG1", "new", "fp1"),
+				alertGroup("IG2", "new", "fp2"),
+			},
+			failResolve:         map[string]bool{"IG1": true},
+			wantResolved:        []string{"IG2"},
+			wantInconsistencies: 2,
+			wantFailed:          1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeGrafana{groups: tt.groups, failResolve: tt.failResolve}
+			amClient := newAlertmanagerStub(t, alertmanagerAPI(tt.alerts))
+			r := NewReconciler(amClient, newGrafanaStub(t, fake.ServeHTTP), testExporter(), config.ReconcileConfig{
+				CircuitBreakerThreshold: 5,
+				CircuitBreakerCooldown:  60,
+			}, config.TenantConfig{})
+
+			before := map[string]float64{}
+			for _, name := range []string{
+				"alertmanager_sync_reconciliation_total",
+				"alertmanager_sync_inconsistencies_resolved_total",
+				"alertmanager_sync_inconsistencies_failed_resolve_total",
+			} {
+				before[name] = metricValue(t, name)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if _, err := r.ReconcileAndResolveOptimized(ctx); err != nil {
+				t.Fatalf("ReconcileAndResolveOptimized() error = %v", err)
+			}
+
+			if got := fake.resolvedGroups(); !slices.Equal(got, tt.wantResolved) {
+				t.Errorf("resolved alert groups = %v, want %v", got, tt.wantResolved)
+			}
+			if !r.FirstReconcileDone() {
+				t.Error("FirstReconcileDone() = false after a successful cycle")
+			}
+
+			metricDeltas := map[string]float64{
+				"alertmanager_sync_reconciliation_total":                 1,
+				"alertmanager_sync_inconsistencies_resolved_total":       float64(len(tt.wantResolved)),
+				"alertmanager_sync_inconsistencies_failed_resolve_total": float64(tt.wantFailed),
+			}
+			for name, want := range metricDeltas {
+				if got := metricValue(t, name) - before[name]; got != want {
+					t.Errorf("%s increased by %v, want %v", name, got, want)
+				}
+			}
+			if got := metricValue(t, "alertmanager_sync_inconsistencies_found"); got != float64(tt.wantInconsistencies) {
+				t.Errorf("alertmanager_sync_inconsistencies_found = %v, want %d", got, tt.wantInconsistencies)
+			}
+			if got := metricValue(t, "alertmanager_sync_inconsistencies_by_reason"); got != float64(tt.wantInconsistencies) {
+				t.Errorf("alertmanager_sync_inconsistencies_by_reason sums to %v, want %d", got, tt.wantInconsistencies)
+			}
+			if got := metricValue(t, "alertmanager_sync_alert_state"); got != float64(countActive(tt.alerts)) {
+				t.Errorf("alertmanager_sync_alert_state sums to %v, want %d active alerts", got, countActive(tt.alerts))
+			}
+		})
+	}
+}
+
+// countActive returns the number of alerts that are not silenced
+func countActive(alerts []fakeAlert) int {
+	active := 0
+	for _, alert := range alerts {
+		if len(alert.silencedBy) == 0 {
+			active++
+		}
+	}
+	return active
+}
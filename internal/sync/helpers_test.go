@@ -0,0 +1,260 @@
+package sync
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/alertmanager"
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/config"
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/grafana"
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	exporterOnce sync.Once
+	exporter     *metrics.Exporter
+)
+
+// testExporter returns the exporter shared by the package tests, as its metrics can only be registered once
+func testExporter() *metrics.Exporter {
+	exporterOnce.Do(func() {
+		exporter = metrics.NewExporter(config.MetricsConfig{}, config.TenantConfig{})
+	})
+	return exporter
+}
+
+// metricValue returns the sum of the values of every series of a registered metric
+func metricValue(t *testing.T, name string) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("gathering metrics: %v", err)
+	}
+
+	total := 0.0
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			total += metric.GetCounter().GetValue() + metric.GetGauge().GetValue()
+		}
+	}
+	return total
+}
+
+// histogramCount returns the number of observations of the series of a registered histogram with the given label value
+func histogramCount(t *testing.T, name, label, value string) uint64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("gathering metrics: %v", err)
+	}
+
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, pair := range metric.GetLabel() {
+				if pair.GetName() == label && pair.GetValue() == value {
+					return metric.GetHistogram().GetSampleCount()
+				}
+			}
+		}
+	}
+	return 0
+}
+
+// newAlertmanagerStub starts a fake Alertmanager API and returns a client pointed at it
+func newAlertmanagerStub(t *testing.T, handler http.HandlerFunc) *alertmanager.Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	return alertmanager.NewClient(config.AlertmanagerConfig{Host: strings.TrimPrefix(srv.URL, "http://")})
+}
+
+// newGrafanaStub starts a fake Grafana IRM API and returns a client pointed at it
+func newGrafanaStub(t *testing.T, handler http.HandlerFunc) *grafana.Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	client, err := grafana.NewClient(config.GrafanaConfig{URL: srv.URL, Token: "glsa_test"})
+	if err != nil {
+		t.Fatalf("creating grafana client: %v", err)
+	}
+	return client
+}
+
+// jsonResponse returns a handler answering every request with the JSON encoding of body
+func jsonResponse(body any) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(body)
+	}
+}
+
+// fakeAlert is an alert served by the fake Alertmanager
+type fakeAlert struct {
+	fingerprint string
+	labels      map[string]string
+	// silencedBy holds the IDs of the silences suppressing the alert (active when empty)
+	silencedBy []string
+	// silenceAge is how long ago the silences started (an hour when zero)
+	silenceAge time.Duration
+}
+
+// alertmanagerAPI returns a handler emulating the Alertmanager API serving the given alerts
+// Every silence referenced by the alerts exists, started silenceAge ago
+func alertmanagerAPI(alerts []fakeAlert) http.HandlerFunc {
+	now := time.Now().UTC()
+
+	silences := make(map[string]map[string]any)
+	gettable := make([]map[string]any, 0, len(alerts))
+	for _, alert := range alerts {
+		state := "active"
+		if len(alert.silencedBy) > 0 {
+			state = "suppressed"
+		}
+		gettable = append(gettable, map[string]any{
+			"labels":      alert.labels,
+			"annotations": map[string]string{},
+			"fingerprint": alert.fingerprint,
+			"receivers":   []map[string]string{{"name": "grafana-irm"}},
+			"startsAt":    now.Add(-2 * time.Hour).Format(time.RFC3339),
+			"endsAt":      now.Add(time.Hour).Format(time.RFC3339),
+			"updatedAt":   now.Format(time.RFC3339),
+			"status": map[string]any{
+				"state":       state,
+				"silencedBy":  append([]string{}, alert.silencedBy...),
+				"inhibitedBy": []string{},
+			},
+		})
+		silenceAge := alert.silenceAge
+		if silenceAge == 0 {
+			silenceAge = time.Hour
+		}
+		for _, id := range alert.silencedBy {
+			silences[id] = map[string]any{
+				"id":        id,
+				"comment":   "maintenance",
+				"createdBy": "oncall@example.com",
+				"startsAt":  now.Add(-silenceAge).Format(time.RFC3339),
+				"endsAt":    now.Add(time.Hour).Format(time.RFC3339),
+				"updatedAt": now.Add(-silenceAge).Format(time.RFC3339),
+				"matchers":  []map[string]any{{"name": "alertname", "value": alert.labels["alertname"], "isRegex": false, "isEqual": true}},
+				"status":    map[string]string{"state": "active"},
+			}
+		}
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/api/v2/alerts":
+			json.NewEncoder(w).Encode(gettable)
+		case strings.HasPrefix(r.URL.Path, "/api/v2/silence/"):
+			silence, exists := silences[strings.TrimPrefix(r.URL.Path, "/api/v2/silence/")]
+			if !exists {
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, `"silence not found"`)
+				return
+			}
+			json.NewEncoder(w).Encode(silence)
+		default:
+			http.NotFound(w, r)
+		}
+	}
+}
+
+// fakeGrafana emulates the Grafana IRM alert group API, recording the resolved alert groups
+type fakeGrafana struct {
+	groups []grafana.AlertGroup
+	// failResolve lists the alert groups whose resolution fails with a 500
+	failResolve map[string]bool
+
+	mutex    sync.Mutex
+	attempts int
+	resolved []string
+	notes    []grafana.ResolutionNote
+}
+
+// ServeHTTP implements http.Handler
+func (f *fakeGrafana) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/alert_groups":
+		json.NewEncoder(w).Encode(grafana.AlertGroupResponse{Results: f.groups})
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/resolve"):
+		id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/v1/alert_groups/"), "/resolve")
+		f.mutex.Lock()
+		f.attempts++
+		f.mutex.Unlock()
+		if f.failResolve[id] {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `{"detail":"boom"}`)
+			return
+		}
+		f.mutex.Lock()
+		f.resolved = append(f.resolved, id)
+		f.mutex.Unlock()
+		fmt.Fprint(w, `{}`)
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v1/resolution_notes/":
+		var note grafana.ResolutionNote
+		if err := json.NewDecoder(r.Body).Decode(&note); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.mutex.Lock()
+		f.notes = append(f.notes, note)
+		f.mutex.Unlock()
+		fmt.Fprint(w, `{}`)
+	case strings.HasPrefix(r.URL.Path, "/api/v1/users/"):
+		json.NewEncoder(w).Encode(grafana.User{ID: strings.TrimPrefix(r.URL.Path, "/api/v1/users/"), Email: "oncall@example.com"})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"detail":"Not found."}`)
+	}
+}
+
+// resolvedGroups returns the sorted IDs of the alert groups resolved so far
+func (f *fakeGrafana) resolvedGroups() []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	resolved := slices.Clone(f.resolved)
+	slices.Sort(resolved)
+	return resolved
+}
+
+// resolveAttempts returns the number of resolve requests received so far, successful or not
+func (f *fakeGrafana) resolveAttempts() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.attempts
+}
+
+// resolutionNotes returns the resolution notes added so far, in the order they were received
+func (f *fakeGrafana) resolutionNotes() []grafana.ResolutionNote {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return slices.Clone(f.notes)
+}
+
+// alertGroup builds an alert group in the given state holding alerts with the given fingerprints
+func alertGroup(id, state string, fingerprints ...string) grafana.AlertGroup {
+	group := grafana.AlertGroup{ID: id, State: state, AlertsCount: len(fingerprints)}
+	for _, fingerprint := range fingerprints {
+		group.LastAlert.Payload.Alerts = append(group.LastAlert.Payload.Alerts, grafana.Alert{Fingerprint: fingerprint})
+	}
+	return group
+}
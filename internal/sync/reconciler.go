@@ -2,65 +2,761 @@ package sync
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
 
 	"github.com/gabrielpetry/alertmanager-alert-sync/internal/alertmanager"
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/audit"
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/config"
 	"github.com/gabrielpetry/alertmanager-alert-sync/internal/grafana"
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/logging"
 	"github.com/gabrielpetry/alertmanager-alert-sync/internal/metrics"
 	"github.com/prometheus/alertmanager/api/v2/models"
 )
 
+// Reconciliation phases timed in metrics
+const (
+	phaseFetchAlertmanager = "fetch_alertmanager"
+	phaseFetchGrafana      = "fetch_grafana"
+	phaseExportMetrics     = "export_metrics"
+	phaseResolve           = "resolve"
+)
+
+// Match strategies used to pair Alertmanager alerts with Grafana IRM alert groups
+const (
+	MatchStrategyFingerprint = "fingerprint"
+	MatchStrategyLabels      = "labels"
+	MatchStrategyBoth        = "both"
+)
+
+// Reconcile modes selecting the operations run in each reconciliation cycle
+const (
+	ModeExportOnly = "export_only"
+	ModeResolve    = "resolve"
+	ModeBoth       = "both"
+)
+
+// severityRanks orders the severity label values from least to most severe
+// Alerts with a missing or unknown severity never meet a minimum severity
+var severityRanks = map[string]int{
+	"info":     1,
+	"warning":  2,
+	"error":    3,
+	"critical": 4,
+}
+
+// defaultResolveNoteTemplate is the resolution note added to resolved alert groups when RESOLVE_NOTE_TEMPLATE is unset
+const defaultResolveNoteTemplate = "Automatically resolved by alertmanager-alert-sync: {{.Reason}} (alert {{.Alertname}}, fingerprint {{.Fingerprint}}, silences {{.SilenceIDs}})"
+
+// resolveNoteData is the data the resolution note template is rendered with
+type resolveNoteData struct {
+	Alertname    string
+	Fingerprint  string
+	AlertGroupID string
+	Reason       string
+	SilenceIDs   string
+}
+
+// Reasons for skipping the resolution of an inconsistency, reported in metrics
+const (
+	skipReasonBelowMinSeverity = "below_min_severity"
+	skipReasonReadOnly         = "read_only"
+)
+
+// Inconsistency reasons, used as the reason label of the inconsistency metrics
+const (
+	ReasonSilencedFiring = "silenced_firing"
+)
+
+// reasonDescriptions holds the human readable description logged for each inconsistency reason
+var reasonDescriptions = map[string]string{
+	ReasonSilencedFiring: "Alert is silenced in Alertmanager but still firing in Grafana IRM",
+}
+
+// describeReason returns the description of an inconsistency reason, or the reason itself if unknown
+func describeReason(reason string) string {
+	if description, exists := reasonDescriptions[reason]; exists {
+		return description
+	}
+	return reason
+}
+
 // Reconciler handles the synchronization between Alertmanager and Grafana IRM
 type Reconciler struct {
 	amClient      *alertmanager.Client
 	grafanaClient *grafana.Client
 	metrics       *metrics.Exporter
+	matchStrategy string
+	mode          string
+
+	// fetchAlerts and fetchAlertGroups fetch the data compared on each cycle, replaceable in tests
+	fetchAlerts      func(ctx context.Context) ([]*models.GettableAlert, error)
+	fetchAlertGroups func(ctx context.Context) ([]grafana.AlertGroup, error)
+
+	// Silenced alerts carrying this label value are never reconciled
+	ignoreLabelName  string
+	ignoreLabelValue string
+
+	// Only alerts carrying this tenant label value are reconciled (all alerts when the label is empty)
+	tenantLabel string
+	tenantValue string
+
+	// activeStates holds the lowercased alert group states eligible for resolution (firing only by default)
+	activeStates map[string]bool
+
+	// managedIntegrations holds the Grafana IRM integration IDs this tool manages (nil manages all of them)
+	managedIntegrations map[string]bool
+
+	// protectedAlertnames holds the alertnames never resolved automatically
+	protectedAlertnames map[string]bool
+
+	// minSeverity is the least severe severity label value still resolved (empty resolves all)
+	minSeverity string
+
+	// resolveGracePeriod is how long an alert must be silenced before it is resolved
+	// firstSeen tracks when each inconsistency (by firstSeenKey) was first detected
+	resolveGracePeriod time.Duration
+	firstSeenMutex     sync.Mutex
+	firstSeen          map[string]time.Time
+
+	// resolveNote renders the note added to resolved alert groups (nil adds no note)
+	resolveNote *template.Template
+
+	// expireOrphanedSilences expires the silences created by this tool whose alert group is resolved or gone
+	expireOrphanedSilences bool
+
+	// circuitBreaker short-circuits Grafana resolutions while Grafana is failing
+	circuitBreaker *circuitBreaker
+
+	// cycleSlot holds a token while a reconciliation cycle runs, so the loop, /reconcile and
+	// Alertmanager webhooks never resolve or export concurrently; a channel lets waiters honor their context
+	cycleSlot chan struct{}
+
+	// firstReconcileDone is set once the first reconciliation cycle succeeds
+	firstReconcileDone atomic.Bool
+	// lastSuccess holds the Unix time (nanoseconds) of the last successful reconciliation
+	lastSuccess atomic.Int64
 }
 
 // NewReconciler creates a new Reconciler instance
-func NewReconciler(amClient *alertmanager.Client, grafanaClient *grafana.Client, metricsExporter *metrics.Exporter) *Reconciler {
+// The match strategy (fingerprint, labels or both) defaults to fingerprint
+func NewReconciler(amClient *alertmanager.Client, grafanaClient *grafana.Client, metricsExporter *metrics.Exporter, cfg config.ReconcileConfig, tenant config.TenantConfig) *Reconciler {
+	matchStrategy := cfg.MatchStrategy
+	switch matchStrategy {
+	case MatchStrategyFingerprint, MatchStrategyLabels, MatchStrategyBoth:
+	case "":
+		matchStrategy = MatchStrategyFingerprint
+	default:
+		log.Printf("Invalid MATCH_STRATEGY value '%s', using '%s'", matchStrategy, MatchStrategyFingerprint)
+		matchStrategy = MatchStrategyFingerprint
+	}
+	log.Printf("Reconciler using match strategy: %s", matchStrategy)
+
+	mode := cfg.Mode
+	switch mode {
+	case ModeExportOnly, ModeResolve, ModeBoth:
+	case "":
+		mode = ModeBoth
+	default:
+		log.Printf("Invalid RECONCILE_MODE value '%s', using '%s'", mode, ModeBoth)
+		mode = ModeBoth
+	}
+	log.Printf("Reconciler using mode: %s", mode)
+
+	// Parse the ignore selector (name=value) from RECONCILE_IGNORE_LABEL
+	var ignoreLabelName, ignoreLabelValue string
+	if ignoreLabel := cfg.IgnoreLabel; ignoreLabel != "" {
+		name, value, found := strings.Cut(ignoreLabel, "=")
+		name = strings.TrimSpace(name)
+		if !found || name == "" {
+			log.Printf("Invalid RECONCILE_IGNORE_LABEL value '%s', must be in the form name=value", ignoreLabel)
+		} else {
+			ignoreLabelName = name
+			ignoreLabelValue = strings.TrimSpace(value)
+			log.Printf("Silenced alerts with %s=%s will be ignored by reconciliation", ignoreLabelName, ignoreLabelValue)
+		}
+	}
+
+	minSeverity := strings.ToLower(cfg.ResolveMinSeverity)
+	if _, known := severityRanks[minSeverity]; minSeverity != "" && !known {
+		log.Printf("Invalid RESOLVE_MIN_SEVERITY value '%s', resolving all severities", cfg.ResolveMinSeverity)
+		minSeverity = ""
+	}
+	if minSeverity != "" {
+		log.Printf("Only alerts with severity %s or higher will be resolved", minSeverity)
+	}
+
+	activeStates := parseActiveStates(cfg.GrafanaActiveStates)
+	if len(cfg.GrafanaActiveStates) > 0 {
+		log.Printf("Only Grafana alert groups in states %v will be resolved", cfg.GrafanaActiveStates)
+	}
+
+	var managedIntegrations map[string]bool
+	if len(cfg.ManagedIntegrations) > 0 {
+		managedIntegrations = make(map[string]bool, len(cfg.ManagedIntegrations))
+		for _, id := range cfg.ManagedIntegrations {
+			managedIntegrations[id] = true
+		}
+		log.Printf("Only Grafana alert groups of integrations %v will be reconciled", cfg.ManagedIntegrations)
+	}
+
+	if tenant.Label != "" {
+		log.Printf("Only alerts with %s=%s will be reconciled", tenant.Label, tenant.Value)
+	}
+
+	var protectedAlertnames map[string]bool
+	if len(cfg.ProtectedAlertnames) > 0 {
+		protectedAlertnames = make(map[string]bool, len(cfg.ProtectedAlertnames))
+		for _, alertname := range cfg.ProtectedAlertnames {
+			protectedAlertnames[alertname] = true
+		}
+		log.Printf("Alerts named %v will never be resolved automatically", cfg.ProtectedAlertnames)
+	}
+
+	var resolveNote *template.Template
+	if cfg.ResolveAddNote {
+		noteTemplate := cfg.ResolveNoteTemplate
+		if noteTemplate == "" {
+			noteTemplate = defaultResolveNoteTemplate
+		}
+		tmpl, err := template.New("resolution_note").Parse(noteTemplate)
+		if err != nil {
+			log.Printf("Invalid RESOLVE_NOTE_TEMPLATE, resolution notes disabled: %v", err)
+		} else {
+			resolveNote = tmpl
+			log.Println("Resolution notes will be added to resolved alert groups")
+		}
+	}
+
 	return &Reconciler{
-		amClient:      amClient,
-		grafanaClient: grafanaClient,
-		metrics:       metricsExporter,
+		amClient:               amClient,
+		grafanaClient:          grafanaClient,
+		fetchAlerts:            amClient.GetAllAlerts,
+		fetchAlertGroups:       grafanaClient.GetAllAlertGroups,
+		metrics:                metricsExporter,
+		matchStrategy:          matchStrategy,
+		mode:                   mode,
+		ignoreLabelName:        ignoreLabelName,
+		ignoreLabelValue:       ignoreLabelValue,
+		tenantLabel:            tenant.Label,
+		tenantValue:            tenant.Value,
+		protectedAlertnames:    protectedAlertnames,
+		minSeverity:            minSeverity,
+		activeStates:           activeStates,
+		managedIntegrations:    managedIntegrations,
+		resolveGracePeriod:     cfg.ResolveGracePeriod,
+		resolveNote:            resolveNote,
+		expireOrphanedSilences: cfg.ExpireOrphanedSilences,
+		firstSeen:              make(map[string]time.Time),
+		cycleSlot:              make(chan struct{}, 1),
+		circuitBreaker: newCircuitBreaker(
+			cfg.CircuitBreakerThreshold,
+			time.Duration(cfg.CircuitBreakerCooldown)*time.Second,
+		),
 	}
 }
 
+// parseActiveStates builds the set of eligible alert group states, mapping the firing alias to IRM's new state
+// An empty list defaults to firing only, so acknowledged and silenced groups are left to their owners
+func parseActiveStates(states []string) map[string]bool {
+	if len(states) == 0 {
+		return map[string]bool{grafana.AlertGroupStateNew: true}
+	}
+
+	active := make(map[string]bool, len(states))
+	for _, state := range states {
+		state = strings.ToLower(state)
+		if state == "firing" {
+			state = grafana.AlertGroupStateNew
+		}
+		active[state] = true
+	}
+	return active
+}
+
+// isActiveGroup reports whether the alert group is in a state eligible for resolution
+// Resolved groups never are
+func (r *Reconciler) isActiveGroup(group grafana.AlertGroup) bool {
+	if group.IsResolved() {
+		return false
+	}
+	return r.activeStates[strings.ToLower(group.State)]
+}
+
+// isManagedGroup reports whether the alert group belongs to an integration managed by this tool
+func (r *Reconciler) isManagedGroup(group grafana.AlertGroup) bool {
+	return r.managedIntegrations == nil || r.managedIntegrations[group.IntegrationID]
+}
+
+// isIgnored reports whether the alert carries the configured ignore label
+func (r *Reconciler) isIgnored(alert *models.GettableAlert) bool {
+	if r.ignoreLabelName == "" {
+		return false
+	}
+	value, exists := alert.Labels[r.ignoreLabelName]
+	return exists && value == r.ignoreLabelValue
+}
+
+// inTenant reports whether the alert belongs to the configured tenant
+// Every alert does when no tenant is configured; alerts without the tenant label never do otherwise
+func (r *Reconciler) inTenant(alert *models.GettableAlert) bool {
+	if r.tenantLabel == "" {
+		return true
+	}
+	value, exists := alert.Labels[r.tenantLabel]
+	return exists && value == r.tenantValue
+}
+
+// isProtected reports whether the alert's alertname is protected from automatic resolution
+func (r *Reconciler) isProtected(alert *models.GettableAlert) bool {
+	return r.protectedAlertnames[alert.Labels["alertname"]]
+}
+
+// meetsMinSeverity reports whether the alert's severity label is at least the configured minimum
+func (r *Reconciler) meetsMinSeverity(alert *models.GettableAlert) bool {
+	if r.minSeverity == "" {
+		return true
+	}
+	if alert == nil {
+		return false
+	}
+	rank, known := severityRanks[strings.ToLower(alert.Labels["severity"])]
+	return known && rank >= severityRanks[r.minSeverity]
+}
+
+// blockedGroups returns the IDs of the alert groups that must not be resolved this cycle because one of
+// their inconsistent alerts is protected or below the minimum severity
+// Every such alert is logged and counted, even when its group is already blocked by another one
+func (r *Reconciler) blockedGroups(ctx context.Context, inconsistencies []InconsistentAlert) map[string]bool {
+	blocked := make(map[string]bool)
+	for _, inconsistency := range inconsistencies {
+		// Protected alertnames are never resolved automatically
+		if r.isProtected(inconsistency.Alert) {
+			logging.Printf(ctx, "Skipping resolution of alert group %s: alert %s has protected alertname %s",
+				inconsistency.GrafanaAlertGroupID, inconsistency.Alertname, inconsistency.Alert.Labels["alertname"])
+			r.metrics.RecordProtectedSkipped()
+			blocked[inconsistency.GrafanaAlertGroupID] = true
+			continue
+		}
+
+		// Leave alerts below the minimum severity to humans
+		if !r.meetsMinSeverity(inconsistency.Alert) {
+			logging.Printf(ctx, "Skipping resolution of alert group %s: alert %s has severity %q, below %s",
+				inconsistency.GrafanaAlertGroupID, inconsistency.Alertname, inconsistency.Alert.Labels["severity"], r.minSeverity)
+			r.metrics.RecordResolutionSkipped(skipReasonBelowMinSeverity)
+			blocked[inconsistency.GrafanaAlertGroupID] = true
+		}
+	}
+	return blocked
+}
+
+// labelSetKey builds a normalized representation of a label set (sorted key=value pairs)
+// so that alerts can be matched independently of their fingerprint
+func labelSetKey(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for key, value := range labels {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// findGrafanaGroup returns the ID of the Grafana alert group matching the alert according to the match strategy
+// With the fingerprint strategy, alerts are still matched by labels against Grafana alerts that carry no
+// fingerprint (byLabelsWithoutFingerprint), since those can't be matched any other way
+func (r *Reconciler) findGrafanaGroup(alert *models.GettableAlert, byFingerprint, byLabels, byLabelsWithoutFingerprint map[string]string) (string, bool) {
+	if r.matchStrategy != MatchStrategyLabels && alert.Fingerprint != nil {
+		if groupID, exists := byFingerprint[*alert.Fingerprint]; exists {
+			return groupID, true
+		}
+	}
+	if len(alert.Labels) == 0 {
+		return "", false
+	}
+	labels := byLabels
+	if r.matchStrategy == MatchStrategyFingerprint {
+		labels = byLabelsWithoutFingerprint
+	}
+	if groupID, exists := labels[labelSetKey(alert.Labels)]; exists {
+		return groupID, true
+	}
+	return "", false
+}
+
 // InconsistentAlert represents an alert that exists in Alertmanager but not in Grafana IRM
 type InconsistentAlert struct {
 	Alert               *models.GettableAlert
 	GrafanaAlertGroupID string
-	Reason              string
-	Fingerprint         string
-	Alertname           string
+	// GrafanaIntegrationID and GrafanaRouteID identify where the Grafana IRM alert group was routed
+	GrafanaIntegrationID string
+	GrafanaRouteID       string
+	Reason               string
+	Fingerprint          string
+	Alertname            string
+}
+
+// FirstReconcileDone reports whether at least one reconciliation cycle has completed successfully
+func (r *Reconciler) FirstReconcileDone() bool {
+	return r.firstReconcileDone.Load()
+}
+
+// LastReconcileTime returns the time of the last successful reconciliation (zero if none yet)
+func (r *Reconciler) LastReconcileTime() time.Time {
+	nanos := r.lastSuccess.Load()
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
+// firstSeenKey identifies an inconsistency across cycles by alert and Grafana alert group
+// Alerts without a fingerprint are identified by their label set instead
+func firstSeenKey(inconsistency InconsistentAlert) string {
+	alertKey := inconsistency.Fingerprint
+	if alertKey == "" && inconsistency.Alert != nil {
+		alertKey = labelSetKey(inconsistency.Alert.Labels)
+	}
+	return alertKey + "/" + inconsistency.GrafanaAlertGroupID
+}
+
+// trackFirstSeen records the first detection time of the current inconsistencies
+// and forgets inconsistencies that are no longer present
+func (r *Reconciler) trackFirstSeen(inconsistencies []InconsistentAlert, now time.Time) {
+	r.firstSeenMutex.Lock()
+	defer r.firstSeenMutex.Unlock()
+
+	current := make(map[string]time.Time, len(inconsistencies))
+	for _, inconsistency := range inconsistencies {
+		key := firstSeenKey(inconsistency)
+		if seen, exists := r.firstSeen[key]; exists {
+			current[key] = seen
+		} else {
+			current[key] = now
+		}
+	}
+	r.firstSeen = current
+}
+
+// silencedSince returns when the alert became silenced, using the oldest active silence start time
+// and falling back to the first time the inconsistency was detected
+func (r *Reconciler) silencedSince(ctx context.Context, inconsistency InconsistentAlert) time.Time {
+	var since time.Time
+	if inconsistency.Alert != nil && inconsistency.Alert.Status != nil {
+		for _, silenceID := range inconsistency.Alert.Status.SilencedBy {
+			silence, err := r.amClient.GetSilence(ctx, silenceID)
+			if err != nil || silence == nil || silence.StartsAt == nil {
+				continue
+			}
+			startsAt := time.Time(*silence.StartsAt)
+			if since.IsZero() || startsAt.Before(since) {
+				since = startsAt
+			}
+		}
+	}
+	if !since.IsZero() {
+		return since
+	}
+
+	r.firstSeenMutex.Lock()
+	defer r.firstSeenMutex.Unlock()
+	return r.firstSeen[firstSeenKey(inconsistency)]
 }
 
 // ResolveInconsistency handles the resolution of an inconsistent alert
 // This function should be called for each alert that needs to be resolved in IRM
 func (r *Reconciler) ResolveInconsistency(ctx context.Context, alert InconsistentAlert) error {
-	log.Printf("Resolving inconsistency for alert: %s (fingerprint: %s)",
+	logging.Printf(ctx, "Resolving inconsistency for alert: %s (fingerprint: %s)",
 		alert.Alertname, alert.Fingerprint)
-	log.Printf("Reason: %s", alert.Reason)
+	logging.Printf(ctx, "Reason: %s", describeReason(alert.Reason))
+
+	// Skip the call entirely while Grafana is known to be failing
+	if !r.circuitBreaker.Allow() {
+		return errCircuitOpen
+	}
 
 	// Call Grafana API to resolve the alert
-	err := r.grafanaClient.ResolveAlertGroup(alert.GrafanaAlertGroupID)
+	err := r.grafanaClient.ResolveAlertGroup(ctx, alert.GrafanaAlertGroupID)
+	audit.Record(ctx, audit.Event{
+		Action:       audit.ActionResolveAlertGroup,
+		Actor:        audit.SystemActor,
+		Reason:       alert.Reason,
+		AlertGroupID: alert.GrafanaAlertGroupID,
+		Fingerprint:  alert.Fingerprint,
+		Err:          err,
+	})
 	if err != nil {
+		// Refusals in read-only mode say nothing about Grafana's health
+		if errors.Is(err, grafana.ErrReadOnly) {
+			return err
+		}
+		if r.circuitBreaker.RecordFailure() {
+			logging.Printf(ctx, "Grafana circuit breaker opened after %d consecutive failures, pausing resolutions for %v",
+				r.circuitBreaker.threshold, r.circuitBreaker.cooldown)
+			r.metrics.RecordGrafanaCircuitOpen()
+		}
 		return err
 	}
+	r.circuitBreaker.RecordSuccess()
 
-	log.Printf("Successfully resolved alert %s in Grafana IRM", alert.Alertname)
+	logging.Printf(ctx, "Successfully resolved alert %s in Grafana IRM", alert.Alertname)
+
+	// The alert group is resolved either way, so a failed note is only logged
+	if r.resolveNote != nil {
+		if err := r.addResolutionNote(ctx, alert); err != nil {
+			logging.Printf(ctx, "Failed to add resolution note to alert group %s: %v", alert.GrafanaAlertGroupID, err)
+		}
+	}
 
 	return nil
 }
 
+// reconcileOrphanedSilences finds the unexpired silences created by this tool whose Grafana IRM alert group
+// is resolved or no longer exists, records their number and expires them when enabled
+// Groups missing from the fetched ones are looked up individually, as the list may be partial
+// Failures are only logged so they never fail the reconciliation cycle
+func (r *Reconciler) reconcileOrphanedSilences(ctx context.Context, groups []grafana.AlertGroup) {
+	silences, err := r.amClient.FindSilencesByComment(ctx, alertmanager.ToolSilenceCommentPrefix)
+	if err != nil {
+		logging.Printf(ctx, "Failed to list silences for orphan detection: %v", err)
+		return
+	}
+
+	groupsByID := make(map[string]grafana.AlertGroup, len(groups))
+	for _, group := range groups {
+		groupsByID[group.ID] = group
+	}
+
+	var orphaned []*models.GettableSilence
+	for _, silence := range silences {
+		if silence.ID == nil || silence.Status == nil || silence.Status.State == nil || *silence.Status.State == models.SilenceStatusStateExpired {
+			continue
+		}
+		groupID, ok := alertmanager.ToolSilenceAlertGroupID(*silence.Comment)
+		if !ok {
+			continue
+		}
+
+		group, listed := groupsByID[groupID]
+		if !listed {
+			fetched, err := r.grafanaClient.GetAlertGroup(ctx, groupID)
+			if err != nil && !errors.Is(err, grafana.ErrNotFound) {
+				logging.Printf(ctx, "Failed to look up alert group %s of silence %s: %v", groupID, *silence.ID, err)
+				continue
+			}
+			if err == nil {
+				group, listed = *fetched, true
+			}
+		}
+		if listed && !group.IsResolved() {
+			continue
+		}
+
+		logging.Printf(ctx, "Silence %s is orphaned: alert group %s is resolved or gone", *silence.ID, groupID)
+		orphaned = append(orphaned, silence)
+	}
+
+	r.metrics.RecordOrphanedSilences(len(orphaned))
+
+	if !r.expireOrphanedSilences {
+		return
+	}
+	for _, silence := range orphaned {
+		groupID, _ := alertmanager.ToolSilenceAlertGroupID(*silence.Comment)
+		err := r.amClient.ExpireSilence(ctx, *silence.ID)
+		audit.Record(ctx, audit.Event{
+			Action:       audit.ActionExpireSilence,
+			Actor:        audit.SystemActor,
+			Reason:       "alert group resolved or gone in Grafana IRM",
+			AlertGroupID: groupID,
+			SilenceID:    *silence.ID,
+			Err:          err,
+		})
+		if err != nil {
+			logging.Printf(ctx, "Failed to expire orphaned silence %s: %v", *silence.ID, err)
+		}
+	}
+}
+
+// addResolutionNote renders the resolution note for the alert and adds it to its Grafana IRM alert group
+func (r *Reconciler) addResolutionNote(ctx context.Context, alert InconsistentAlert) error {
+	data := resolveNoteData{
+		Alertname:    alert.Alertname,
+		Fingerprint:  alert.Fingerprint,
+		AlertGroupID: alert.GrafanaAlertGroupID,
+		Reason:       describeReason(alert.Reason),
+	}
+	if alert.Alert != nil && alert.Alert.Status != nil {
+		data.SilenceIDs = strings.Join(alert.Alert.Status.SilencedBy, ", ")
+	}
+
+	var note strings.Builder
+	if err := r.resolveNote.Execute(&note, data); err != nil {
+		return fmt.Errorf("rendering resolution note: %w", err)
+	}
+
+	return r.grafanaClient.CreateResolutionNote(ctx, alert.GrafanaAlertGroupID, note.String())
+}
+
+// inconsistencyScan holds the counters gathered while looking for inconsistencies
+type inconsistencyScan struct {
+	// ignored is the number of silenced alerts skipped because of the ignore label
+	ignored int
+	// truncated is the number of alerts missing from unresolved Grafana alert group payloads
+	truncated int
+}
+
+// findInconsistencies returns the silenced Alertmanager alerts whose Grafana IRM alert group is still firing
+// It has no side effects besides logging, so it is safe to call outside of a reconciliation cycle
+func (r *Reconciler) findInconsistencies(ctx context.Context, alerts []*models.GettableAlert, groups []grafana.AlertGroup) ([]InconsistentAlert, inconsistencyScan) {
+	var scan inconsistencyScan
+
+	// Filter for silenced firing alerts
+	silencedAlerts := make([]*models.GettableAlert, 0)
+	for _, alert := range alerts {
+		if alert != nil && alert.Status != nil && alert.Status.State != nil &&
+			*alert.Status.State == "suppressed" &&
+			len(alert.Status.SilencedBy) > 0 {
+			if !r.inTenant(alert) {
+				continue
+			}
+			if r.isIgnored(alert) {
+				scan.ignored++
+				continue
+			}
+			silencedAlerts = append(silencedAlerts, alert)
+		}
+	}
+
+	logging.Printf(ctx, "Found %d silenced firing alerts", len(silencedAlerts))
+	if scan.ignored > 0 {
+		logging.Printf(ctx, "Skipped %d silenced alerts carrying %s=%s", scan.ignored, r.ignoreLabelName, r.ignoreLabelValue)
+	}
+
+	// Build maps of alert fingerprints and label sets from Grafana IRM for quick lookup
+	// Only groups in an eligible state (GRAFANA_ACTIVE_STATES) are indexed
+	// Only the groups' current state is considered, so a group reopened after being resolved
+	// in an earlier cycle is matched (and resolved) again while its alert stays silenced
+	grafanaFingerprints := make(map[string]string)
+	grafanaLabelSets := make(map[string]string)
+	grafanaLabelSetsWithoutFingerprint := make(map[string]string)
+	groupsByID := make(map[string]grafana.AlertGroup)
+	unmanaged := 0
+	for _, group := range groups {
+		if !r.isManagedGroup(group) {
+			unmanaged++
+			continue
+		}
+		if r.isActiveGroup(group) {
+			groupsByID[group.ID] = group
+			// Truncated alerts are missing from the payload, so matching is incomplete for this group
+			if truncated := group.LastAlert.Payload.TruncatedAlerts; truncated > 0 {
+				logging.Printf(ctx, "Warning: alert group %s has %d truncated alerts, matching may be incomplete", group.ID, truncated)
+				scan.truncated += truncated
+			}
+			for _, alert := range group.LastAlert.Payload.Alerts {
+				if alert.Fingerprint != "" {
+					grafanaFingerprints[alert.Fingerprint] = group.ID
+				}
+				if len(alert.Labels) > 0 {
+					key := labelSetKey(alert.Labels)
+					grafanaLabelSets[key] = group.ID
+					if alert.Fingerprint == "" {
+						grafanaLabelSetsWithoutFingerprint[key] = group.ID
+					}
+				}
+			}
+		}
+	}
+
+	if unmanaged > 0 {
+		logging.Printf(ctx, "Skipped %d alert groups of unmanaged Grafana integrations", unmanaged)
+	}
+
+	// Find inconsistencies
+	var inconsistencies []InconsistentAlert
+	for _, alert := range silencedAlerts {
+		fingerprint := ""
+		if alert.Fingerprint != nil {
+			fingerprint = *alert.Fingerprint
+		}
+		alertname := alert.Labels[r.metrics.PrimaryLabel()]
+
+		if groupID, exists := r.findGrafanaGroup(alert, grafanaFingerprints, grafanaLabelSets, grafanaLabelSetsWithoutFingerprint); exists {
+			group := groupsByID[groupID]
+			inconsistencies = append(inconsistencies, InconsistentAlert{
+				Alert:                alert,
+				Reason:               ReasonSilencedFiring,
+				Fingerprint:          fingerprint,
+				Alertname:            alertname,
+				GrafanaAlertGroupID:  groupID,
+				GrafanaIntegrationID: group.IntegrationID,
+				GrafanaRouteID:       group.RouteID,
+			})
+		}
+	}
+
+	logging.Printf(ctx, "Found %d inconsistent alerts", len(inconsistencies))
+	return inconsistencies, scan
+}
+
+// ReconcileAlerts fetches the current alerts and alert groups and returns the inconsistencies between them
+// It is read-only: nothing is resolved and no reconciliation metrics are recorded
+func (r *Reconciler) ReconcileAlerts(ctx context.Context) ([]InconsistentAlert, error) {
+	alerts, err := r.fetchAlerts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("fetching alertmanager alerts: %w", err)
+	}
+
+	groups, err := r.fetchAlertGroups(ctx)
+	if err != nil && !errors.Is(err, grafana.ErrPartialResults) {
+		return nil, fmt.Errorf("fetching grafana alert groups: %w", err)
+	}
+
+	inconsistencies, _ := r.findInconsistencies(ctx, alerts, groups)
+	return inconsistencies, nil
+}
+
+// ReconcileResult summarizes a reconciliation cycle
+type ReconcileResult struct {
+	AlertsFetched        int     `json:"alerts_fetched"`
+	GroupsFetched        int     `json:"groups_fetched"`
+	InconsistenciesFound int     `json:"inconsistencies_found"`
+	Resolved             int     `json:"resolved"`
+	Failed               int     `json:"failed"`
+	DurationSeconds      float64 `json:"duration_seconds"`
+}
+
 // ReconcileAndResolveOptimized performs a full reconciliation cycle with optimized data fetching
 // It fetches data from Alertmanager and Grafana once, then processes it in parallel goroutines
-func (r *Reconciler) ReconcileAndResolveOptimized(ctx context.Context) error {
+// It returns a summary of the cycle, filled in as far as the cycle got when an error is returned
+// Cycles never overlap: a call made while another cycle runs waits for it to finish, or for ctx to be done
+func (r *Reconciler) ReconcileAndResolveOptimized(ctx context.Context) (*ReconcileResult, error) {
+	select {
+	case r.cycleSlot <- struct{}{}:
+		defer func() { <-r.cycleSlot }()
+	case <-ctx.Done():
+		return &ReconcileResult{}, fmt.Errorf("waiting for the running reconciliation cycle: %w", ctx.Err())
+	}
+
 	// Record reconciliation start and get completion function
 	done := r.metrics.RecordReconciliationStart()
 	defer done()
 
-	log.Println("Starting optimized reconciliation with parallel operations...")
+	start := time.Now()
+	summary := &ReconcileResult{}
+	defer func() { summary.DurationSeconds = time.Since(start).Seconds() }()
+
+	// Tag every log line of this cycle with a correlation ID
+	ctx = logging.EnsureID(ctx)
+
+	logging.Println(ctx, "Starting optimized reconciliation with parallel operations...")
 
 	// Fetch data from both sources once
 	type fetchResult struct {
@@ -74,149 +770,254 @@ func (r *Reconciler) ReconcileAndResolveOptimized(ctx context.Context) error {
 
 	// Fetch Alertmanager alerts in parallel
 	go func() {
-		alerts, err := r.amClient.GetAllAlerts(ctx)
+		defer recoverAsError(ctx, "alertmanager fetch", func(err error) { alertsChan <- fetchResult{err: err} })
+		phaseDone := r.metrics.RecordReconciliationPhase(phaseFetchAlertmanager)
+		defer phaseDone()
+		alerts, err := r.fetchAlerts(ctx)
 		alertsChan <- fetchResult{alerts: alerts, err: err}
 	}()
 
 	// Fetch Grafana alert groups in parallel
 	go func() {
-		groups, err := r.grafanaClient.GetAllAlertGroups()
+		defer recoverAsError(ctx, "grafana fetch", func(err error) { grafanaChan <- fetchResult{err: err} })
+		phaseDone := r.metrics.RecordReconciliationPhase(phaseFetchGrafana)
+		defer phaseDone()
+		groups, err := r.fetchAlertGroups(ctx)
+		// Missing pages only hide inconsistencies, so the cycle goes on with the groups that were fetched
+		if errors.Is(err, grafana.ErrPartialResults) {
+			logging.Printf(ctx, "Reconciling with partial Grafana data (%d alert groups): %v", len(groups), err)
+			err = nil
+		}
 		grafanaChan <- fetchResult{grafanaAlertGroups: groups, err: err}
 	}()
 
-	// Wait for both fetches to complete
-	alertsResult := <-alertsChan
-	grafanaResult := <-grafanaChan
+	// Wait for both fetches to complete, giving up if the context is cancelled
+	alertsResult, err := awaitResult(ctx, alertsChan)
+	if err != nil {
+		r.metrics.RecordReconciliationFailure()
+		return summary, fmt.Errorf("waiting for alertmanager fetch: %w", err)
+	}
+	grafanaResult, err := awaitResult(ctx, grafanaChan)
+	if err != nil {
+		r.metrics.RecordReconciliationFailure()
+		return summary, fmt.Errorf("waiting for grafana fetch: %w", err)
+	}
 
 	if alertsResult.err != nil {
 		r.metrics.RecordReconciliationFailure()
-		return alertsResult.err
+		return summary, alertsResult.err
 	}
 	if grafanaResult.err != nil {
 		r.metrics.RecordReconciliationFailure()
-		return grafanaResult.err
+		return summary, grafanaResult.err
 	}
 
-	log.Printf("Fetched %d alerts from Alertmanager", len(alertsResult.alerts))
-	log.Printf("Fetched %d alert groups from Grafana", len(grafanaResult.grafanaAlertGroups))
+	summary.AlertsFetched = len(alertsResult.alerts)
+	summary.GroupsFetched = len(grafanaResult.grafanaAlertGroups)
+	logging.Printf(ctx, "Fetched %d alerts from Alertmanager", len(alertsResult.alerts))
+	logging.Printf(ctx, "Fetched %d alert groups from Grafana", len(grafanaResult.grafanaAlertGroups))
+	r.metrics.RecordGrafanaGroupSizes(grafanaResult.grafanaAlertGroups)
 
 	// Now perform two operations in parallel using the same data
 	type operationResult struct {
-		name  string
-		err   error
-		stats map[string]int
+		name    string
+		err     error
+		stats   map[string]int
+		reasons map[string]int
 	}
 
 	resultsChan := make(chan operationResult, 2)
 
-	// Goroutine 1: Export metrics with Grafana data
-	go func() {
-		log.Println("Starting metrics export with Grafana data...")
-		err := r.metrics.ExportAlertsWithGrafana(ctx, alertsResult.alerts, grafanaResult.grafanaAlertGroups, r.grafanaClient, r.amClient)
-		if err != nil {
-			log.Printf("Metrics export failed: %v", err)
-			r.metrics.RecordAlertExportFailure()
-		} else {
-			log.Println("Metrics export completed successfully")
-		}
-		resultsChan <- operationResult{name: "metrics_export", err: err}
-	}()
+	// Goroutine 1: Export metrics with Grafana data (skipped in resolve mode)
+	operations := 0
+	if r.mode != ModeResolve {
+		operations++
+		go func() {
+			defer recoverAsError(ctx, "metrics export", func(err error) {
+				resultsChan <- operationResult{name: "metrics_export", err: err}
+			})
+			phaseDone := r.metrics.RecordReconciliationPhase(phaseExportMetrics)
+			defer phaseDone()
+			logging.Println(ctx, "Starting metrics export with Grafana data...")
+			err := r.metrics.ExportAlertsWithGrafana(ctx, alertsResult.alerts, grafanaResult.grafanaAlertGroups, r.grafanaClient, r.amClient)
+			if err != nil {
+				logging.Printf(ctx, "Metrics export failed: %v", err)
+				r.metrics.RecordAlertExportFailure()
+			} else {
+				logging.Println(ctx, "Metrics export completed successfully")
+			}
+			resultsChan <- operationResult{name: "metrics_export", err: err}
+		}()
+	} else {
+		logging.Println(ctx, "Skipping metrics export in resolve mode")
+	}
 
-	// Goroutine 2: Reconcile and resolve inconsistencies
-	go func() {
-		log.Println("Starting silence reconciliation...")
-		
-		// Filter for silenced firing alerts
-		silencedAlerts := make([]*models.GettableAlert, 0)
-		for _, alert := range alertsResult.alerts {
-			if alert.Status != nil &&
-				*alert.Status.State == "suppressed" &&
-				len(alert.Status.SilencedBy) > 0 {
-				silencedAlerts = append(silencedAlerts, alert)
+	// Goroutine 2: Reconcile and resolve inconsistencies (skipped in export_only mode)
+	if r.mode != ModeExportOnly {
+		operations++
+		go func() {
+			defer recoverAsError(ctx, "silence reconciliation", func(err error) {
+				resultsChan <- operationResult{name: "silence_reconciliation", err: err}
+			})
+			phaseDone := r.metrics.RecordReconciliationPhase(phaseResolve)
+			defer phaseDone()
+			logging.Println(ctx, "Starting silence reconciliation...")
+
+			inconsistencies, scan := r.findInconsistencies(ctx, alertsResult.alerts, grafanaResult.grafanaAlertGroups)
+			if scan.ignored > 0 {
+				r.metrics.RecordReconcileIgnored(scan.ignored)
+			}
+			if scan.truncated > 0 {
+				r.metrics.RecordTruncatedAlerts(scan.truncated)
 			}
-		}
 
-		log.Printf("Found %d silenced firing alerts", len(silencedAlerts))
+			reasons := make(map[string]int)
+			for _, inconsistency := range inconsistencies {
+				reasons[inconsistency.Reason]++
+			}
+
+			now := time.Now()
+			r.trackFirstSeen(inconsistencies, now)
+
+			// Resolving acts on the whole alert group, so a single protected or low-severity member holds it back
+			blocked := r.blockedGroups(ctx, inconsistencies)
+
+			// Resolve inconsistencies, calling Grafana at most once per alert group
+			resolvedCount := 0
+			failedCount := 0
+			attemptedGroups := make(map[string]bool)
+			for i, inconsistency := range inconsistencies {
+				if attemptedGroups[inconsistency.GrafanaAlertGroupID] {
+					logging.Printf(ctx, "Alert group %s already handled this cycle, skipping alert %s",
+						inconsistency.GrafanaAlertGroupID, inconsistency.Alertname)
+					continue
+				}
+				if blocked[inconsistency.GrafanaAlertGroupID] {
+					continue
+				}
 
-		// Build a map of alert fingerprints from Grafana IRM for quick lookup
-		grafanaFingerprints := make(map[string]string)
-		for _, group := range grafanaResult.grafanaAlertGroups {
-			if group.State != "resolved" {
-				for _, alert := range group.LastAlert.Payload.Alerts {
-					if alert.Fingerprint != "" {
-						grafanaFingerprints[alert.Fingerprint] = group.ID
+				// Leave recently silenced alerts alone to avoid flapping on brief silences
+				if r.resolveGracePeriod > 0 {
+					if silencedFor := now.Sub(r.silencedSince(ctx, inconsistency)); silencedFor < r.resolveGracePeriod {
+						logging.Printf(ctx, "Skipping resolution of alert %s: silenced for %v, grace period is %v",
+							inconsistency.Alertname, silencedFor.Round(time.Second), r.resolveGracePeriod)
+						continue
 					}
 				}
-			}
-		}
 
-		// Find inconsistencies
-		var inconsistencies []InconsistentAlert
-		for _, alert := range silencedAlerts {
-			fingerprint := alert.Fingerprint
-			alertname := alert.Labels["alertname"]
-
-			if _, exists := grafanaFingerprints[*fingerprint]; exists {
-				inconsistencies = append(inconsistencies, InconsistentAlert{
-					Alert:               alert,
-					Reason:              "Alert is silenced in Alertmanager but still firing in Grafana IRM",
-					Fingerprint:         *fingerprint,
-					Alertname:           alertname,
-					GrafanaAlertGroupID: grafanaFingerprints[*fingerprint],
-				})
+				attemptedGroups[inconsistency.GrafanaAlertGroupID] = true
+				if err := r.ResolveInconsistency(ctx, inconsistency); err != nil {
+					if errors.Is(err, errCircuitOpen) {
+						logging.Printf(ctx, "Grafana circuit breaker is open, skipping %d remaining resolutions", len(inconsistencies)-i)
+						break
+					}
+					if errors.Is(err, grafana.ErrReadOnly) {
+						r.metrics.RecordResolutionSkipped(skipReasonReadOnly)
+						continue
+					}
+					logging.Printf(ctx, "Failed to resolve inconsistency for alert %s: %v",
+						inconsistency.Alertname, err)
+					r.metrics.RecordInconsistencyFailedResolve()
+					failedCount++
+				} else {
+					r.metrics.RecordInconsistencyResolved()
+					resolvedCount++
+				}
 			}
-		}
 
-		log.Printf("Found %d inconsistent alerts", len(inconsistencies))
+			r.reconcileOrphanedSilences(ctx, grafanaResult.grafanaAlertGroups)
 
-		// Resolve inconsistencies
-		resolvedCount := 0
-		for _, inconsistency := range inconsistencies {
-			if err := r.ResolveInconsistency(ctx, inconsistency); err != nil {
-				log.Printf("Failed to resolve inconsistency for alert %s: %v",
-					inconsistency.Alertname, err)
-				r.metrics.RecordInconsistencyFailedResolve()
-			} else {
-				r.metrics.RecordInconsistencyResolved()
-				resolvedCount++
+			stats := map[string]int{
+				"inconsistencies": len(inconsistencies),
+				"resolved":        resolvedCount,
+				"failed":          failedCount,
 			}
-		}
 
-		stats := map[string]int{
-			"inconsistencies": len(inconsistencies),
-			"resolved":        resolvedCount,
-		}
-
-		resultsChan <- operationResult{name: "silence_reconciliation", stats: stats}
-	}()
+			resultsChan <- operationResult{name: "silence_reconciliation", stats: stats, reasons: reasons}
+		}()
+	} else {
+		logging.Println(ctx, "Skipping silence reconciliation in export_only mode")
+	}
 
-	// Wait for both operations to complete
+	// Wait for the started operations to complete, giving up if the context is cancelled
 	var metricsErr error
+	var reconcileErr error
 	var reconcileStats map[string]int
+	var reconcileReasons map[string]int
 
-	for i := 0; i < 2; i++ {
-		result := <-resultsChan
+	for i := 0; i < operations; i++ {
+		result, err := awaitResult(ctx, resultsChan)
+		if err != nil {
+			r.metrics.RecordReconciliationFailure()
+			return summary, fmt.Errorf("waiting for reconciliation operations: %w", err)
+		}
 		if result.name == "metrics_export" {
 			metricsErr = result.err
 		} else if result.name == "silence_reconciliation" {
+			reconcileErr = result.err
 			reconcileStats = result.stats
+			reconcileReasons = result.reasons
 		}
 	}
 
+	summary.InconsistenciesFound = reconcileStats["inconsistencies"]
+	summary.Resolved = reconcileStats["resolved"]
+	summary.Failed = reconcileStats["failed"]
+
+	// Sample cache sizes now that both operations have populated them
+	r.metrics.RecordCacheSizes(r.amClient.SilenceCacheSize(), r.grafanaClient.UserCacheSize())
+
 	// Record reconciliation success
-	if metricsErr == nil && reconcileStats != nil {
-		r.metrics.RecordReconciliationSuccess(
-			reconcileStats["inconsistencies"],
-			reconcileStats["resolved"],
-		)
-		log.Println("Optimized reconciliation completed successfully")
-		return nil
+	// No inconsistencies are computed in export_only mode, so their metrics are left untouched
+	if metricsErr == nil && reconcileErr == nil {
+		if r.mode == ModeExportOnly {
+			r.metrics.RecordExportOnlySuccess()
+		} else {
+			r.metrics.RecordReconciliationSuccess(reconcileStats["inconsistencies"])
+			r.metrics.RecordInconsistenciesByReason(reconcileReasons)
+		}
+		r.lastSuccess.Store(time.Now().UnixNano())
+		r.firstReconcileDone.Store(true)
+		logging.Println(ctx, "Optimized reconciliation completed successfully")
+		return summary, nil
 	}
 
 	if metricsErr != nil {
 		r.metrics.RecordReconciliationFailure()
-		return metricsErr
+		return summary, metricsErr
 	}
 
-	return nil
+	if reconcileErr != nil {
+		r.metrics.RecordReconciliationFailure()
+		return summary, reconcileErr
+	}
+
+	return summary, nil
+}
+
+// ReconcileAndResolve runs ReconcileAndResolveOptimized, discarding the cycle summary
+// It suits callers such as the reconciliation loop that only need to know whether the cycle failed
+func (r *Reconciler) ReconcileAndResolve(ctx context.Context) error {
+	_, err := r.ReconcileAndResolveOptimized(ctx)
+	return err
+}
+
+// awaitResult waits for a result on the channel, returning the context error if it is cancelled first
+func awaitResult[T any](ctx context.Context, ch <-chan T) (T, error) {
+	select {
+	case result := <-ch:
+		return result, nil
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// recoverAsError recovers from a panic in a reconciliation goroutine and reports it as an error
+// It must be deferred; report is only called when a panic occurred
+func recoverAsError(ctx context.Context, operation string, report func(error)) {
+	if rec := recover(); rec != nil {
+		logging.Printf(ctx, "Recovered from panic in %s: %v", operation, rec)
+		report(fmt.Errorf("panic in %s: %v", operation, rec))
+	}
 }
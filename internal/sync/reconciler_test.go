@@ -0,0 +1,931 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/alertmanager"
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/audit"
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/config"
+	"github.com/gabrielpetry/alertmanager-alert-sync/internal/grafana"
+	"github.com/prometheus/alertmanager/api/v2/models"
+)
+
+func TestReconcileTimeout(t *testing.T) {
+	// Alertmanager hangs until the request is cancelled
+	amClient := newAlertmanagerStub(t, func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	grafanaClient := newGrafanaStub(t, jsonResponse(map[string]any{"results": []any{}}))
+	r := NewReconciler(amClient, grafanaClient, testExporter(), config.ReconcileConfig{}, config.TenantConfig{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	errChan := make(chan error, 1)
+	go func() {
+		_, err := r.ReconcileAndResolveOptimized(ctx)
+		errChan <- err
+	}()
+
+	select {
+	case err := <-errChan:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("ReconcileAndResolveOptimized() error = %v, want a context deadline error", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ReconcileAndResolveOptimized() did not return after the timeout")
+	}
+	if r.FirstReconcileDone() {
+		t.Error("FirstReconcileDone() = true after a timed out cycle")
+	}
+}
+
+func TestReconcileResult(t *testing.T) {
+	amClient := newAlertmanagerStub(t, alertmanagerAPI([]fakeAlert{
+		{fingerprint: "fp1", labels: map[string]string{"alertname": "DiskFull"}, silencedBy: []string{"s1"}},
+		{fingerprint: "fp2", labels: map[string]string{"alertname": "HighLatency"}, silencedBy: []string{"s2"}},
+		{fingerprint: "fp3", labels: map[string]string{"alertname": "Watchdog"}},
+	}))
+	fake := &fakeGrafana{
+		groups:      []grafana.AlertGroup{alertGroup("IG1", "new", "fp1"), alertGroup("IG2", "new", "fp2"), alertGroup("IG3", "new", "fp3")},
+		failResolve: map[string]bool{"IG2": true},
+	}
+	r := NewReconciler(amClient, newGrafanaStub(t, fake.ServeHTTP), testExporter(), config.ReconcileConfig{}, config.TenantConfig{})
+
+	result, err := r.ReconcileAndResolveOptimized(context.Background())
+	if err != nil {
+		t.Fatalf("ReconcileAndResolveOptimized() error = %v", err)
+	}
+
+	want := ReconcileResult{AlertsFetched: 3, GroupsFetched: 3, InconsistenciesFound: 2, Resolved: 1, Failed: 1}
+	got := *result
+	if got.DurationSeconds <= 0 {
+		t.Errorf("DurationSeconds = %v, want the cycle duration", got.DurationSeconds)
+	}
+	got.DurationSeconds = 0
+	if got != want {
+		t.Errorf("ReconcileAndResolveOptimized() result = %+v, want %+v", got, want)
+	}
+}
+
+func TestReconcileWaitsForRunningCycle(t *testing.T) {
+	r := NewReconciler(nil, nil, testExporter(), config.ReconcileConfig{}, config.TenantConfig{})
+
+	// Pretend a cycle is running
+	r.cycleSlot <- struct{}{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	result, err := r.ReconcileAndResolveOptimized(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("ReconcileAndResolveOptimized() error = %v, want a deadline exceeded error", err)
+	}
+	if result == nil {
+		t.Fatal("ReconcileAndResolveOptimized() returned a nil summary")
+	}
+	if len(r.cycleSlot) != 1 {
+		t.Error("a cycle that never started released the running cycle's slot")
+	}
+}
+
+func TestFindGrafanaGroup(t *testing.T) {
+	byFingerprint := map[string]string{"fp-grafana": "IG1"}
+	byLabelsWithoutFingerprint := map[string]string{labelSetKey(map[string]string{"alertname": "NodeDown", "instance": "db1"}): "IG3"}
+	byLabels := map[string]string{labelSetKey(map[string]string{"alertname": "DiskFull", "instance": "db1"}): "IG2"}
+	maps.Copy(byLabels, byLabelsWithoutFingerprint)
+
+	tests := []struct {
+		name        string
+		strategy    string
+		fingerprint string
+		labels      map[string]string
+		wantGroup   string
+	}{
+		{name: "fingerprint match", strategy: MatchStrategyFingerprint, fingerprint: "fp-grafana", wantGroup: "IG1"},
+		{name: "fingerprint strategy ignores labels", strategy: MatchStrategyFingerprint, fingerprint: "fp-am", labels: map[string]string{"alertname": "DiskFull", "instance": "db1"}},
+		{name: "labels match despite a different fingerprint", strategy: MatchStrategyLabels, fingerprint: "fp-am", labels: map[string]string{"instance": "db1", "alertname": "DiskFull"}, wantGroup: "IG2"},
+		{name: "labels strategy ignores fingerprints", strategy: MatchStrategyLabels, fingerprint: "fp-grafana", labels: map[string]string{"alertname": "Other"}},
+		{name: "both falls back to labels", strategy: MatchStrategyBoth, fingerprint: "fp-am", labels: map[string]string{"alertname": "DiskFull", "instance": "db1"}, wantGroup: "IG2"},
+		{name: "both prefers the fingerprint", strategy: MatchStrategyBoth, fingerprint: "fp-grafana", labels: map[string]string{"alertname": "DiskFull", "instance": "db1"}, wantGroup: "IG1"},
+		{name: "fingerprint strategy falls back to fingerprint-less alerts", strategy: MatchStrategyFingerprint, fingerprint: "fp-am", labels: map[string]string{"alertname": "NodeDown", "instance": "db1"}, wantGroup: "IG3"},
+		{name: "labels must be identical", strategy: MatchStrategyBoth, fingerprint: "fp-am", labels: map[string]string{"alertname": "DiskFull", "instance": "db2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Reconciler{matchStrategy: tt.strategy}
+			alert := &models.GettableAlert{Alert: models.Alert{Labels: tt.labels}, Fingerprint: &tt.fingerprint}
+
+			groupID, found := r.findGrafanaGroup(alert, byFingerprint, byLabels, byLabelsWithoutFingerprint)
+			if found != (tt.wantGroup != "") || groupID != tt.wantGroup {
+				t.Errorf("findGrafanaGroup() = %q, %v, want %q", groupID, found, tt.wantGroup)
+			}
+		})
+	}
+}
+
+func TestReconcileFingerprintlessGrafanaAlerts(t *testing.T) {
+	amClient := newAlertmanagerStub(t, alertmanagerAPI([]fakeAlert{
+		{fingerprint: "fp1", labels: map[string]string{"alertname": "DiskFull", "instance": "db1"}, silencedBy: []string{"s1"}},
+		{fingerprint: "fp2", labels: map[string]string{"alertname": "DiskFull", "instance": "db2"}, silencedBy: []string{"s2"}},
+	}))
+	fingerprintless := alertGroup("IG1", "new")
+	fingerprintless.LastAlert.Payload.Alerts = []grafana.Alert{{Labels: grafana.Labels{"instance": "db1", "alertname": "DiskFull"}}}
+	fake := &fakeGrafana{groups: []grafana.AlertGroup{fingerprintless, alertGroup("IG2", "new", "fp-other")}}
+	r := NewReconciler(amClient, newGrafanaStub(t, fake.ServeHTTP), testExporter(), config.ReconcileConfig{MatchStrategy: MatchStrategyFingerprint}, config.TenantConfig{})
+
+	if _, err := r.ReconcileAndResolveOptimized(context.Background()); err != nil {
+		t.Fatalf("ReconcileAndResolveOptimized() error = %v", err)
+	}
+	if got, want := fake.resolvedGroups(), []string{"IG1"}; !slices.Equal(got, want) {
+		t.Errorf("resolved alert groups = %v, want %v", got, want)
+	}
+}
+
+func TestReconcileIgnoreLabel(t *testing.T) {
+	amClient := newAlertmanagerStub(t, alertmanagerAPI([]fakeAlert{
+		{fingerprint: "fp1", labels: map[string]string{"alertname": "DiskFull"}, silencedBy: []string{"s1"}},
+		{fingerprint: "fp2", labels: map[string]string{"alertname": "HighLatency", "sync_ignore": "true"}, silencedBy: []string{"s2"}},
+		{fingerprint: "fp3", labels: map[string]string{"alertname": "HighLatency", "sync_ignore": "false"}, silencedBy: []string{"s2"}},
+	}))
+	fake := &fakeGrafana{groups: []grafana.AlertGroup{
+		alertGroup("IG1", "new", "fp1"),
+		alertGroup("IG2", "new", "fp2"),
+		alertGroup("IG3", "new", "fp3"),
+	}}
+	r := NewReconciler(amClient, newGrafanaStub(t, fake.ServeHTTP), testExporter(), config.ReconcileConfig{IgnoreLabel: "sync_ignore=true"}, config.TenantConfig{})
+
+	ignored := metricValue(t, "alertmanager_sync_reconcile_ignored_total")
+	if _, err := r.ReconcileAndResolveOptimized(context.Background()); err != nil {
+		t.Fatalf("ReconcileAndResolveOptimized() error = %v", err)
+	}
+
+	if got, want := fake.resolvedGroups(), []string{"IG1", "IG3"}; !slices.Equal(got, want) {
+		t.Errorf("resolved alert groups = %v, want %v", got, want)
+	}
+	if got := metricValue(t, "alertmanager_sync_reconcile_ignored_total") - ignored; got != 1 {
+		t.Errorf("alertmanager_sync_reconcile_ignored_total increased by %v, want 1", got)
+	}
+}
+
+func TestReconcileTenant(t *testing.T) {
+	amClient := newAlertmanagerStub(t, alertmanagerAPI([]fakeAlert{
+		{fingerprint: "fp1", labels: map[string]string{"alertname": "DiskFull", "tenant": "payments"}, silencedBy: []string{"s1"}},
+		{fingerprint: "fp2", labels: map[string]string{"alertname": "DiskFull", "tenant": "search"}, silencedBy: []string{"s2"}},
+		{fingerprint: "fp3", labels: map[string]string{"alertname": "DiskFull"}, silencedBy: []string{"s3"}},
+	}))
+
+	tests := []struct {
+		name         string
+		tenant       config.TenantConfig
+		wantResolved []string
+	}{
+		{name: "no tenant", wantResolved: []string{"IG1", "IG2", "IG3"}},
+		{name: "matching tenant", tenant: config.TenantConfig{Label: "tenant", Value: "payments"}, wantResolved: []string{"IG1"}},
+		{name: "no alert of the tenant", tenant: config.TenantConfig{Label: "tenant", Value: "billing"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeGrafana{groups: []grafana.AlertGroup{
+				alertGroup("IG1", "new", "fp1"),
+				alertGroup("IG2", "new", "fp2"),
+				alertGroup("IG3", "new", "fp3"),
+			}}
+			r := NewReconciler(amClient, newGrafanaStub(t, fake.ServeHTTP), testExporter(), config.ReconcileConfig{}, tt.tenant)
+
+			if _, err := r.ReconcileAndResolveOptimized(context.Background()); err != nil {
+				t.Fatalf("ReconcileAndResolveOptimized() error = %v", err)
+			}
+
+			if got := fake.resolvedGroups(); !slices.Equal(got, tt.wantResolved) {
+				t.Errorf("resolved alert groups = %v, want %v", got, tt.wantResolved)
+			}
+		})
+	}
+}
+
+func silencedAlert(fingerprint string, labels map[string]string) *models.GettableAlert {
+	state := "suppressed"
+	return &models.GettableAlert{
+		Alert:       models.Alert{Labels: models.LabelSet(labels)},
+		Fingerprint: &fingerprint,
+		Status:      &models.AlertStatus{State: &state, SilencedBy: []string{"silence-" + fingerprint}},
+	}
+}
+
+func TestBlockedGroups(t *testing.T) {
+	tests := []struct {
+		name            string
+		protected       []string
+		minSeverity     string
+		inconsistencies []InconsistentAlert
+		want            map[string]bool
+		// wantProtected is how many alerts are counted as skipped for being protected
+		wantProtected float64
+	}{
+		{
+			name:      "protected alert blocks its whole group",
+			protected: []string{"Watchdog"},
+			inconsistencies: []InconsistentAlert{
+				{Alert: silencedAlert("a1", map[string]string{"alertname": "DiskFull"}), GrafanaAlertGroupID: "IG1"},
+				{Alert: silencedAlert("a2", map[string]string{"alertname": "Watchdog"}), GrafanaAlertGroupID: "IG1"},
+				{Alert: silencedAlert("a3", map[string]string{"alertname": "DiskFull"}), GrafanaAlertGroupID: "IG2"},
+			},
+			want:          map[string]bool{"IG1": true},
+			wantProtected: 1,
+		},
+		{
+			name:        "alert below the minimum severity blocks its whole group",
+			minSeverity: "critical",
+			inconsistencies: []InconsistentAlert{
+				{Alert: silencedAlert("a1", map[string]string{"alertname": "DiskFull", "severity": "critical"}), GrafanaAlertGroupID: "IG1"},
+				{Alert: silencedAlert("a2", map[string]string{"alertname": "DiskFull", "severity": "warning"}), GrafanaAlertGroupID: "IG1"},
+				{Alert: silencedAlert("a3", map[string]string{"alertname": "DiskFull", "severity": "critical"}), GrafanaAlertGroupID: "IG2"},
+			},
+			want: map[string]bool{"IG1": true},
+		},
+		{
+			name:      "nothing blocked",
+			protected: []string{"Watchdog"},
+			inconsistencies: []InconsistentAlert{
+				{Alert: silencedAlert("a1", map[string]string{"alertname": "DiskFull"}), GrafanaAlertGroupID: "IG1"},
+				{Alert: silencedAlert("a2", map[string]string{"alertname": "HighLatency"}), GrafanaAlertGroupID: "IG1"},
+			},
+			want: map[string]bool{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewReconciler(nil, nil, testExporter(), config.ReconcileConfig{
+				ProtectedAlertnames: tt.protected,
+				ResolveMinSeverity:  tt.minSeverity,
+			}, config.TenantConfig{})
+
+			before := metricValue(t, "alertmanager_sync_protected_skipped_total")
+			got := r.blockedGroups(context.Background(), tt.inconsistencies)
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("blockedGroups() = %v, want %v", got, tt.want)
+			}
+			if skipped := metricValue(t, "alertmanager_sync_protected_skipped_total") - before; skipped != tt.wantProtected {
+				t.Errorf("protected_skipped_total increased by %v, want %v", skipped, tt.wantProtected)
+			}
+		})
+	}
+}
+
+func TestReconcileProtectedAlertnames(t *testing.T) {
+	amClient := newAlertmanagerStub(t, alertmanagerAPI([]fakeAlert{
+		{fingerprint: "fp1", labels: map[string]string{"alertname": "DiskFull"}, silencedBy: []string{"s1"}},
+		{fingerprint: "fp2", labels: map[string]string{"alertname": "Watchdog"}, silencedBy: []string{"s2"}},
+		{fingerprint: "fp3", labels: map[string]string{"alertname": "DiskFull", "instance": "db2"}, silencedBy: []string{"s3"}},
+	}))
+	fake := &fakeGrafana{groups: []grafana.AlertGroup{
+		alertGroup("IG1", "new", "fp1"),
+		alertGroup("IG2", "new", "fp2"),
+		alertGroup("IG3", "new", "fp3", "fp2"),
+	}}
+	r := NewReconciler(amClient, newGrafanaStub(t, fake.ServeHTTP), testExporter(),
+		config.ReconcileConfig{ProtectedAlertnames: []string{"Watchdog"}}, config.TenantConfig{})
+
+	skipped := metricValue(t, "alertmanager_sync_protected_skipped_total")
+	if _, err := r.ReconcileAndResolveOptimized(context.Background()); err != nil {
+		t.Fatalf("ReconcileAndResolveOptimized() error = %v", err)
+	}
+
+	if got, want := fake.resolvedGroups(), []string{"IG1"}; !slices.Equal(got, want) {
+		t.Errorf("resolved alert groups = %v, want %v", got, want)
+	}
+	if got := metricValue(t, "alertmanager_sync_protected_skipped_total") - skipped; got < 1 {
+		t.Errorf("alertmanager_sync_protected_skipped_total increased by %v, want the protected alert counted", got)
+	}
+}
+
+func TestReconcileResolvesReopenedGroups(t *testing.T) {
+	amClient := newAlertmanagerStub(t, alertmanagerAPI([]fakeAlert{
+		{fingerprint: "fp1", labels: map[string]string{"alertname": "DiskFull"}, silencedBy: []string{"s1"}},
+	}))
+	fake := &fakeGrafana{groups: []grafana.AlertGroup{alertGroup("IG1", "new", "fp1")}}
+	r := NewReconciler(amClient, newGrafanaStub(t, fake.ServeHTTP), testExporter(), config.ReconcileConfig{}, config.TenantConfig{})
+
+	// The group is resolved, stays resolved for a cycle, then IRM reopens it while the silence is still active
+	reopened := alertGroup("IG1", "new", "fp1")
+	reopened.ResolvedAt = grafana.NullableTime{Time: time.Now().Add(-time.Minute), Valid: true}
+	cycles := []struct {
+		state        grafana.AlertGroup
+		wantResolved []string
+	}{
+		{state: alertGroup("IG1", "new", "fp1"), wantResolved: []string{"IG1"}},
+		{state: alertGroup("IG1", "resolved", "fp1"), wantResolved: []string{"IG1"}},
+		{state: reopened, wantResolved: []string{"IG1", "IG1"}},
+	}
+
+	for i, cycle := range cycles {
+		fake.groups = []grafana.AlertGroup{cycle.state}
+		if _, err := r.ReconcileAndResolveOptimized(context.Background()); err != nil {
+			t.Fatalf("cycle %d: ReconcileAndResolveOptimized() error = %v", i+1, err)
+		}
+		if got := fake.resolvedGroups(); !slices.Equal(got, cycle.wantResolved) {
+			t.Errorf("cycle %d: resolved alert groups = %v, want %v", i+1, got, cycle.wantResolved)
+		}
+	}
+}
+
+func TestReconcileResolveMinSeverity(t *testing.T) {
+	amClient := newAlertmanagerStub(t, alertmanagerAPI([]fakeAlert{
+		{fingerprint: "fp1", labels: map[string]string{"alertname": "DiskFull", "severity": "critical"}, silencedBy: []string{"s1"}},
+		{fingerprint: "fp2", labels: map[string]string{"alertname": "HighLatency", "severity": "warning"}, silencedBy: []string{"s2"}},
+		{fingerprint: "fp3", labels: map[string]string{"alertname": "Watchdog"}, silencedBy: []string{"s3"}},
+		{fingerprint: "fp4", labels: map[string]string{"alertname": "NodeDown", "severity": "CRITICAL"}, silencedBy: []string{"s4"}},
+	}))
+	fake := &fakeGrafana{groups: []grafana.AlertGroup{
+		alertGroup("IG1", "new", "fp1"),
+		alertGroup("IG2", "new", "fp2"),
+		alertGroup("IG3", "new", "fp3"),
+		alertGroup("IG4", "new", "fp4"),
+	}}
+	r := NewReconciler(amClient, newGrafanaStub(t, fake.ServeHTTP), testExporter(), config.ReconcileConfig{ResolveMinSeverity: "critical"}, config.TenantConfig{})
+
+	skipped := metricValue(t, "alertmanager_sync_resolutions_skipped_total")
+	if _, err := r.ReconcileAndResolveOptimized(context.Background()); err != nil {
+		t.Fatalf("ReconcileAndResolveOptimized() error = %v", err)
+	}
+
+	if got, want := fake.resolvedGroups(), []string{"IG1", "IG4"}; !slices.Equal(got, want) {
+		t.Errorf("resolved alert groups = %v, want %v", got, want)
+	}
+	if got := metricValue(t, "alertmanager_sync_resolutions_skipped_total") - skipped; got != 2 {
+		t.Errorf("alertmanager_sync_resolutions_skipped_total increased by %v, want 2", got)
+	}
+}
+
+func TestReconcileResolutionNotes(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.ReconcileConfig
+		want []grafana.ResolutionNote
+	}{
+		{name: "disabled", cfg: config.ReconcileConfig{}},
+		{
+			name: "custom template",
+			cfg:  config.ReconcileConfig{ResolveAddNote: true, ResolveNoteTemplate: "{{.Alertname}} in {{.AlertGroupID}} silenced by {{.SilenceIDs}}"},
+			want: []grafana.ResolutionNote{{AlertGroupID: "IG1", Text: "DiskFull in IG1 silenced by s1, s2"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			amClient := newAlertmanagerStub(t, alertmanagerAPI([]fakeAlert{
+				{fingerprint: "fp1", labels: map[string]string{"alertname": "DiskFull"}, silencedBy: []string{"s1", "s2"}},
+				{fingerprint: "fp2", labels: map[string]string{"alertname": "Watchdog"}},
+			}))
+			fake := &fakeGrafana{groups: []grafana.AlertGroup{
+				alertGroup("IG1", "new", "fp1"),
+				alertGroup("IG2", "new", "fp2"),
+			}}
+			r := NewReconciler(amClient, newGrafanaStub(t, fake.ServeHTTP), testExporter(), tt.cfg, config.TenantConfig{})
+
+			if _, err := r.ReconcileAndResolveOptimized(context.Background()); err != nil {
+				t.Fatalf("ReconcileAndResolveOptimized() error = %v", err)
+			}
+
+			if got, want := fake.resolvedGroups(), []string{"IG1"}; !slices.Equal(got, want) {
+				t.Errorf("resolved alert groups = %v, want %v", got, want)
+			}
+			if got := fake.resolutionNotes(); !slices.Equal(got, tt.want) {
+				t.Errorf("resolution notes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsActiveGroup(t *testing.T) {
+	tests := []struct {
+		name   string
+		states []string
+		want   map[string]bool
+	}{
+		{
+			name:   "default is firing only",
+			states: nil,
+			want:   map[string]bool{"new": true, "acknowledged": false, "silenced": false, "resolved": false},
+		},
+		{
+			name:   "firing alias",
+			states: []string{"firing"},
+			want:   map[string]bool{"new": true, "acknowledged": false, "silenced": false, "resolved": false},
+		},
+		{
+			name:   "firing and acknowledged",
+			states: []string{"Firing", "ACKNOWLEDGED"},
+			want:   map[string]bool{"new": true, "acknowledged": true, "silenced": false, "resolved": false},
+		},
+		{
+			name:   "silenced only",
+			states: []string{"silenced"},
+			want:   map[string]bool{"new": false, "acknowledged": false, "silenced": true, "resolved": false},
+		},
+		{
+			name:   "resolved is never eligible",
+			states: []string{"new", "acknowledged", "silenced", "resolved"},
+			want:   map[string]bool{"new": true, "acknowledged": true, "silenced": true, "resolved": false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Reconciler{activeStates: parseActiveStates(tt.states)}
+			for state, want := range tt.want {
+				if got := r.isActiveGroup(grafana.AlertGroup{ID: "IG1", State: state}); got != want {
+					t.Errorf("isActiveGroup(state %q) = %v, want %v", state, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestReconcileGrafanaActiveStates(t *testing.T) {
+	tests := []struct {
+		name   string
+		states []string
+		want   []string
+	}{
+		{name: "default", want: []string{"IG1"}},
+		{name: "firing and acknowledged", states: []string{"firing", "acknowledged"}, want: []string{"IG1", "IG2"}},
+		{name: "every unresolved state", states: []string{"new", "acknowledged", "silenced"}, want: []string{"IG1", "IG2", "IG3"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			amClient := newAlertmanagerStub(t, alertmanagerAPI([]fakeAlert{
+				{fingerprint: "fp1", labels: map[string]string{"alertname": "DiskFull"}, silencedBy: []string{"s1"}},
+				{fingerprint: "fp2", labels: map[string]string{"alertname": "HighLatency"}, silencedBy: []string{"s2"}},
+				{fingerprint: "fp3", labels: map[string]string{"alertname": "NodeDown"}, silencedBy: []string{"s3"}},
+			}))
+			fake := &fakeGrafana{groups: []grafana.AlertGroup{
+				alertGroup("IG1", "new", "fp1"),
+				alertGroup("IG2", "acknowledged", "fp2"),
+				alertGroup("IG3", "silenced", "fp3"),
+			}}
+			r := NewReconciler(amClient, newGrafanaStub(t, fake.ServeHTTP), testExporter(), config.ReconcileConfig{GrafanaActiveStates: tt.states}, config.TenantConfig{})
+
+			if _, err := r.ReconcileAndResolveOptimized(context.Background()); err != nil {
+				t.Fatalf("ReconcileAndResolveOptimized() error = %v", err)
+			}
+			if got := fake.resolvedGroups(); !slices.Equal(got, tt.want) {
+				t.Errorf("resolved alert groups = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReconcileManagedIntegrations(t *testing.T) {
+	amClient := newAlertmanagerStub(t, alertmanagerAPI([]fakeAlert{
+		{fingerprint: "fp1", labels: map[string]string{"alertname": "DiskFull"}, silencedBy: []string{"s1"}},
+		{fingerprint: "fp2", labels: map[string]string{"alertname": "HighLatency"}, silencedBy: []string{"s2"}},
+	}))
+	managed := alertGroup("IG1", "new", "fp1")
+	managed.IntegrationID, managed.RouteID = "CMANAGED", "RDEFAULT"
+	unmanaged := alertGroup("IG2", "new", "fp2")
+	unmanaged.IntegrationID = "COTHER"
+	fake := &fakeGrafana{groups: []grafana.AlertGroup{managed, unmanaged}}
+	r := NewReconciler(amClient, newGrafanaStub(t, fake.ServeHTTP), testExporter(), config.ReconcileConfig{ManagedIntegrations: []string{"CMANAGED"}}, config.TenantConfig{})
+
+	inconsistencies, err := r.ReconcileAlerts(context.Background())
+	if err != nil {
+		t.Fatalf("ReconcileAlerts() error = %v", err)
+	}
+	if len(inconsistencies) != 1 {
+		t.Fatalf("found %d inconsistencies %v, want only the managed integration's", len(inconsistencies), inconsistencies)
+	}
+	got := inconsistencies[0]
+	if got.GrafanaAlertGroupID != "IG1" || got.GrafanaIntegrationID != "CMANAGED" || got.GrafanaRouteID != "RDEFAULT" {
+		t.Errorf("inconsistency = group %s integration %s route %s, want IG1 CMANAGED RDEFAULT",
+			got.GrafanaAlertGroupID, got.GrafanaIntegrationID, got.GrafanaRouteID)
+	}
+
+	if _, err := r.ReconcileAndResolveOptimized(context.Background()); err != nil {
+		t.Fatalf("ReconcileAndResolveOptimized() error = %v", err)
+	}
+	if got := fake.resolvedGroups(); !slices.Equal(got, []string{"IG1"}) {
+		t.Errorf("resolved alert groups = %v, want [IG1]", got)
+	}
+}
+
+func TestReconcileWithPartialGrafanaPages(t *testing.T) {
+	amClient := newAlertmanagerStub(t, alertmanagerAPI([]fakeAlert{
+		{fingerprint: "fp1", labels: map[string]string{"alertname": "DiskFull"}, silencedBy: []string{"s1"}},
+		{fingerprint: "fp2", labels: map[string]string{"alertname": "HighLatency"}, silencedBy: []string{"s2"}},
+	}))
+	// Page 1 holds IG1 and points to a second page, which fails
+	fake := &fakeGrafana{}
+	grafanaClient := newGrafanaStub(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/api/v1/alert_groups" {
+			fake.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("page") == "2" {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `{"detail":"boom"}`)
+			return
+		}
+		json.NewEncoder(w).Encode(grafana.AlertGroupResponse{
+			Results: []grafana.AlertGroup{alertGroup("IG1", "new", "fp1")},
+			Next:    "https://grafana.example.com/api/v1/alert_groups/?page=2",
+		})
+	})
+	r := NewReconciler(amClient, grafanaClient, testExporter(), config.ReconcileConfig{}, config.TenantConfig{})
+
+	if _, err := r.ReconcileAndResolveOptimized(context.Background()); err != nil {
+		t.Fatalf("ReconcileAndResolveOptimized() error = %v, want the cycle to go on with the first page", err)
+	}
+	if got := fake.resolvedGroups(); !slices.Equal(got, []string{"IG1"}) {
+		t.Errorf("resolved alert groups = %v, want [IG1] from the page that was fetched", got)
+	}
+
+	inconsistencies, err := r.ReconcileAlerts(context.Background())
+	if err != nil {
+		t.Fatalf("ReconcileAlerts() error = %v, want partial results accepted", err)
+	}
+	if len(inconsistencies) != 1 {
+		t.Errorf("ReconcileAlerts() found %d inconsistencies, want 1 from the page that was fetched", len(inconsistencies))
+	}
+}
+
+func TestReconcilePhaseDurations(t *testing.T) {
+	const metric = "alertmanager_sync_reconciliation_phase_duration_seconds"
+	amClient := newAlertmanagerStub(t, alertmanagerAPI([]fakeAlert{
+		{fingerprint: "fp1", labels: map[string]string{"alertname": "DiskFull"}, silencedBy: []string{"s1"}},
+	}))
+	fake := &fakeGrafana{groups: []grafana.AlertGroup{alertGroup("IG1", "new", "fp1")}}
+	r := NewReconciler(amClient, newGrafanaStub(t, fake.ServeHTTP), testExporter(), config.ReconcileConfig{}, config.TenantConfig{})
+
+	phases := []string{phaseFetchAlertmanager, phaseFetchGrafana, phaseExportMetrics, phaseResolve}
+	before := make(map[string]uint64, len(phases))
+	for _, phase := range phases {
+		before[phase] = histogramCount(t, metric, "phase", phase)
+	}
+
+	if _, err := r.ReconcileAndResolveOptimized(context.Background()); err != nil {
+		t.Fatalf("ReconcileAndResolveOptimized() error = %v", err)
+	}
+
+	for _, phase := range phases {
+		if got := histogramCount(t, metric, "phase", phase) - before[phase]; got == 0 {
+			t.Errorf("phase %q was not observed", phase)
+		}
+	}
+}
+
+func TestReconcileResolveGracePeriod(t *testing.T) {
+	amClient := newAlertmanagerStub(t, alertmanagerAPI([]fakeAlert{
+		{fingerprint: "fp1", labels: map[string]string{"alertname": "DiskFull"}, silencedBy: []string{"recent"}, silenceAge: 5 * time.Minute},
+		{fingerprint: "fp2", labels: map[string]string{"alertname": "HighLatency"}, silencedBy: []string{"old"}, silenceAge: time.Hour},
+	}))
+	fake := &fakeGrafana{groups: []grafana.AlertGroup{
+		alertGroup("IG1", "new", "fp1"),
+		alertGroup("IG2", "new", "fp2"),
+	}}
+	r := NewReconciler(amClient, newGrafanaStub(t, fake.ServeHTTP), testExporter(), config.ReconcileConfig{ResolveGracePeriod: 30 * time.Minute}, config.TenantConfig{})
+
+	if _, err := r.ReconcileAndResolveOptimized(context.Background()); err != nil {
+		t.Fatalf("ReconcileAndResolveOptimized() error = %v", err)
+	}
+
+	if got, want := fake.resolvedGroups(), []string{"IG2"}; !slices.Equal(got, want) {
+		t.Errorf("resolved alert groups = %v, want %v (recent silence skipped, old one resolved)", got, want)
+	}
+}
+
+func TestReconcileOrphanedSilences(t *testing.T) {
+	now := time.Now().UTC()
+	silence := func(id, state, comment string) map[string]any {
+		return map[string]any{
+			"id":        id,
+			"comment":   comment,
+			"createdBy": "oncall@example.com",
+			"startsAt":  now.Add(-time.Hour).Format(time.RFC3339),
+			"endsAt":    now.Add(time.Hour).Format(time.RFC3339),
+			"updatedAt": now.Add(-time.Hour).Format(time.RFC3339),
+			"matchers":  []map[string]any{{"name": "alertname", "value": "DiskFull", "isRegex": false, "isEqual": true}},
+			"status":    map[string]string{"state": state},
+		}
+	}
+	toolComment := func(groupID string) string {
+		return fmt.Sprintf("%s DiskFull - https://grafana.example.com (ID: %s)", alertmanager.ToolSilenceCommentPrefix, groupID)
+	}
+	silences := []map[string]any{
+		silence("s-valid", "active", toolComment("IG1")),
+		silence("s-resolved", "active", toolComment("IG2")),
+		silence("s-gone", "pending", toolComment("IG-gone")),
+		silence("s-expired", "expired", toolComment("IG-gone")),
+		silence("s-manual", "active", "maintenance (ID: IG-gone)"),
+	}
+
+	tests := []struct {
+		name        string
+		expire      bool
+		wantExpired []string
+	}{
+		{name: "reported only", expire: false},
+		{name: "expired when enabled", expire: true, wantExpired: []string{"s-gone", "s-resolved"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mutex sync.Mutex
+			var expired []string
+			alerts := alertmanagerAPI(nil)
+			amClient := newAlertmanagerStub(t, func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.Method == http.MethodGet && r.URL.Path == "/api/v2/silences":
+					jsonResponse(silences)(w, r)
+				case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/api/v2/silence/"):
+					mutex.Lock()
+					expired = append(expired, strings.TrimPrefix(r.URL.Path, "/api/v2/silence/"))
+					mutex.Unlock()
+				default:
+					alerts(w, r)
+				}
+			})
+			fake := &fakeGrafana{groups: []grafana.AlertGroup{alertGroup("IG1", "new"), alertGroup("IG2", "resolved")}}
+			r := NewReconciler(amClient, newGrafanaStub(t, fake.ServeHTTP), testExporter(), config.ReconcileConfig{ExpireOrphanedSilences: tt.expire}, config.TenantConfig{})
+
+			if _, err := r.ReconcileAndResolveOptimized(context.Background()); err != nil {
+				t.Fatalf("ReconcileAndResolveOptimized() error = %v", err)
+			}
+
+			if got := metricValue(t, "alertmanager_sync_orphaned_silences"); got != 2 {
+				t.Errorf("alertmanager_sync_orphaned_silences = %v, want 2", got)
+			}
+			slices.Sort(expired)
+			if !slices.Equal(expired, tt.wantExpired) {
+				t.Errorf("expired silences = %v, want %v", expired, tt.wantExpired)
+			}
+		})
+	}
+}
+
+func TestFirstSeenKey(t *testing.T) {
+	withFingerprint := InconsistentAlert{Fingerprint: "fp1", GrafanaAlertGroupID: "IG1"}
+	otherGroup := InconsistentAlert{Fingerprint: "fp1", GrafanaAlertGroupID: "IG2"}
+	if firstSeenKey(withFingerprint) == firstSeenKey(otherGroup) {
+		t.Error("the same alert matched to different alert groups should be tracked separately")
+	}
+
+	labelsA := InconsistentAlert{Alert: &models.GettableAlert{Alert: models.Alert{Labels: models.LabelSet{"alertname": "A"}}}, GrafanaAlertGroupID: "IG1"}
+	labelsB := InconsistentAlert{Alert: &models.GettableAlert{Alert: models.Alert{Labels: models.LabelSet{"alertname": "B"}}}, GrafanaAlertGroupID: "IG1"}
+	if firstSeenKey(labelsA) == firstSeenKey(labelsB) {
+		t.Error("alerts without a fingerprint should be told apart by their labels")
+	}
+}
+
+func TestReconcileRecordsCacheSizes(t *testing.T) {
+	amClient := newAlertmanagerStub(t, alertmanagerAPI([]fakeAlert{
+		{fingerprint: "fp1", labels: map[string]string{"alertname": "DiskFull"}, silencedBy: []string{"s1"}},
+		{fingerprint: "fp2", labels: map[string]string{"alertname": "HighLatency"}, silencedBy: []string{"s2"}},
+		{fingerprint: "fp3", labels: map[string]string{"alertname": "HighLatency"}, silencedBy: []string{"s2"}},
+	}))
+	acknowledged := alertGroup("IG1", "acknowledged", "fp1")
+	acknowledged.AcknowledgedBy = "U1"
+	fake := &fakeGrafana{groups: []grafana.AlertGroup{acknowledged}}
+	gfClient := newGrafanaStub(t, fake.ServeHTTP)
+	r := NewReconciler(amClient, gfClient, testExporter(), config.ReconcileConfig{}, config.TenantConfig{})
+
+	if _, err := r.ReconcileAndResolveOptimized(context.Background()); err != nil {
+		t.Fatalf("ReconcileAndResolveOptimized() error = %v", err)
+	}
+
+	if got := amClient.SilenceCacheSize(); got != 2 {
+		t.Errorf("silence cache holds %d entries, want 2", got)
+	}
+	if got := gfClient.UserCacheSize(); got != 1 {
+		t.Errorf("user cache holds %d entries, want 1", got)
+	}
+	if got := metricValue(t, "alertmanager_sync_silence_cache_size"); got != 2 {
+		t.Errorf("alertmanager_sync_silence_cache_size = %v, want 2", got)
+	}
+	if got := metricValue(t, "alertmanager_sync_user_cache_size"); got != 1 {
+		t.Errorf("alertmanager_sync_user_cache_size = %v, want 1", got)
+	}
+}
+
+func TestReconcileFetchFailures(t *testing.T) {
+	tests := []struct {
+		name        string
+		fetchAlerts func(ctx context.Context) ([]*models.GettableAlert, error)
+		wantErr     error
+		wantMessage string
+	}{
+		{
+			name: "panicking fetch",
+			fetchAlerts: func(ctx context.Context) ([]*models.GettableAlert, error) {
+				panic("boom")
+			},
+			wantMessage: "panic in alertmanager fetch: boom",
+		},
+		{
+			// The fetch ignores the context, so only the guarded channel receive can give up on it
+			name: "hanging fetch",
+			fetchAlerts: func(ctx context.Context) ([]*models.GettableAlert, error) {
+				select {}
+			},
+			wantErr: context.DeadlineExceeded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeGrafana{}
+			r := NewReconciler(newAlertmanagerStub(t, alertmanagerAPI(nil)), newGrafanaStub(t, fake.ServeHTTP), testExporter(), config.ReconcileConfig{}, config.TenantConfig{})
+			r.fetchAlerts = tt.fetchAlerts
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+
+			errChan := make(chan error, 1)
+			go func() {
+				_, err := r.ReconcileAndResolveOptimized(ctx)
+				errChan <- err
+			}()
+
+			select {
+			case err := <-errChan:
+				if err == nil {
+					t.Fatal("ReconcileAndResolveOptimized() error = nil, want an error")
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Errorf("ReconcileAndResolveOptimized() error = %v, want %v", err, tt.wantErr)
+				}
+				if tt.wantMessage != "" && !strings.Contains(err.Error(), tt.wantMessage) {
+					t.Errorf("ReconcileAndResolveOptimized() error = %v, want it to mention %q", err, tt.wantMessage)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("ReconcileAndResolveOptimized() deadlocked")
+			}
+			if r.FirstReconcileDone() {
+				t.Error("FirstReconcileDone() = true after a failed cycle")
+			}
+		})
+	}
+}
+
+func TestReconcileTruncatedAlerts(t *testing.T) {
+	amClient := newAlertmanagerStub(t, alertmanagerAPI([]fakeAlert{
+		{fingerprint: "fp1", labels: map[string]string{"alertname": "DiskFull"}, silencedBy: []string{"s1"}},
+	}))
+	truncated := alertGroup("IG1", "new", "fp1")
+	truncated.LastAlert.Payload.TruncatedAlerts = 3
+	fake := &fakeGrafana{groups: []grafana.AlertGroup{truncated, alertGroup("IG2", "new", "fp2")}}
+	r := NewReconciler(amClient, newGrafanaStub(t, fake.ServeHTTP), testExporter(), config.ReconcileConfig{}, config.TenantConfig{})
+
+	before := metricValue(t, "alertmanager_sync_truncated_alerts_total")
+	if _, err := r.ReconcileAndResolveOptimized(context.Background()); err != nil {
+		t.Fatalf("ReconcileAndResolveOptimized() error = %v", err)
+	}
+
+	if got := metricValue(t, "alertmanager_sync_truncated_alerts_total") - before; got != 3 {
+		t.Errorf("alertmanager_sync_truncated_alerts_total increased by %v, want 3", got)
+	}
+}
+
+func TestReconcileLogsShareCorrelationID(t *testing.T) {
+	amClient := newAlertmanagerStub(t, alertmanagerAPI([]fakeAlert{
+		{fingerprint: "fp1", labels: map[string]string{"alertname": "DiskFull"}, silencedBy: []string{"s1"}},
+	}))
+	fake := &fakeGrafana{groups: []grafana.AlertGroup{alertGroup("IG1", "new", "fp1")}}
+	r := NewReconciler(amClient, newGrafanaStub(t, fake.ServeHTTP), testExporter(), config.ReconcileConfig{}, config.TenantConfig{})
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	log.SetFlags(0)
+	t.Cleanup(func() {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(log.LstdFlags)
+	})
+
+	if _, err := r.ReconcileAndResolveOptimized(context.Background()); err != nil {
+		t.Fatalf("ReconcileAndResolveOptimized() error = %v", err)
+	}
+
+	ids := make(map[string]int)
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		id, _, found := strings.Cut(strings.TrimPrefix(line, "["), "] ")
+		if !strings.HasPrefix(line, "[") || !found {
+			t.Errorf("log line without correlation ID: %q", line)
+			continue
+		}
+		ids[id]++
+	}
+	if len(ids) != 1 {
+		t.Fatalf("cycle logged with correlation IDs %v, want a single ID", ids)
+	}
+	for id, lines := range ids {
+		if lines < 4 {
+			t.Errorf("only %d log lines carry correlation ID %s, want every phase of the cycle", lines, id)
+		}
+	}
+}
+
+func TestReconcileModes(t *testing.T) {
+	const phaseMetric = "alertmanager_sync_reconciliation_phase_duration_seconds"
+	tests := []struct {
+		mode             string
+		wantResolved     []string
+		wantExport       bool
+		wantResolvePhase bool
+	}{
+		{mode: ModeExportOnly, wantExport: true},
+		{mode: ModeResolve, wantResolved: []string{"IG1"}, wantResolvePhase: true},
+		{mode: ModeBoth, wantResolved: []string{"IG1"}, wantExport: true, wantResolvePhase: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			amClient := newAlertmanagerStub(t, alertmanagerAPI([]fakeAlert{
+				{fingerprint: "fp1", labels: map[string]string{"alertname": "DiskFull"}, silencedBy: []string{"s1"}},
+			}))
+			fake := &fakeGrafana{groups: []grafana.AlertGroup{alertGroup("IG1", "new", "fp1")}}
+			r := NewReconciler(amClient, newGrafanaStub(t, fake.ServeHTTP), testExporter(), config.ReconcileConfig{Mode: tt.mode}, config.TenantConfig{})
+
+			// A sentinel value shows whether the cycle touched the inconsistency gauge
+			testExporter().RecordReconciliationSuccess(42)
+			exportsBefore := histogramCount(t, phaseMetric, "phase", phaseExportMetrics)
+			resolvesBefore := histogramCount(t, phaseMetric, "phase", phaseResolve)
+
+			if _, err := r.ReconcileAndResolveOptimized(context.Background()); err != nil {
+				t.Fatalf("ReconcileAndResolveOptimized() error = %v", err)
+			}
+
+			if got := fake.resolvedGroups(); !slices.Equal(got, tt.wantResolved) {
+				t.Errorf("resolved alert groups = %v, want %v", got, tt.wantResolved)
+			}
+			if got := histogramCount(t, phaseMetric, "phase", phaseExportMetrics) > exportsBefore; got != tt.wantExport {
+				t.Errorf("metrics export ran = %v, want %v", got, tt.wantExport)
+			}
+			if got := histogramCount(t, phaseMetric, "phase", phaseResolve) > resolvesBefore; got != tt.wantResolvePhase {
+				t.Errorf("silence reconciliation ran = %v, want %v", got, tt.wantResolvePhase)
+			}
+
+			wantFound := 1.0
+			if tt.mode == ModeExportOnly {
+				wantFound = 42
+			}
+			if got := metricValue(t, "alertmanager_sync_inconsistencies_found"); got != wantFound {
+				t.Errorf("alertmanager_sync_inconsistencies_found = %v, want %v", got, wantFound)
+			}
+			if got := metricValue(t, "alertmanager_sync_last_reconciliation_success"); got != 1 {
+				t.Errorf("alertmanager_sync_last_reconciliation_success = %v, want 1", got)
+			}
+		})
+	}
+}
+
+func TestReconcileAuditsResolutions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	if err := audit.Configure(path); err != nil {
+		t.Fatalf("audit.Configure() error = %v", err)
+	}
+	t.Cleanup(func() { audit.Configure("") })
+
+	amClient := newAlertmanagerStub(t, alertmanagerAPI([]fakeAlert{
+		{fingerprint: "fp1", labels: map[string]string{"alertname": "DiskFull"}, silencedBy: []string{"s1"}},
+	}))
+	fake := &fakeGrafana{groups: []grafana.AlertGroup{alertGroup("IG1", "new", "fp1")}}
+	r := NewReconciler(amClient, newGrafanaStub(t, fake.ServeHTTP), testExporter(), config.ReconcileConfig{}, config.TenantConfig{})
+	if _, err := r.ReconcileAndResolveOptimized(context.Background()); err != nil {
+		t.Fatalf("ReconcileAndResolveOptimized() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record map[string]any
+	if err := json.Unmarshal(data, &record); err != nil {
+		t.Fatalf("audit log %q is not a single JSON record: %v", data, err)
+	}
+	if record["action"] != audit.ActionResolveAlertGroup || record["alert_group_id"] != "IG1" || record["fingerprint"] != "fp1" || record["outcome"] != "success" {
+		t.Errorf("audit record = %v, want a successful resolution of IG1 for fp1", record)
+	}
+	if record["actor"] != audit.SystemActor || record["reason"] == "" || record["correlation_id"] == "" {
+		t.Errorf("audit record = %v, want the system actor, a reason and a correlation ID", record)
+	}
+}
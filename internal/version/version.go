@@ -0,0 +1,35 @@
+package version
+
+import "runtime"
+
+// Build information, set at build time via -ldflags, e.g.:
+//
+//	go build -ldflags "-X github.com/gabrielpetry/alertmanager-alert-sync/internal/version.Version=v1.0.0"
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildDate = "unknown"
+)
+
+// Info holds the build information reported by the service
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+}
+
+// UserAgent returns the default User-Agent sent to Alertmanager and Grafana IRM
+func UserAgent() string {
+	return "alertmanager-alert-sync/" + Version
+}
+
+// Get returns the current build information
+func Get() Info {
+	return Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+	}
+}